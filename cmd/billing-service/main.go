@@ -5,14 +5,25 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/aziz46/core-e-voucher-services/internal/billing/consumer"
 	"github.com/aziz46/core-e-voucher-services/internal/billing/handler"
+	"github.com/aziz46/core-e-voucher-services/internal/common/client"
 	"github.com/aziz46/core-e-voucher-services/pkg/config"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/aziz46/core-e-voucher-services/pkg/redis"
+	"github.com/aziz46/core-e-voucher-services/pkg/serviceauth"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	if cfg.ServiceAuth.Secret == "" {
+		log.Fatal("SERVICE_AUTH_SECRET must be set")
+	}
 
 	// Initialize database
 	ctx := context.Background()
@@ -22,6 +33,36 @@ func main() {
 	}
 	defer db.CloseDB()
 
+	// Initialize nonce store for replay protection of signed payment callbacks
+	var nonces serviceauth.NonceStore = serviceauth.NewMemoryNonceStore()
+	if cfg.ServiceAuth.NonceBackend == "redis" {
+		if err := redis.InitRedis(ctx, cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB); err != nil {
+			log.Fatalf("Failed to initialize redis: %v", err)
+		}
+		defer redis.CloseRedis()
+		nonces = serviceauth.NewRedisNonceStore(redis.Client)
+	}
+	verifier := serviceauth.NewVerifier(cfg.ServiceAuth.Secret, cfg.ServiceAuth.MaxSkew, nonces)
+
+	// Initialize internal service clients
+	client.InitCreditClient(cfg.Services.CreditURL, "billing-service", cfg.ServiceAuth.Secret)
+
+	// Receivables come from ppob-core's transaction events, which an in-process bus never carries
+	if cfg.EventBus.Backend == "memory" {
+		log.Fatal("EVENT_BUS_BACKEND=memory cannot deliver ppob-core events to billing-service; use rabbitmq")
+	}
+
+	// Initialize event bus and relay this service's outbox events
+	bus, err := eventbus.Open(cfg.EventBus.Backend, cfg.EventBus.URL, cfg.EventBus.Exchange)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+	go outbox.RunRelay(ctx, bus, []string{"invoice"}, cfg.EventBus.RelayInterval, 100)
+	if err := consumer.SubscribeReceivables(ctx, bus); err != nil {
+		log.Fatalf("Failed to subscribe receivables consumer: %v", err)
+	}
+
 	// Create Fiber app
 	app := fiber.New()
 
@@ -33,9 +74,11 @@ func main() {
 	v1 := app.Group("/v1")
 
 	// Billing endpoints
-	v1.Get("/tenants/:tenant_id/invoices", handler.ListInvoices)
-	v1.Post("/tenants/:tenant_id/invoices/generate", handler.GenerateInvoice)
-	v1.Post("/payments/callback", handler.PaymentCallback)
+	tenants := v1.Group("/tenants", middleware.AuthMiddleware())
+	tenant := middleware.RequireTenant("tenant_id")
+	tenants.Get("/:tenant_id/invoices", tenant, middleware.RequireScope(models.ScopeInvoicesRead), handler.ListInvoices)
+	tenants.Post("/:tenant_id/invoices/generate", tenant, middleware.RequireScope(models.ScopeInvoicesWrite), handler.GenerateInvoice)
+	v1.Post("/payments/callback", middleware.ServiceAuthMiddleware(verifier), handler.PaymentCallback)
 
 	// Start server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -4,24 +4,66 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/aziz46/core-e-voucher-services/internal/credit/handler"
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+	"github.com/aziz46/core-e-voucher-services/internal/credit/worker"
 	"github.com/aziz46/core-e-voucher-services/pkg/config"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/aziz46/core-e-voucher-services/pkg/redis"
+	"github.com/aziz46/core-e-voucher-services/pkg/serviceauth"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	if cfg.ServiceAuth.Secret == "" {
+		log.Fatal("SERVICE_AUTH_SECRET must be set")
+	}
+	loc, err := time.LoadLocation(cfg.Server.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid SERVER_TIMEZONE %q: %v", cfg.Server.Timezone, err)
+	}
 
 	// Initialize database
 	ctx := context.Background()
-	err := db.InitDB(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, "e_voucher")
+	err = db.InitDB(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, "e_voucher")
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.CloseDB()
 
+	// Initialize nonce store for replay protection
+	var nonces serviceauth.NonceStore = serviceauth.NewMemoryNonceStore()
+	if cfg.ServiceAuth.NonceBackend == "redis" {
+		if err := redis.InitRedis(ctx, cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB); err != nil {
+			log.Fatalf("Failed to initialize redis: %v", err)
+		}
+		defer redis.CloseRedis()
+		nonces = serviceauth.NewRedisNonceStore(redis.Client)
+	}
+	verifier := serviceauth.NewVerifier(cfg.ServiceAuth.Secret, cfg.ServiceAuth.MaxSkew, nonces)
+
+	// Initialize event bus and relay this service's outbox events
+	bus, err := eventbus.Open(cfg.EventBus.Backend, cfg.EventBus.URL, cfg.EventBus.Exchange)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+	go outbox.RunRelay(ctx, bus, []string{"credit_reservation"}, cfg.EventBus.RelayInterval, 100)
+
+	// Start background workers
+	service.DefaultHoldTTL = cfg.Credit.HoldTTL
+	service.MaxHoldTTL = cfg.Credit.MaxHoldTTL
+	go worker.RunHoldSweeper(ctx, cfg.Credit.SweepInterval, 100)
+	go worker.RunLimitResetScheduler(ctx, loc, cfg.Credit.ResetInterval, 100)
+	go worker.RunLimitChangeExpirer(ctx, cfg.Credit.SweepInterval, 100)
+
 	// Create Fiber app
 	app := fiber.New()
 
@@ -32,10 +74,24 @@ func main() {
 
 	v1 := app.Group("/v1")
 
-	// Credit endpoints
-	v1.Get("/partners/:partner_id/limit", handler.GetLimit)
-	v1.Post("/partners/:partner_id/reserve", handler.Reserve)
-	v1.Post("/partners/:partner_id/restore", handler.Restore)
+	// Credit endpoints (internal, signed service calls only)
+	partners := v1.Group("/partners", middleware.ServiceAuthMiddleware(verifier))
+	partners.Get("/:partner_id/limit", handler.GetLimit)
+	partners.Post("/:partner_id/reserve", handler.Reserve)
+	partners.Post("/:partner_id/capture", handler.Capture)
+	partners.Post("/:partner_id/pin", handler.Pin)
+	partners.Post("/:partner_id/release", handler.Release)
+	partners.Post("/:partner_id/restore", handler.Restore)
+	partners.Post("/:partner_id/payments", handler.RecordPayment)
+
+	// Admin endpoints
+	admin := v1.Group("/admin", middleware.AdminMiddleware(cfg.Admin.Tokens))
+	admin.Get("/partners/:partner_id/ledger", handler.GetLedger)
+	admin.Get("/partners/:partner_id/ledger/reconcile", handler.ReconcileLedger)
+	admin.Post("/partners/:partner_id/limit-changes", handler.ProposeLimitChange)
+	admin.Get("/partners/:partner_id/limit-changes", handler.ListLimitChanges)
+	admin.Post("/limit-changes/:change_id/approve", handler.ApproveLimitChange)
+	admin.Post("/limit-changes/:change_id/reject", handler.RejectLimitChange)
 
 	// Start server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
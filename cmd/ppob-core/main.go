@@ -4,24 +4,153 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/aziz46/core-e-voucher-services/internal/common/client"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/fulfillment"
 	"github.com/aziz46/core-e-voucher-services/internal/ppob/handler"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/inventory"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/pricing"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/provider"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/receipt"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/webhook"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/worker"
 	"github.com/aziz46/core-e-voucher-services/pkg/config"
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/aziz46/core-e-voucher-services/pkg/ratelimit"
+	"github.com/aziz46/core-e-voucher-services/pkg/redis"
+	"github.com/aziz46/core-e-voucher-services/pkg/secret"
+	"github.com/aziz46/core-e-voucher-services/pkg/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	if cfg.ServiceAuth.Secret == "" {
+		log.Fatal("SERVICE_AUTH_SECRET must be set")
+	}
+	loc, err := time.LoadLocation(cfg.Server.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid SERVER_TIMEZONE %q: %v", cfg.Server.Timezone, err)
+	}
+	// Tiered fees count a partner's volume per calendar month in the reporting timezone
+	pricing.Location = loc
 
 	// Initialize database
 	ctx := context.Background()
-	err := db.InitDB(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, "e_voucher")
+	err = db.InitDB(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, "e_voucher")
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.CloseDB()
 
+	// Initialize rate limiter store
+	var limiterStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Backend == "redis" {
+		if err := redis.InitRedis(ctx, cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB); err != nil {
+			log.Fatalf("Failed to initialize redis: %v", err)
+		}
+		defer redis.CloseRedis()
+		limiterStore = ratelimit.NewRedisStore(redis.Client)
+	}
+
+	// Initialize internal service clients
+	client.InitCreditClient(cfg.Services.CreditURL, "ppob-core", cfg.ServiceAuth.Secret)
+
+	// Resolve providers from provider_configs, decrypting their credentials. The same key
+	// protects fulfillment tokens, webhook secrets and voucher codes, so it is required.
+	if cfg.PPOB.EncryptionKey == "" {
+		log.Fatal("PPOB_ENCRYPTION_KEY must be set")
+	}
+	provider.Box, err = secret.NewBox(cfg.PPOB.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption: %v", err)
+	}
+	provider.RetryPolicy = connector.RetryPolicy{
+		MaxAttempts: cfg.PPOB.RetryMaxAttempts,
+		BaseDelay:   cfg.PPOB.RetryBaseDelay,
+		MaxDelay:    cfg.PPOB.RetryMaxDelay,
+	}
+	saga.ResolveProvider = provider.Route
+	saga.LookupProvider = provider.Lookup
+
+	// Initialize event bus and relay this service's outbox events
+	bus, err := eventbus.Open(cfg.EventBus.Backend, cfg.EventBus.URL, cfg.EventBus.Exchange)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+	go outbox.RunRelay(ctx, bus, []string{"transaction", "product"}, cfg.EventBus.RelayInterval, 100)
+
+	// Start background workers
+	saga.Lease = cfg.Saga.Lease
+	saga.MaxAttempts = cfg.Saga.MaxAttempts
+	saga.StatusCheckDelay = cfg.Saga.StatusCheckDelay
+	saga.StatusCheckMaxDelay = cfg.Saga.StatusCheckMaxDelay
+	saga.MaxStatusChecks = cfg.Saga.MaxStatusChecks
+	handler.InquiryTTL = cfg.PPOB.InquiryTTL
+	handler.IdempotencyWait = cfg.PPOB.IdempotencyWait
+	go worker.RunSagaRecovery(ctx, cfg.Saga.RecoveryInterval, 50)
+	go worker.RunStatusChecks(ctx, cfg.Saga.StatusCheckInterval, 50)
+
+	// Run async transactions in the background
+	pool := worker.NewTransactionPool(cfg.PPOB.AsyncQueueSize)
+	pool.Run(ctx, cfg.PPOB.AsyncWorkers)
+	handler.AsyncPool = pool
+
+	// Deliver transaction events to tenant webhooks
+	webhook.Box = provider.Box
+	webhook.MaxAttempts = cfg.Webhook.MaxAttempts
+	webhook.BaseDelay = cfg.Webhook.BaseDelay
+	webhook.MaxDelay = cfg.Webhook.MaxDelay
+	webhook.Client.Timeout = cfg.Webhook.Timeout
+	if webhook.Lease <= cfg.Webhook.Timeout {
+		webhook.Lease = 2 * cfg.Webhook.Timeout
+	}
+	go worker.RunWebhookDelivery(ctx, cfg.Webhook.Interval, 50)
+
+	// Fulfillment tokens and voucher codes are encrypted with the same key
+	fulfillment.Box = provider.Box
+
+	// Fulfill voucher products from imported codes
+	inventory.Box = provider.Box
+	inventory.MaxImportRows = cfg.Inventory.MaxImportRows
+	go worker.RunVoucherExpiry(ctx, cfg.Inventory.ExpiryInterval)
+
+	// Render a receipt for every successful transaction into object storage
+	store, err := storage.Open(storage.Config{
+		Backend:  cfg.Storage.Backend,
+		LocalDir: cfg.Storage.LocalDir,
+		S3: storage.S3Config{
+			Endpoint:       cfg.Storage.S3Endpoint,
+			PublicEndpoint: cfg.Storage.S3PublicEndpoint,
+			Region:         cfg.Storage.S3Region,
+			Bucket:         cfg.Storage.S3Bucket,
+			AccessKey:      cfg.Storage.S3AccessKey,
+			SecretKey:      cfg.Storage.S3SecretKey,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize object storage: %v", err)
+	}
+	if s3, ok := store.(*storage.S3Store); ok {
+		if err := s3.EnsureBucket(ctx); err != nil {
+			log.Printf("Warning: receipt bucket not ready: %v", err)
+		}
+	}
+	receipt.Store = store
+	receipt.URLTTL = cfg.Storage.ReceiptURLTTL
+	if err := receipt.Subscribe(ctx, bus); err != nil {
+		log.Fatalf("Failed to subscribe receipt renderer: %v", err)
+	}
+
 	// Create Fiber app
 	app := fiber.New()
 
@@ -32,9 +161,53 @@ func main() {
 
 	v1 := app.Group("/v1")
 
+	// Admin endpoints
+	admin := v1.Group("/admin", middleware.AdminMiddleware(cfg.Admin.Tokens))
+	admin.Post("/tenants/:tenant_id/api-keys", handler.IssueAPIKey)
+	admin.Get("/tenants/:tenant_id/api-keys", handler.ListAPIKeys)
+	admin.Delete("/tenants/:tenant_id/api-keys/:key_id", handler.RevokeAPIKey)
+	admin.Get("/transactions/:tx_id/provider-attempts", handler.ListProviderAttempts)
+	admin.Get("/transactions/unsettled", handler.ListUnsettledTransactions)
+	admin.Post("/transactions/:tx_id/resolve", handler.ResolveTransaction)
+	admin.Get("/providers/breakers", handler.ListProviderBreakers)
+	admin.Post("/products", handler.CreateProduct)
+	admin.Get("/products", handler.ListProducts)
+	admin.Get("/products/:code", handler.GetProduct)
+	admin.Put("/products/:code", handler.UpdateProduct)
+	admin.Delete("/products/:code", handler.DeleteProduct)
+	admin.Post("/tenants/:tenant_id/product-prices", handler.CreateProductPrice)
+	admin.Get("/tenants/:tenant_id/product-prices", handler.ListProductPrices)
+	admin.Put("/tenants/:tenant_id/product-prices/:price_id", handler.UpdateProductPrice)
+	admin.Delete("/tenants/:tenant_id/product-prices/:price_id", handler.DeleteProductPrice)
+	admin.Post("/tenants/:tenant_id/fee-rules", handler.CreateFeeRule)
+	admin.Get("/tenants/:tenant_id/fee-rules", handler.ListFeeRules)
+	admin.Put("/tenants/:tenant_id/fee-rules/:rule_id", handler.UpdateFeeRule)
+	admin.Delete("/tenants/:tenant_id/fee-rules/:rule_id", handler.DeleteFeeRule)
+	admin.Post("/tenants/:tenant_id/quotes", handler.QuoteTransaction)
+	admin.Put("/tenants/:tenant_id/webhook", handler.PutTenantWebhook)
+	admin.Get("/tenants/:tenant_id/webhook", handler.GetTenantWebhook)
+	admin.Put("/tenants/:tenant_id/branding", handler.PutTenantBranding)
+	admin.Get("/tenants/:tenant_id/branding", handler.GetTenantBranding)
+	admin.Post("/inventory/batches", handler.ImportVoucherBatch)
+	admin.Get("/inventory/batches", handler.ListVoucherBatches)
+	admin.Get("/inventory/stock", handler.GetVoucherStock)
+	admin.Put("/inventory/products/:code/threshold", handler.SetLowStockThreshold)
+
 	// PPOB endpoints
-	v1.Post("/:tenant/transactions", handler.CreateTransaction)
-	v1.Get("/:tenant/transactions/:tx_id", handler.GetTransaction)
+	auth := middleware.AuthMiddleware()
+	tenant := middleware.RequireTenant("tenant")
+	rateLimit := middleware.RateLimitMiddleware(limiterStore, cfg.RateLimit)
+	v1.Get("/:tenant/products", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.ListTenantProducts)
+	v1.Post("/:tenant/inquiries", auth, tenant, middleware.RequireScope(models.ScopeTransactionsWrite), rateLimit, handler.CreateInquiry)
+	v1.Post("/:tenant/transactions", auth, tenant, middleware.RequireScope(models.ScopeTransactionsWrite), rateLimit, handler.CreateTransaction)
+	v1.Get("/:tenant/transactions", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.ListTransactions)
+	v1.Get("/:tenant/transactions/:tx_id", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.GetTransaction)
+	v1.Get("/:tenant/transactions/:tx_id/receipt", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.GetReceipt)
+	v1.Post("/:tenant/transactions/:tx_id/voucher/reveal", auth, tenant, middleware.RequireScope(models.ScopeTransactionsWrite), handler.RevealVoucher)
+	v1.Post("/:tenant/transactions/:tx_id/cancel", auth, tenant, middleware.RequireScope(models.ScopeTransactionsWrite), handler.CancelTransaction)
+	v1.Get("/:tenant/webhooks/deliveries", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.ListWebhookDeliveries)
+	v1.Get("/:tenant/webhooks/deliveries/:delivery_id", auth, tenant, middleware.RequireScope(models.ScopeTransactionsRead), handler.GetWebhookDelivery)
+	v1.Post("/:tenant/webhooks/deliveries/:delivery_id/redeliver", auth, tenant, middleware.RequireScope(models.ScopeTransactionsWrite), handler.RedeliverWebhook)
 
 	// Start server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -0,0 +1,113 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ReceivablesConsumer is the consumer name under which billing records receivables
+const ReceivablesConsumer = "billing.receivables"
+
+// SubscribeReceivables records an outstanding receivable for every successful transaction
+// and adjusts receivables and invoices when a transaction is cancelled
+func SubscribeReceivables(ctx context.Context, bus eventbus.Bus) error {
+	return bus.Subscribe(ctx, ReceivablesConsumer,
+		[]string{eventbus.TransactionSucceeded, eventbus.TransactionCancelled},
+		outbox.Idempotent(ReceivablesConsumer, func(ctx context.Context, tx pgx.Tx, event eventbus.Event) error {
+			if event.Type == eventbus.TransactionCancelled {
+				return adjustForCancellation(ctx, tx, event)
+			}
+			return recordReceivable(ctx, tx, event)
+		}))
+}
+
+func recordReceivable(ctx context.Context, tx pgx.Tx, event eventbus.Event) error {
+	var payload eventbus.TransactionEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return eventbus.Permanent(fmt.Errorf("failed to decode transaction event: %w", err))
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO receivables (id, tenant_id, partner_id, amount, status, tx_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (tx_id) DO NOTHING`,
+		uuid.New().String(), payload.TenantID, payload.PartnerID, payload.Total, "outstanding", payload.TxID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record receivable: %w", err)
+	}
+	return nil
+}
+
+// adjustForCancellation cancels the transaction's receivable and takes its total off the
+// partner's unpaid invoice for the period, if one was issued. A paid invoice is left as it
+// is and the amount is recorded as refund_due for the operators. Each transaction is
+// adjusted at most once.
+func adjustForCancellation(ctx context.Context, tx pgx.Tx, event eventbus.Event) error {
+	var payload eventbus.TransactionEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return eventbus.Permanent(fmt.Errorf("failed to decode transaction event: %w", err))
+	}
+
+	// The event may overtake the succeeded one, so the receivable is recorded as cancelled
+	_, err := tx.Exec(ctx,
+		`INSERT INTO receivables (id, tenant_id, partner_id, amount, status, tx_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (tx_id) DO UPDATE SET status = EXCLUDED.status`,
+		uuid.New().String(), payload.TenantID, payload.PartnerID, payload.Total, "cancelled", payload.TxID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to cancel receivable: %w", err)
+	}
+
+	// Invoices bill success transactions created within their period
+	var invoiceID, invoiceStatus string
+	err = tx.QueryRow(ctx,
+		`SELECT i.id, i.status FROM invoices i
+		 JOIN transactions t ON t.id = $1
+		 WHERE i.tenant_id = $2 AND i.partner_id = $3 AND i.status <> $4
+		   AND t.created_at BETWEEN i.period_start AND i.period_end
+		 ORDER BY i.created_at DESC LIMIT 1
+		 FOR UPDATE OF i`,
+		payload.TxID, payload.TenantID, payload.PartnerID, models.InvoiceStatusCancelled).Scan(&invoiceID, &invoiceStatus)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to find invoice: %w", err)
+	}
+
+	status := models.InvoiceAdjustmentUninvoiced
+	switch {
+	case invoiceID == "":
+	case invoiceStatus == models.InvoicStatusPaid:
+		status = models.InvoiceAdjustmentRefundDue
+	default:
+		status = models.InvoiceAdjustmentApplied
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO invoice_adjustments (id, tx_id, tenant_id, partner_id, amount, status, invoice_id, reason, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)
+		 ON CONFLICT (tx_id) DO NOTHING`,
+		uuid.New().String(), payload.TxID, payload.TenantID, payload.PartnerID, -payload.Total, status, invoiceID,
+		"transaction cancelled", time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record invoice adjustment: %w", err)
+	}
+	if tag.RowsAffected() == 0 || status != models.InvoiceAdjustmentApplied {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE invoices SET amount_due = amount_due - $1 WHERE id = $2",
+		payload.Total, invoiceID)
+	if err != nil {
+		return fmt.Errorf("failed to adjust invoice: %w", err)
+	}
+	return nil
+}
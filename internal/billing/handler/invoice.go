@@ -2,12 +2,18 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/aziz46/core-e-voucher-services/internal/common/client"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 // ListInvoicesRequest is the query for listing invoices
@@ -108,27 +114,51 @@ func GenerateInvoice(c *fiber.Ctx) error {
 			"error": "failed to generate invoices",
 		})
 	}
-	defer rows.Close()
 
-	var generated int
+	// Read all totals first: the connection cannot run inserts while rows are open
+	type partnerTotal struct {
+		partnerID string
+		amount    int64
+	}
+	var totals []partnerTotal
 	for rows.Next() {
-		var partnerID string
-		var totalAmount int64
-		if err := rows.Scan(&partnerID, &totalAmount); err != nil {
+		var pt partnerTotal
+		if err := rows.Scan(&pt.partnerID, &pt.amount); err != nil {
 			continue
 		}
+		totals = append(totals, pt)
+	}
+	rows.Close()
 
+	var generated int
+	for _, pt := range totals {
 		invoiceID := uuid.New().String()
 		dueDate := periodEnd.AddDate(0, 0, 30) // 30 days due
 
 		_, err := tx.Exec(ctx,
 			`INSERT INTO invoices (id, tenant_id, partner_id, period_start, period_end, amount_due, status, due_date, created_at)
 			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-			invoiceID, tenantID, partnerID, periodStart, periodEnd, totalAmount, "issued", dueDate, now)
+			invoiceID, tenantID, pt.partnerID, periodStart, periodEnd, pt.amount, models.InvoiceStatusIssued, dueDate, now)
 
 		if err != nil {
 			log.Printf("Error creating invoice: %v", err)
-			continue
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to generate invoices",
+			})
+		}
+
+		err = outbox.Add(ctx, tx, "invoice", invoiceID, eventbus.InvoiceIssued, eventbus.InvoiceEvent{
+			InvoiceID: invoiceID,
+			TenantID:  tenantID,
+			PartnerID: pt.partnerID,
+			Amount:    pt.amount,
+			Status:    models.InvoiceStatusIssued,
+		})
+		if err != nil {
+			log.Printf("Error recording invoice event: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to generate invoices",
+			})
 		}
 		generated++
 	}
@@ -145,7 +175,10 @@ func GenerateInvoice(c *fiber.Ctx) error {
 	})
 }
 
-// PaymentCallback handles payment callbacks from providers
+// PaymentCallback marks an issued invoice paid and returns its amount due to the partner's
+// credit limit. The route is signed like internal calls. A callback for an invoice that is
+// already paid changes nothing; the credit call is re-sent, which credit-service applies once
+// per invoice, so that a restore that failed earlier still completes.
 func PaymentCallback(c *fiber.Ctx) error {
 	type CallbackRequest struct {
 		TenantID  string `json:"tenant_id"`
@@ -170,24 +203,81 @@ func PaymentCallback(c *fiber.Ctx) error {
 	}
 	defer tx.Rollback(ctx)
 
-	// Update invoice status to paid
-	_, err = tx.Exec(ctx,
-		"UPDATE invoices SET status = $1 WHERE id = $2",
-		"paid", req.InvoiceID)
-
+	var tenantID, partnerID, status string
+	var amountDue int64
+	err = tx.QueryRow(ctx,
+		"SELECT tenant_id, partner_id, COALESCE(status, ''), amount_due FROM invoices WHERE id = $1 FOR UPDATE",
+		req.InvoiceID).Scan(&tenantID, &partnerID, &status, &amountDue)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invoice not found",
+		})
+	}
 	if err != nil {
-		log.Printf("Error updating invoice: %v", err)
+		log.Printf("Error fetching invoice: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to process payment",
 		})
 	}
 
+	if (req.TenantID != "" && req.TenantID != tenantID) || (req.PartnerID != "" && req.PartnerID != partnerID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invoice not found",
+		})
+	}
+	if req.Amount != amountDue {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":      "amount does not match invoice",
+			"amount_due": amountDue,
+		})
+	}
+
+	switch status {
+	case models.InvoicStatusPaid:
+		log.Printf("Payment callback for invoice %s which is already paid", req.InvoiceID)
+	case models.InvoiceStatusIssued, models.InvoiceStatusOverdue:
+		_, err = tx.Exec(ctx, "UPDATE invoices SET status = $1 WHERE id = $2", models.InvoicStatusPaid, req.InvoiceID)
+		if err != nil {
+			log.Printf("Error updating invoice: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to process payment",
+			})
+		}
+		err = outbox.Add(ctx, tx, "invoice", req.InvoiceID, eventbus.InvoicePaid, eventbus.InvoiceEvent{
+			InvoiceID: req.InvoiceID,
+			TenantID:  tenantID,
+			PartnerID: partnerID,
+			Amount:    amountDue,
+			Status:    models.InvoicStatusPaid,
+		})
+		if err != nil {
+			log.Printf("Error recording invoice event: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to process payment",
+			})
+		}
+	default:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "invoice is not payable",
+			"status": status,
+		})
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "transaction commit failed",
 		})
 	}
 
+	// Called after the commit so that no row lock is held across the request; a failure is
+	// retried by repeating the callback
+	if err := client.Credit.RecordPayment(ctx, partnerID, req.InvoiceID, amountDue); err != nil {
+		log.Printf("Error recording payment of invoice %s with credit service: %v", req.InvoiceID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "invoice paid, but the credit limit was not restored; retry the callback",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"status": "payment processed",
 	})
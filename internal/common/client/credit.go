@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/serviceauth"
+)
+
+// Credit service errors
+var (
+	ErrInsufficientCredit = errors.New("insufficient credit limit")
+	ErrConflict           = errors.New("credit service rejected request")
+	ErrNotFound           = errors.New("credit service resource not found")
+	// ErrReservationMismatch is returned when the tx_id is held for another partner or amount
+	ErrReservationMismatch = errors.New("reservation does not match partner or amount")
+	// ErrInvalidReservationState is returned when the hold no longer allows the operation,
+	// e.g. it was released after expiring
+	ErrInvalidReservationState = errors.New("reservation is not in a state that allows this operation")
+)
+
+// conflictErrors maps the code of a 409 response to its error
+var conflictErrors = map[string]error{
+	models.ReservationConflictInsufficientLimit: ErrInsufficientCredit,
+	models.ReservationConflictMismatch:          ErrReservationMismatch,
+	models.ReservationConflictInvalidState:      ErrInvalidReservationState,
+}
+
+// Credit is the shared credit-service client
+var Credit *CreditClient
+
+// CreditClient calls credit-service with signed requests
+type CreditClient struct {
+	baseURL string
+	service string
+	secret  string
+	http    *http.Client
+}
+
+// InitCreditClient initializes the shared credit-service client.
+// service identifies the calling service in signed requests.
+func InitCreditClient(baseURL, service, secret string) {
+	Credit = &CreditClient{
+		baseURL: baseURL,
+		service: service,
+		secret:  secret,
+		http:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Reserve places a hold on amount of the partner's limit for a transaction. Conflicts other
+// than ErrInsufficientCredit are returned as ErrReservationMismatch or ErrInvalidReservationState.
+func (c *CreditClient) Reserve(ctx context.Context, partnerID, txID string, amount int64) error {
+	err := c.post(ctx, fmt.Sprintf("/v1/partners/%s/reserve", partnerID), map[string]interface{}{
+		"tx_id":  txID,
+		"amount": amount,
+	})
+	if errors.Is(err, ErrInsufficientCredit) {
+		return ErrInsufficientCredit
+	}
+	return err
+}
+
+// Capture finalizes a transaction's hold after the provider succeeded
+func (c *CreditClient) Capture(ctx context.Context, partnerID, txID string) error {
+	return c.post(ctx, fmt.Sprintf("/v1/partners/%s/capture", partnerID), map[string]interface{}{
+		"tx_id": txID,
+	})
+}
+
+// Pin keeps a transaction's hold from expiring until it is captured or released
+func (c *CreditClient) Pin(ctx context.Context, partnerID, txID string) error {
+	return c.post(ctx, fmt.Sprintf("/v1/partners/%s/pin", partnerID), map[string]interface{}{
+		"tx_id": txID,
+	})
+}
+
+// Release returns a transaction's hold or captured amount to the partner's limit
+func (c *CreditClient) Release(ctx context.Context, partnerID, txID string, amount int64) error {
+	return c.post(ctx, fmt.Sprintf("/v1/partners/%s/release", partnerID), map[string]interface{}{
+		"tx_id":  txID,
+		"amount": amount,
+	})
+}
+
+// RecordPayment returns an invoice payment to the partner's available limit.
+// It is idempotent by invoice ID.
+func (c *CreditClient) RecordPayment(ctx context.Context, partnerID, invoiceID string, amount int64) error {
+	return c.post(ctx, fmt.Sprintf("/v1/partners/%s/payments", partnerID), map[string]interface{}{
+		"invoice_id": invoiceID,
+		"amount":     amount,
+	})
+}
+
+func (c *CreditClient) post(ctx context.Context, path string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := serviceauth.Sign(req, c.service, c.secret, body); err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("credit service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return conflictError(bytes.TrimSpace(msg))
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("credit service returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+}
+
+// conflictError wraps a 409 response body in ErrConflict and, when the body carries a
+// known code, in that code's error too
+func conflictError(msg []byte) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(msg, &body); err == nil {
+		if cause, ok := conflictErrors[body.Code]; ok {
+			return fmt.Errorf("%w: %w: %s", ErrConflict, cause, msg)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrConflict, msg)
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReserveConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantErr   error
+		wantOther error
+	}{
+		{
+			name:    "insufficient limit",
+			body:    `{"error":"insufficient credit limit","code":"insufficient_credit","available":100,"requested":200}`,
+			wantErr: ErrInsufficientCredit,
+		},
+		{
+			name:      "tx_id held for another amount",
+			body:      `{"error":"reservation does not match partner or amount","code":"reservation_mismatch"}`,
+			wantErr:   ErrReservationMismatch,
+			wantOther: ErrInsufficientCredit,
+		},
+		{
+			name:      "hold released",
+			body:      `{"error":"reservation is not in a state that allows this operation","code":"invalid_reservation_state"}`,
+			wantErr:   ErrInvalidReservationState,
+			wantOther: ErrInsufficientCredit,
+		},
+		{
+			name:      "no code",
+			body:      `{"error":"conflict"}`,
+			wantErr:   ErrConflict,
+			wantOther: ErrInsufficientCredit,
+		},
+		{
+			name:      "not json",
+			body:      "conflict",
+			wantErr:   ErrConflict,
+			wantOther: ErrInsufficientCredit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			c := &CreditClient{baseURL: server.URL, service: "ppob-core", secret: "secret", http: server.Client()}
+
+			err := c.Reserve(context.Background(), "partner-1", "tx-1", 20000)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantOther != nil && errors.Is(err, tt.wantOther) {
+				t.Errorf("Reserve() error = %v, must not be %v", err, tt.wantOther)
+			}
+		})
+	}
+}
+
+func TestPinConflictIsConflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"reservation is not in a state that allows this operation","code":"invalid_reservation_state"}`))
+	}))
+	defer server.Close()
+	c := &CreditClient{baseURL: server.URL, service: "ppob-core", secret: "secret", http: server.Client()}
+
+	err := c.Pin(context.Background(), "partner-1", "tx-1")
+	if !errors.Is(err, ErrConflict) || !errors.Is(err, ErrInvalidReservationState) {
+		t.Errorf("Pin() error = %v, want %v and %v", err, ErrConflict, ErrInvalidReservationState)
+	}
+}
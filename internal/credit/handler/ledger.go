@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PaymentRequest represents an invoice payment to return to the credit limit
+type PaymentRequest struct {
+	InvoiceID string `json:"invoice_id"`
+	Amount    int64  `json:"amount"`
+}
+
+// RecordPayment returns a paid invoice amount to the partner's available limit.
+// It is idempotent by invoice_id.
+func RecordPayment(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+	var req PaymentRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.InvoiceID == "" || req.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invoice_id is required and amount must be greater than 0",
+		})
+	}
+
+	applied, replayed, err := service.RecordPayment(context.Background(), partnerID, req.InvoiceID, req.Amount)
+	if errors.Is(err, service.ErrLimitNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "limit not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error recording payment: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to record payment",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "applied",
+		"invoice_id": req.InvoiceID,
+		"applied":    applied,
+		"replayed":   replayed,
+	})
+}
+
+// GetLedger lists a partner's ledger entries newest first with running balances
+func GetLedger(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+	limit := c.QueryInt("limit", 50)
+	beforeSeq := int64(c.QueryInt("before_seq", 0))
+
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	entries, err := service.ListLedger(context.Background(), partnerID, beforeSeq, limit)
+	if err != nil {
+		log.Printf("Error listing ledger: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list ledger",
+		})
+	}
+
+	var nextBeforeSeq int64
+	if len(entries) == limit {
+		nextBeforeSeq = entries[len(entries)-1].Seq
+	}
+
+	return c.JSON(fiber.Map{
+		"partner_id":      partnerID,
+		"entries":         entries,
+		"count":           len(entries),
+		"next_before_seq": nextBeforeSeq,
+	})
+}
+
+// ReconcileLedger compares a partner's limit counters with the ledger balances
+func ReconcileLedger(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+
+	rec, err := service.Reconcile(context.Background(), partnerID)
+	if errors.Is(err, service.ErrLimitNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "limit not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error reconciling ledger: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to reconcile ledger",
+		})
+	}
+
+	return c.JSON(rec)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProposeLimitChangeRequest represents a proposed change to a partner's limit
+type ProposeLimitChangeRequest struct {
+	ChangeType string     `json:"change_type"`
+	Amount     int64      `json:"amount"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at"` // required for temporary_increase only
+}
+
+// ProposeLimitChange records a limit change that takes effect once a second admin approves it
+func ProposeLimitChange(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+	var req ProposeLimitChangeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	switch req.ChangeType {
+	case models.LimitChangeIncrease, models.LimitChangeDecrease, models.LimitChangeTemporaryIncrease:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "change_type must be increase, decrease or temporary_increase",
+		})
+	}
+
+	if req.Amount <= 0 || req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "reason is required and amount must be greater than 0",
+		})
+	}
+
+	if req.ChangeType == models.LimitChangeTemporaryIncrease {
+		if req.ExpiresAt == nil || !req.ExpiresAt.After(time.Now()) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "temporary_increase requires expires_at in the future",
+			})
+		}
+		// Stored in the process's local zone like every other timestamp
+		expiresAt := req.ExpiresAt.Local()
+		req.ExpiresAt = &expiresAt
+	} else if req.ExpiresAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_at is only allowed for temporary_increase",
+		})
+	}
+
+	change, err := service.ProposeLimitChange(context.Background(), models.CreditLimitChange{
+		PartnerID:  partnerID,
+		ChangeType: req.ChangeType,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+		ProposedBy: middleware.AdminID(c),
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		return limitChangeError(c, err, "failed to propose limit change")
+	}
+
+	log.Printf("Limit change %s proposed for partner %s by %s", change.ID, partnerID, change.ProposedBy)
+	return c.Status(fiber.StatusCreated).JSON(change)
+}
+
+// ListLimitChanges lists a partner's limit changes, optionally filtered by status
+func ListLimitChanges(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+
+	changes, err := service.ListLimitChanges(context.Background(), partnerID, c.Query("status"))
+	if err != nil {
+		log.Printf("Error listing limit changes: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list limit changes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"limit_changes": changes,
+		"count":         len(changes),
+	})
+}
+
+// ApproveLimitChange applies a pending limit change proposed by another admin
+func ApproveLimitChange(c *fiber.Ctx) error {
+	change, err := service.ApproveLimitChange(context.Background(), c.Params("change_id"), middleware.AdminID(c))
+	if err != nil {
+		return limitChangeError(c, err, "failed to approve limit change")
+	}
+
+	log.Printf("Limit change %s approved by %s", change.ID, middleware.AdminID(c))
+	return c.JSON(change)
+}
+
+// RejectLimitChange closes a pending limit change proposed by another admin
+func RejectLimitChange(c *fiber.Ctx) error {
+	change, err := service.RejectLimitChange(context.Background(), c.Params("change_id"), middleware.AdminID(c))
+	if err != nil {
+		return limitChangeError(c, err, "failed to reject limit change")
+	}
+
+	log.Printf("Limit change %s rejected by %s", change.ID, middleware.AdminID(c))
+	return c.JSON(change)
+}
+
+// limitChangeError maps limit change errors to HTTP responses
+func limitChangeError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrLimitNotFound), errors.Is(err, service.ErrLimitChangeNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrSelfApproval):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrLimitChangeNotPending), errors.Is(err, service.ErrLimitChangeExpired),
+		errors.Is(err, service.ErrDecreaseExceedsLimit):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	default:
+		log.Printf("Error handling limit change: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fallback,
+		})
+	}
+}
@@ -2,8 +2,11 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
 	"github.com/aziz46/core-e-voucher-services/pkg/models"
 	"github.com/gofiber/fiber/v2"
@@ -13,6 +16,12 @@ import (
 type ReserveRequest struct {
 	TransactionID string `json:"tx_id"`
 	Amount        int64  `json:"amount"`
+	HoldSeconds   int    `json:"hold_seconds"` // optional, defaults to the configured hold TTL
+}
+
+// CaptureRequest represents a request to capture a credit hold
+type CaptureRequest struct {
+	TransactionID string `json:"tx_id"`
 }
 
 // RestoreRequest represents a request to restore credit limit
@@ -21,12 +30,24 @@ type RestoreRequest struct {
 	Amount        int64  `json:"amount"`
 }
 
+// ReservationResponse is the result of a reserve or restore call
+type ReservationResponse struct {
+	Status            string     `json:"status"`
+	TransactionID     string     `json:"tx_id"`
+	Amount            int64      `json:"amount"`
+	ReservationStatus string     `json:"reservation_status"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	Replayed          bool       `json:"replayed"`
+}
+
 // LimitResponse represents the current credit limit
 type LimitResponse struct {
-	PartnerID      string `json:"partner_id"`
-	LimitTotal     int64  `json:"limit_total"`
-	LimitUsed      int64  `json:"limit_used"`
-	LimitAvailable int64  `json:"limit_available"`
+	PartnerID      string     `json:"partner_id"`
+	LimitTotal     int64      `json:"limit_total"`
+	LimitUsed      int64      `json:"limit_used"`
+	LimitAvailable int64      `json:"limit_available"`
+	ResetPeriod    string     `json:"reset_period"`
+	NextResetAt    *time.Time `json:"next_reset_at"`
 }
 
 // GetLimit returns the current credit limit for a partner
@@ -35,11 +56,11 @@ func GetLimit(c *fiber.Ctx) error {
 	ctx := context.Background()
 
 	row := db.Pool.QueryRow(ctx,
-		"SELECT partner_id, limit_total, limit_used, limit_available FROM credit_limits WHERE partner_id = $1",
+		"SELECT partner_id, limit_total, limit_used, limit_available, reset_period, next_reset_at FROM credit_limits WHERE partner_id = $1",
 		partnerID)
 
 	var limit models.CreditLimit
-	err := row.Scan(&limit.PartnerID, &limit.LimitTotal, &limit.LimitUsed, &limit.LimitAvailable)
+	err := row.Scan(&limit.PartnerID, &limit.LimitTotal, &limit.LimitUsed, &limit.LimitAvailable, &limit.ResetPeriod, &limit.NextResetAt)
 	if err != nil {
 		log.Printf("Error fetching limit: %v", err)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -52,10 +73,14 @@ func GetLimit(c *fiber.Ctx) error {
 		LimitTotal:     limit.LimitTotal,
 		LimitUsed:      limit.LimitUsed,
 		LimitAvailable: limit.LimitAvailable,
+		ResetPeriod:    limit.ResetPeriod,
+		NextResetAt:    limit.NextResetAt,
 	})
 }
 
-// Reserve atomically reduces the available limit
+// Reserve atomically moves the amount from the available limit into a hold
+// that is auto-released unless captured before it expires.
+// It is idempotent by tx_id: a replay returns the original reservation.
 func Reserve(c *fiber.Ctx) error {
 	partnerID := c.Params("partner_id")
 	var req ReserveRequest
@@ -66,69 +91,113 @@ func Reserve(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Amount <= 0 {
+	if req.TransactionID == "" || req.Amount <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "amount must be greater than 0",
+			"error": "tx_id is required and amount must be greater than 0",
 		})
 	}
 
-	ctx := context.Background()
-	tx, err := db.Pool.Begin(ctx)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "database error",
+	ttl := service.DefaultHoldTTL
+	if req.HoldSeconds > 0 {
+		ttl = time.Duration(req.HoldSeconds) * time.Second
+	}
+	if ttl > service.MaxHoldTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "hold_seconds exceeds maximum hold duration",
 		})
 	}
-	defer tx.Rollback(ctx)
-
-	// Use SELECT FOR UPDATE to lock the row
-	var limitAvailable int64
-	err = tx.QueryRow(ctx,
-		"SELECT limit_available FROM credit_limits WHERE partner_id = $1 FOR UPDATE",
-		partnerID).Scan(&limitAvailable)
 
+	res, replayed, err := service.Reserve(context.Background(), partnerID, req.TransactionID, req.Amount, ttl)
 	if err != nil {
-		log.Printf("Error fetching limit: %v", err)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "limit not found",
-		})
+		return reservationError(c, err, "failed to reserve limit")
 	}
 
-	// Check if enough balance
-	if limitAvailable < req.Amount {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":     "insufficient credit limit",
-			"available": limitAvailable,
-			"requested": req.Amount,
+	return c.Status(fiber.StatusOK).JSON(ReservationResponse{
+		Status:            "reserved",
+		TransactionID:     res.TxID,
+		Amount:            res.Amount,
+		ReservationStatus: res.Status,
+		ExpiresAt:         res.ExpiresAt,
+		Replayed:          replayed,
+	})
+}
+
+// Capture finalizes a hold after the provider succeeded so it no longer expires
+func Capture(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+	var req CaptureRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
 		})
 	}
 
-	// Update limit
-	_, err = tx.Exec(ctx,
-		"UPDATE credit_limits SET limit_used = limit_used + $1, limit_available = limit_available - $1 WHERE partner_id = $2",
-		req.Amount, partnerID)
+	if req.TransactionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "tx_id is required",
+		})
+	}
 
+	res, replayed, err := service.Capture(context.Background(), partnerID, req.TransactionID)
 	if err != nil {
-		log.Printf("Error updating limit: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to reserve limit",
+		return reservationError(c, err, "failed to capture hold")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ReservationResponse{
+		Status:            "captured",
+		TransactionID:     res.TxID,
+		Amount:            res.Amount,
+		ReservationStatus: res.Status,
+		Replayed:          replayed,
+	})
+}
+
+// Pin keeps a hold from expiring while the provider call it covers is unsettled
+func Pin(c *fiber.Ctx) error {
+	partnerID := c.Params("partner_id")
+	var req CaptureRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
 		})
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "transaction commit failed",
+	if req.TransactionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "tx_id is required",
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"status": "reserved",
-		"amount": req.Amount,
+	res, replayed, err := service.Pin(context.Background(), partnerID, req.TransactionID)
+	if err != nil {
+		return reservationError(c, err, "failed to pin hold")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ReservationResponse{
+		Status:            "pinned",
+		TransactionID:     res.TxID,
+		Amount:            res.Amount,
+		ReservationStatus: res.Status,
+		Replayed:          replayed,
 	})
 }
 
-// Restore returns the reserved amount back to available limit
+// Release returns a hold (or a captured reservation, as a refund) to the available limit
+func Release(c *fiber.Ctx) error {
+	return release(c, models.ReleaseReasonReleased, "released")
+}
+
+// Restore returns the reserved amount back to available limit.
+// It is kept for existing callers and behaves like Release.
 func Restore(c *fiber.Ctx) error {
+	return release(c, models.ReleaseReasonRestored, "restored")
+}
+
+// release releases a reservation. Only an existing reservation for the same
+// partner and amount can be released, once.
+func release(c *fiber.Ctx, reason, status string) error {
 	partnerID := c.Params("partner_id")
 	var req RestoreRequest
 
@@ -138,63 +207,59 @@ func Restore(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Amount <= 0 {
+	if req.TransactionID == "" || req.Amount <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "amount must be greater than 0",
+			"error": "tx_id is required and amount must be greater than 0",
 		})
 	}
 
-	ctx := context.Background()
-	tx, err := db.Pool.Begin(ctx)
+	res, replayed, err := service.Release(context.Background(), partnerID, req.TransactionID, req.Amount, reason)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "database error",
-		})
+		return reservationError(c, err, "failed to release limit")
 	}
-	defer tx.Rollback(ctx)
 
-	// Use SELECT FOR UPDATE
-	var limitUsed int64
-	err = tx.QueryRow(ctx,
-		"SELECT limit_used FROM credit_limits WHERE partner_id = $1 FOR UPDATE",
-		partnerID).Scan(&limitUsed)
+	return c.Status(fiber.StatusOK).JSON(ReservationResponse{
+		Status:            status,
+		TransactionID:     res.TxID,
+		Amount:            res.Amount,
+		ReservationStatus: res.Status,
+		Replayed:          replayed,
+	})
+}
 
-	if err != nil {
-		log.Printf("Error fetching limit: %v", err)
+// reservationError maps reservation service errors to HTTP responses
+func reservationError(c *fiber.Ctx, err error, fallback string) error {
+	var insufficient *service.InsufficientLimitError
+	switch {
+	case errors.As(err, &insufficient):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":     "insufficient credit limit",
+			"code":      models.ReservationConflictInsufficientLimit,
+			"available": insufficient.Available,
+			"requested": insufficient.Requested,
+		})
+	case errors.Is(err, service.ErrLimitNotFound):
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "limit not found",
 		})
-	}
-
-	// Check if enough used limit to restore
-	if limitUsed < req.Amount {
+	case errors.Is(err, service.ErrReservationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "reservation not found",
+		})
+	case errors.Is(err, service.ErrReservationMismatch):
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":     "insufficient used limit to restore",
-			"used":      limitUsed,
-			"requested": req.Amount,
+			"error": err.Error(),
+			"code":  models.ReservationConflictMismatch,
 		})
-	}
-
-	// Update limit
-	_, err = tx.Exec(ctx,
-		"UPDATE credit_limits SET limit_used = limit_used - $1, limit_available = limit_available + $1 WHERE partner_id = $2",
-		req.Amount, partnerID)
-
-	if err != nil {
-		log.Printf("Error updating limit: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to restore limit",
+	case errors.Is(err, service.ErrInvalidReservationOp):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+			"code":  models.ReservationConflictInvalidState,
 		})
-	}
-
-	if err = tx.Commit(ctx); err != nil {
+	default:
+		log.Printf("Error handling reservation: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "transaction commit failed",
+			"error": fallback,
 		})
 	}
-
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"status": "restored",
-		"amount": req.Amount,
-	})
 }
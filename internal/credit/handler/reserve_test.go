@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReserveValidatesRequest(t *testing.T) {
+	app := fiber.New()
+	app.Post("/limits/:partner_id/reserve", Reserve)
+	app.Post("/limits/:partner_id/release", Release)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "malformed", path: "/limits/p1/reserve", body: `{`},
+		{name: "missing tx_id", path: "/limits/p1/reserve", body: `{"amount":1000}`},
+		{name: "zero amount", path: "/limits/p1/reserve", body: `{"tx_id":"tx-1","amount":0}`},
+		{name: "hold beyond maximum", path: "/limits/p1/reserve", body: fmt.Sprintf(`{"tx_id":"tx-1","amount":1000,"hold_seconds":%d}`, int(service.MaxHoldTTL.Seconds())+1)},
+		{name: "release without amount", path: "/limits/p1/release", body: `{"tx_id":"tx-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestReservationError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "insufficient limit", err: &service.InsufficientLimitError{Available: 100, Requested: 200}, wantStatus: fiber.StatusConflict, wantCode: models.ReservationConflictInsufficientLimit},
+		{name: "wrapped insufficient limit", err: fmt.Errorf("reserve: %w", &service.InsufficientLimitError{}), wantStatus: fiber.StatusConflict, wantCode: models.ReservationConflictInsufficientLimit},
+		{name: "limit not found", err: service.ErrLimitNotFound, wantStatus: fiber.StatusNotFound},
+		{name: "reservation not found", err: service.ErrReservationNotFound, wantStatus: fiber.StatusNotFound},
+		{name: "mismatch", err: service.ErrReservationMismatch, wantStatus: fiber.StatusConflict, wantCode: models.ReservationConflictMismatch},
+		{name: "invalid state", err: service.ErrInvalidReservationOp, wantStatus: fiber.StatusConflict, wantCode: models.ReservationConflictInvalidState},
+		{name: "other", err: errors.New("connection reset"), wantStatus: fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return reservationError(c, tt.err, "failed")
+			})
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Ledger accounts
+const (
+	AccountAvailable = "available"
+	AccountHeld      = "held"
+	AccountUsed      = "used"
+	AccountLimit     = "limit"
+)
+
+// Journal entry types
+const (
+	EntryOpening    = "opening"
+	EntryReserve    = "reserve"
+	EntryCapture    = "capture"
+	EntryRelease    = "release"
+	EntryRefund     = "refund"
+	EntryPayment    = "payment"
+	EntryAdjustment = "adjustment"
+	EntryReset      = "reset"
+)
+
+// ErrUnbalancedEntry is returned when the postings of a journal entry do not sum to zero
+var ErrUnbalancedEntry = errors.New("journal entry postings do not balance")
+
+// Posting moves amount into (positive) or out of (negative) an account
+type Posting struct {
+	Account string `json:"account"`
+	Amount  int64  `json:"amount"`
+}
+
+// LedgerBalances are a partner's account balances
+type LedgerBalances struct {
+	Available int64 `json:"available"`
+	Held      int64 `json:"held"`
+	Used      int64 `json:"used"`
+	Total     int64 `json:"total"`
+}
+
+// LedgerEntry is a journal entry with the balances right after it was posted
+type LedgerEntry struct {
+	ID          string         `json:"id"`
+	Seq         int64          `json:"seq"`
+	EntryType   string         `json:"entry_type"`
+	Reference   *string        `json:"reference"`
+	Description *string        `json:"description"`
+	Postings    []Posting      `json:"postings"`
+	Balances    LedgerBalances `json:"balances"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// Reconciliation compares the credit_limits counters with the ledger
+type Reconciliation struct {
+	PartnerID string         `json:"partner_id"`
+	Ledger    LedgerBalances `json:"ledger"`
+	Counters  LedgerBalances `json:"counters"`
+	Balanced  bool           `json:"balanced"`
+}
+
+// postEntry appends a balanced journal entry. It must run in the transaction that changes the counters.
+func postEntry(ctx context.Context, tx pgx.Tx, partnerID, entryType, reference, description string, postings ...Posting) error {
+	var sum int64
+	for _, p := range postings {
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return ErrUnbalancedEntry
+	}
+
+	entryID := uuid.New().String()
+	_, err := tx.Exec(ctx,
+		`INSERT INTO credit_journal_entries (id, partner_id, entry_type, reference, description, created_at)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)`,
+		entryID, partnerID, entryType, reference, description, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	for _, p := range postings {
+		if p.Amount == 0 {
+			continue
+		}
+		_, err := tx.Exec(ctx,
+			"INSERT INTO credit_ledger_postings (entry_id, partner_id, account, amount) VALUES ($1, $2, $3, $4)",
+			entryID, partnerID, p.Account, p.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to create ledger posting: %w", err)
+		}
+	}
+	return nil
+}
+
+// transfer builds the two postings that move amount from one account to another
+func transfer(from, to string, amount int64) []Posting {
+	return []Posting{
+		{Account: from, Amount: -amount},
+		{Account: to, Amount: amount},
+	}
+}
+
+// RecordPayment returns an invoice payment from the used account to the available limit.
+// At most the currently used amount is returned. It is idempotent by invoice ID.
+func RecordPayment(ctx context.Context, partnerID, invoiceID string, amount int64) (applied int64, replayed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return 0, false, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(e.id) > 0, COALESCE(SUM(p.amount), 0)::BIGINT FROM credit_journal_entries e
+		 LEFT JOIN credit_ledger_postings p ON p.entry_id = e.id AND p.account = $4
+		 WHERE e.partner_id = $1 AND e.entry_type = $2 AND e.reference = $3`,
+		partnerID, EntryPayment, invoiceID, AccountAvailable).Scan(&exists, &applied)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to check payment: %w", err)
+	}
+	if exists {
+		return applied, true, nil
+	}
+
+	current, err := balances(ctx, tx, partnerID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	applied = amount
+	if applied > current.Used {
+		applied = current.Used
+	}
+
+	if applied > 0 {
+		_, err = tx.Exec(ctx,
+			"UPDATE credit_limits SET limit_used = limit_used - $1, limit_available = limit_available + $1, updated_at = NOW() WHERE partner_id = $2",
+			applied, partnerID)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to update limit: %w", err)
+		}
+	}
+
+	// Recorded even when nothing is applied so replays stay idempotent
+	err = postEntry(ctx, tx, partnerID, EntryPayment, invoiceID,
+		fmt.Sprintf("Invoice payment of %d", amount),
+		transfer(AccountUsed, AccountAvailable, applied)...)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("failed to commit payment: %w", err)
+	}
+	return applied, false, nil
+}
+
+// ListLedger returns a partner's journal entries newest first, with running balances.
+// beforeSeq pages backwards through history; zero starts from the latest entry.
+func ListLedger(ctx context.Context, partnerID string, beforeSeq int64, limit int) ([]LedgerEntry, error) {
+	rows, err := db.Pool.Query(ctx,
+		`WITH deltas AS (
+			SELECT e.id, e.seq, e.entry_type, e.reference, e.description, e.created_at,
+				COALESCE(SUM(p.amount) FILTER (WHERE p.account = 'available'), 0)::BIGINT AS available_delta,
+				COALESCE(SUM(p.amount) FILTER (WHERE p.account = 'held'), 0)::BIGINT AS held_delta,
+				COALESCE(SUM(p.amount) FILTER (WHERE p.account = 'used'), 0)::BIGINT AS used_delta,
+				COALESCE(SUM(p.amount) FILTER (WHERE p.account = 'limit'), 0)::BIGINT AS limit_delta
+			FROM credit_journal_entries e
+			LEFT JOIN credit_ledger_postings p ON p.entry_id = e.id
+			WHERE e.partner_id = $1
+			GROUP BY e.id, e.seq, e.entry_type, e.reference, e.description, e.created_at
+		), running AS (
+			SELECT *,
+				(SUM(available_delta) OVER w)::BIGINT AS available_balance,
+				(SUM(held_delta) OVER w)::BIGINT AS held_balance,
+				(SUM(used_delta) OVER w)::BIGINT AS used_balance,
+				(-SUM(limit_delta) OVER w)::BIGINT AS total_balance
+			FROM deltas
+			WINDOW w AS (ORDER BY seq)
+		)
+		SELECT id, seq, entry_type, reference, description, created_at,
+			available_delta, held_delta, used_delta, limit_delta,
+			available_balance, held_balance, used_balance, total_balance
+		FROM running
+		WHERE $2 = 0 OR seq < $2
+		ORDER BY seq DESC
+		LIMIT $3`,
+		partnerID, beforeSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		var availableDelta, heldDelta, usedDelta, limitDelta int64
+		err := rows.Scan(&e.ID, &e.Seq, &e.EntryType, &e.Reference, &e.Description, &e.CreatedAt,
+			&availableDelta, &heldDelta, &usedDelta, &limitDelta,
+			&e.Balances.Available, &e.Balances.Held, &e.Balances.Used, &e.Balances.Total)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		for _, p := range []Posting{
+			{Account: AccountAvailable, Amount: availableDelta},
+			{Account: AccountHeld, Amount: heldDelta},
+			{Account: AccountUsed, Amount: usedDelta},
+			{Account: AccountLimit, Amount: limitDelta},
+		} {
+			if p.Amount != 0 {
+				e.Postings = append(e.Postings, p)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Reconcile compares a partner's credit_limits counters against the ledger balances
+func Reconcile(ctx context.Context, partnerID string) (Reconciliation, error) {
+	rec := Reconciliation{PartnerID: partnerID}
+
+	var limit models.CreditLimit
+	err := db.Pool.QueryRow(ctx,
+		"SELECT limit_total, limit_used, limit_available FROM credit_limits WHERE partner_id = $1",
+		partnerID).Scan(&limit.LimitTotal, &limit.LimitUsed, &limit.LimitAvailable)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rec, ErrLimitNotFound
+	}
+	if err != nil {
+		return rec, fmt.Errorf("failed to load limit: %w", err)
+	}
+
+	rec.Ledger, err = balances(ctx, db.Pool, partnerID)
+	if err != nil {
+		return rec, err
+	}
+
+	// The counters only track held and used together
+	rec.Counters = LedgerBalances{
+		Available: limit.LimitAvailable,
+		Held:      rec.Ledger.Held,
+		Used:      limit.LimitUsed - rec.Ledger.Held,
+		Total:     limit.LimitTotal,
+	}
+	rec.Balanced = rec.Ledger == rec.Counters
+	return rec, nil
+}
+
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// balances sums a partner's postings per account
+func balances(ctx context.Context, q querier, partnerID string) (LedgerBalances, error) {
+	var b LedgerBalances
+	err := q.QueryRow(ctx,
+		`SELECT
+			COALESCE(SUM(amount) FILTER (WHERE account = 'available'), 0)::BIGINT,
+			COALESCE(SUM(amount) FILTER (WHERE account = 'held'), 0)::BIGINT,
+			COALESCE(SUM(amount) FILTER (WHERE account = 'used'), 0)::BIGINT,
+			-COALESCE(SUM(amount) FILTER (WHERE account = 'limit'), 0)::BIGINT
+		 FROM credit_ledger_postings WHERE partner_id = $1`,
+		partnerID).Scan(&b.Available, &b.Held, &b.Used, &b.Total)
+	if err != nil {
+		return b, fmt.Errorf("failed to sum ledger: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// recordingTx is a pgx.Tx that records the statements postEntry executes
+type recordingTx struct {
+	pgx.Tx
+	statements []string
+	args       [][]interface{}
+}
+
+func (tx *recordingTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	tx.statements = append(tx.statements, sql)
+	tx.args = append(tx.args, args)
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+// postings returns the account and amount of every posting insert
+func (tx *recordingTx) postings() []Posting {
+	var postings []Posting
+	for i, sql := range tx.statements {
+		if strings.Contains(sql, "credit_ledger_postings") {
+			postings = append(postings, Posting{Account: tx.args[i][2].(string), Amount: tx.args[i][3].(int64)})
+		}
+	}
+	return postings
+}
+
+func TestTransfer(t *testing.T) {
+	got := transfer(AccountAvailable, AccountHeld, 5000)
+	want := []Posting{
+		{Account: AccountAvailable, Amount: -5000},
+		{Account: AccountHeld, Amount: 5000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("transfer() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("transfer()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPostEntry(t *testing.T) {
+	tests := []struct {
+		name         string
+		postings     []Posting
+		wantErr      error
+		wantPostings []Posting
+	}{
+		{
+			name:     "transfer",
+			postings: transfer(AccountAvailable, AccountHeld, 5000),
+			wantPostings: []Posting{
+				{Account: AccountAvailable, Amount: -5000},
+				{Account: AccountHeld, Amount: 5000},
+			},
+		},
+		{
+			name: "several accounts",
+			postings: append(transfer(AccountLimit, AccountAvailable, 3000),
+				transfer(AccountUsed, AccountAvailable, 2000)...),
+			wantPostings: []Posting{
+				{Account: AccountLimit, Amount: -3000},
+				{Account: AccountAvailable, Amount: 3000},
+				{Account: AccountUsed, Amount: -2000},
+				{Account: AccountAvailable, Amount: 2000},
+			},
+		},
+		{
+			name:     "zero transfer records only the entry",
+			postings: transfer(AccountUsed, AccountAvailable, 0),
+		},
+		{
+			name:     "unbalanced",
+			postings: []Posting{{Account: AccountAvailable, Amount: -5000}, {Account: AccountHeld, Amount: 4000}},
+			wantErr:  ErrUnbalancedEntry,
+		},
+		{
+			name:     "single posting",
+			postings: []Posting{{Account: AccountAvailable, Amount: 1}},
+			wantErr:  ErrUnbalancedEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &recordingTx{}
+			err := postEntry(context.Background(), tx, "p1", EntryReserve, "tx-1", "", tt.postings...)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("postEntry() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(tx.statements) != 0 {
+					t.Errorf("unbalanced entry executed %d statements, want none", len(tx.statements))
+				}
+				return
+			}
+
+			if len(tx.statements) == 0 || !strings.Contains(tx.statements[0], "credit_journal_entries") {
+				t.Fatalf("first statement = %v, want the journal entry insert", tx.statements)
+			}
+			got := tx.postings()
+			if len(got) != len(tt.wantPostings) {
+				t.Fatalf("postings = %+v, want %+v", got, tt.wantPostings)
+			}
+			for i := range tt.wantPostings {
+				if got[i] != tt.wantPostings[i] {
+					t.Errorf("posting %d = %+v, want %+v", i, got[i], tt.wantPostings[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/audit"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Limit change errors
+var (
+	ErrLimitChangeNotFound   = errors.New("limit change not found")
+	ErrLimitChangeNotPending = errors.New("limit change is no longer pending")
+	ErrLimitChangeExpired    = errors.New("temporary limit increase has already expired")
+	ErrSelfApproval          = errors.New("a limit change must be reviewed by a different admin")
+	ErrDecreaseExceedsLimit  = errors.New("limit decrease exceeds the available limit")
+)
+
+const limitChangeResource = "credit_limit_change"
+
+// ProposeLimitChange records a pending limit change. It has no effect until another admin approves it.
+func ProposeLimitChange(ctx context.Context, change models.CreditLimitChange) (models.CreditLimitChange, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return change, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	change.ID = uuid.New().String()
+	change.Status = models.LimitChangeStatusPending
+	change.CreatedAt = time.Now()
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO credit_limit_changes (id, partner_id, change_type, amount, reason, status, proposed_by, expires_at, created_at)
+		 SELECT $1, partner_id, $3, $4, $5, $6, $7, $8, $9 FROM credit_limits WHERE partner_id = $2`,
+		change.ID, change.PartnerID, change.ChangeType, change.Amount, change.Reason,
+		change.Status, change.ProposedBy, change.ExpiresAt, change.CreatedAt)
+	if err != nil {
+		return change, fmt.Errorf("failed to create limit change: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return change, ErrLimitNotFound
+	}
+
+	if err := audit.Record(ctx, tx, limitChangeResource, change.ID, "limit_change_proposed", change); err != nil {
+		return change, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return change, fmt.Errorf("failed to commit limit change: %w", err)
+	}
+	return change, nil
+}
+
+// ApproveLimitChange applies a pending change to limit_total and limit_available
+// in the same transaction that marks it approved
+func ApproveLimitChange(ctx context.Context, changeID, adminID string) (models.CreditLimitChange, error) {
+	return reviewLimitChange(ctx, changeID, adminID, true)
+}
+
+// RejectLimitChange closes a pending change without applying it
+func RejectLimitChange(ctx context.Context, changeID, adminID string) (models.CreditLimitChange, error) {
+	return reviewLimitChange(ctx, changeID, adminID, false)
+}
+
+func reviewLimitChange(ctx context.Context, changeID, adminID string, approve bool) (models.CreditLimitChange, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return models.CreditLimitChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock order matches the rest of the service: limit first, then the change
+	var partnerID string
+	err = tx.QueryRow(ctx, "SELECT partner_id FROM credit_limit_changes WHERE id = $1", changeID).Scan(&partnerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CreditLimitChange{}, ErrLimitChangeNotFound
+	}
+	if err != nil {
+		return models.CreditLimitChange{}, fmt.Errorf("failed to load limit change: %w", err)
+	}
+
+	limitAvailable, err := lockLimit(ctx, tx, partnerID)
+	if err != nil {
+		return models.CreditLimitChange{}, err
+	}
+
+	change, err := findLimitChange(ctx, tx, changeID)
+	if err != nil {
+		return change, err
+	}
+	if change.Status != models.LimitChangeStatusPending {
+		return change, ErrLimitChangeNotPending
+	}
+	if change.ProposedBy == adminID {
+		return change, ErrSelfApproval
+	}
+
+	now := time.Now()
+	action := "limit_change_rejected"
+	change.Status = models.LimitChangeStatusRejected
+
+	if approve {
+		action = "limit_change_approved"
+		change.Status = models.LimitChangeStatusApproved
+
+		if change.ExpiresAt != nil {
+			var expired bool
+			err = tx.QueryRow(ctx, "SELECT expires_at <= $1 FROM credit_limit_changes WHERE id = $2", now, changeID).Scan(&expired)
+			if err != nil {
+				return change, fmt.Errorf("failed to check limit change expiry: %w", err)
+			}
+			if expired {
+				return change, ErrLimitChangeExpired
+			}
+		}
+
+		delta := change.Amount
+		if change.ChangeType == models.LimitChangeDecrease {
+			if limitAvailable < change.Amount {
+				return change, ErrDecreaseExceedsLimit
+			}
+			delta = -change.Amount
+		}
+		if err := adjustLimit(ctx, tx, partnerID, delta, change.ID, fmt.Sprintf("Limit %s approved by %s", change.ChangeType, adminID)); err != nil {
+			return change, err
+		}
+	}
+
+	change.ReviewedBy = &adminID
+	change.ReviewedAt = &now
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_limit_changes SET status = $1, reviewed_by = $2, reviewed_at = $3 WHERE id = $4",
+		change.Status, adminID, now, changeID)
+	if err != nil {
+		return change, fmt.Errorf("failed to update limit change: %w", err)
+	}
+
+	if err := audit.Record(ctx, tx, limitChangeResource, change.ID, action, change); err != nil {
+		return change, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return change, fmt.Errorf("failed to commit limit change: %w", err)
+	}
+	return change, nil
+}
+
+// ListLimitChanges lists a partner's limit changes newest first, optionally filtered by status
+func ListLimitChanges(ctx context.Context, partnerID, status string) ([]models.CreditLimitChange, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, partner_id, change_type, amount, reason, status, proposed_by, reviewed_by, reviewed_at, expires_at, reverted_at, created_at
+		 FROM credit_limit_changes
+		 WHERE partner_id = $1 AND ($2 = '' OR status = $2)
+		 ORDER BY created_at DESC LIMIT 200`,
+		partnerID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query limit changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []models.CreditLimitChange{}
+	for rows.Next() {
+		var ch models.CreditLimitChange
+		err := rows.Scan(&ch.ID, &ch.PartnerID, &ch.ChangeType, &ch.Amount, &ch.Reason, &ch.Status, &ch.ProposedBy,
+			&ch.ReviewedBy, &ch.ReviewedAt, &ch.ExpiresAt, &ch.RevertedAt, &ch.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan limit change: %w", err)
+		}
+		changes = append(changes, ch)
+	}
+	return changes, rows.Err()
+}
+
+// RevertExpiredIncreases reverts up to limit approved temporary increases whose expiry has passed
+// and returns how many were reverted. The available limit may go negative if the partner
+// is using more than its permanent limit; new reservations are refused until it recovers.
+func RevertExpiredIncreases(ctx context.Context, limit int) (int, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, partner_id FROM credit_limit_changes
+		 WHERE status = $1 AND change_type = $2 AND expires_at <= $3
+		 ORDER BY expires_at LIMIT $4`,
+		models.LimitChangeStatusApproved, models.LimitChangeTemporaryIncrease, time.Now(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired limit increases: %w", err)
+	}
+
+	type expired struct{ changeID, partnerID string }
+	var changes []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.changeID, &e.partnerID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired limit increase: %w", err)
+		}
+		changes = append(changes, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read expired limit increases: %w", err)
+	}
+
+	reverted := 0
+	for _, e := range changes {
+		ok, err := revertIfExpired(ctx, e.partnerID, e.changeID)
+		if err != nil {
+			log.Printf("Error reverting limit change %s: %v", e.changeID, err)
+			continue
+		}
+		if ok {
+			reverted++
+		}
+	}
+	return reverted, nil
+}
+
+// revertIfExpired reverts a single temporary increase if it is still applied and expired once locked
+func revertIfExpired(ctx context.Context, partnerID, changeID string) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return false, err
+	}
+
+	change, err := findLimitChange(ctx, tx, changeID)
+	if err != nil {
+		return false, err
+	}
+	if change.Status != models.LimitChangeStatusApproved {
+		return false, nil
+	}
+
+	now := time.Now()
+	var expired bool
+	err = tx.QueryRow(ctx, "SELECT expires_at <= $1 FROM credit_limit_changes WHERE id = $2", now, changeID).Scan(&expired)
+	if err != nil {
+		return false, fmt.Errorf("failed to check limit change expiry: %w", err)
+	}
+	if !expired {
+		return false, nil
+	}
+
+	if err := adjustLimit(ctx, tx, partnerID, -change.Amount, change.ID, "Temporary limit increase expired"); err != nil {
+		return false, err
+	}
+
+	change.Status = models.LimitChangeStatusReverted
+	change.RevertedAt = &now
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_limit_changes SET status = $1, reverted_at = $2 WHERE id = $3",
+		change.Status, now, changeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update limit change: %w", err)
+	}
+
+	if err := audit.Record(ctx, tx, limitChangeResource, change.ID, "limit_change_reverted", change); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit limit revert: %w", err)
+	}
+	return true, nil
+}
+
+// adjustLimit changes limit_total and limit_available by delta and posts the matching adjustment entry
+func adjustLimit(ctx context.Context, tx pgx.Tx, partnerID string, delta int64, reference, description string) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE credit_limits
+		 SET limit_total = limit_total + $1, limit_available = limit_available + $1, updated_at = NOW()
+		 WHERE partner_id = $2`,
+		delta, partnerID)
+	if err != nil {
+		return fmt.Errorf("failed to adjust limit: %w", err)
+	}
+	return postEntry(ctx, tx, partnerID, EntryAdjustment, reference, description,
+		transfer(AccountLimit, AccountAvailable, delta)...)
+}
+
+// findLimitChange loads and locks a limit change by ID
+func findLimitChange(ctx context.Context, tx pgx.Tx, changeID string) (models.CreditLimitChange, error) {
+	var ch models.CreditLimitChange
+	err := tx.QueryRow(ctx,
+		`SELECT id, partner_id, change_type, amount, reason, status, proposed_by, reviewed_by, reviewed_at, expires_at, reverted_at, created_at
+		 FROM credit_limit_changes WHERE id = $1 FOR UPDATE`,
+		changeID).Scan(&ch.ID, &ch.PartnerID, &ch.ChangeType, &ch.Amount, &ch.Reason, &ch.Status, &ch.ProposedBy,
+		&ch.ReviewedBy, &ch.ReviewedAt, &ch.ExpiresAt, &ch.RevertedAt, &ch.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ch, ErrLimitChangeNotFound
+	}
+	if err != nil {
+		return ch, fmt.Errorf("failed to load limit change: %w", err)
+	}
+	return ch, nil
+}
@@ -0,0 +1,483 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Hold TTL bounds, overridable from configuration at startup
+var (
+	DefaultHoldTTL = 10 * time.Minute
+	MaxHoldTTL     = time.Hour
+)
+
+// Reservation errors
+var (
+	ErrLimitNotFound        = errors.New("limit not found")
+	ErrReservationNotFound  = errors.New("reservation not found")
+	ErrReservationMismatch  = errors.New("reservation does not match partner or amount")
+	ErrInvalidReservationOp = errors.New("reservation is not in a state that allows this operation")
+)
+
+// InsufficientLimitError is returned when the available limit cannot cover a reservation
+type InsufficientLimitError struct {
+	Available int64
+	Requested int64
+}
+
+func (e *InsufficientLimitError) Error() string {
+	return fmt.Sprintf("insufficient credit limit: available %d, requested %d", e.Available, e.Requested)
+}
+
+// Reserve atomically moves amount from the partner's available limit into a hold for txID
+// that expires after ttl unless captured.
+// Replaying a reserve for the same partner and amount returns the existing reservation
+// with replayed set, without touching the limit again, while it is still reserved or captured.
+// A released or expired reservation cannot be replayed, since its hold is no longer taken.
+func Reserve(ctx context.Context, partnerID, txID string, amount int64, ttl time.Duration) (res models.CreditReservation, replayed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return res, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the partner's limit first so all reservation changes for a partner are serialized
+	limitAvailable, err := lockLimit(ctx, tx, partnerID)
+	if err != nil {
+		return res, false, err
+	}
+
+	existing, err := findReservation(ctx, tx, txID)
+	if err == nil {
+		if existing.PartnerID != partnerID || existing.Amount != amount {
+			return res, false, ErrReservationMismatch
+		}
+		if existing.Status != models.ReservationStatusReserved && existing.Status != models.ReservationStatusCaptured {
+			return res, false, ErrInvalidReservationOp
+		}
+		return existing, true, nil
+	}
+	if !errors.Is(err, ErrReservationNotFound) {
+		return res, false, err
+	}
+
+	if limitAvailable < amount {
+		return res, false, &InsufficientLimitError{Available: limitAvailable, Requested: amount}
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_limits SET limit_used = limit_used + $1, limit_available = limit_available - $1, updated_at = NOW() WHERE partner_id = $2",
+		amount, partnerID)
+	if err != nil {
+		return res, false, fmt.Errorf("failed to update limit: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	res = models.CreditReservation{
+		TxID:      txID,
+		PartnerID: partnerID,
+		Amount:    amount,
+		Status:    models.ReservationStatusReserved,
+		ExpiresAt: &expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO credit_reservations (tx_id, partner_id, amount, status, expires_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		res.TxID, res.PartnerID, res.Amount, res.Status, res.ExpiresAt, res.CreatedAt, res.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// Reserved concurrently for another partner
+		return models.CreditReservation{}, false, ErrReservationMismatch
+	}
+	if err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	err = postEntry(ctx, tx, partnerID, EntryReserve, txID, "",
+		transfer(AccountAvailable, AccountHeld, amount)...)
+	if err != nil {
+		return models.CreditReservation{}, false, err
+	}
+
+	err = outbox.Add(ctx, tx, "credit_reservation", txID, eventbus.CreditReserved, eventbus.CreditEvent{
+		PartnerID: partnerID,
+		TxID:      txID,
+		Amount:    amount,
+	})
+	if err != nil {
+		return models.CreditReservation{}, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	return res, false, nil
+}
+
+// Capture finalizes a hold once the provider has succeeded, so it no longer expires.
+// Capturing an already captured reservation returns it with replayed set.
+func Capture(ctx context.Context, partnerID, txID string) (res models.CreditReservation, replayed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return res, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return res, false, err
+	}
+
+	res, err = findReservation(ctx, tx, txID)
+	if err != nil {
+		return res, false, err
+	}
+	if res.PartnerID != partnerID {
+		return models.CreditReservation{}, false, ErrReservationMismatch
+	}
+
+	switch res.Status {
+	case models.ReservationStatusCaptured:
+		return res, true, nil
+	case models.ReservationStatusReserved:
+	default:
+		return res, false, ErrInvalidReservationOp
+	}
+
+	now := time.Now()
+	res.Status = models.ReservationStatusCaptured
+	res.CapturedAt = &now
+	res.UpdatedAt = now
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_reservations SET status = $1, captured_at = $2, updated_at = $2 WHERE tx_id = $3",
+		res.Status, now, res.TxID)
+	if err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to capture reservation: %w", err)
+	}
+
+	err = postEntry(ctx, tx, partnerID, EntryCapture, txID, "",
+		transfer(AccountHeld, AccountUsed, res.Amount)...)
+	if err != nil {
+		return models.CreditReservation{}, false, err
+	}
+
+	err = outbox.Add(ctx, tx, "credit_reservation", txID, eventbus.CreditCaptured, eventbus.CreditEvent{
+		PartnerID: partnerID,
+		TxID:      txID,
+		Amount:    res.Amount,
+	})
+	if err != nil {
+		return models.CreditReservation{}, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to commit capture: %w", err)
+	}
+	return res, false, nil
+}
+
+// Pin stops an open hold from expiring while the provider may still take the payment; it is
+// then only captured or released. Pinning a pinned or captured reservation returns it with
+// replayed set, and a released one fails with ErrInvalidReservationOp.
+func Pin(ctx context.Context, partnerID, txID string) (res models.CreditReservation, replayed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return res, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return res, false, err
+	}
+
+	res, err = findReservation(ctx, tx, txID)
+	if err != nil {
+		return res, false, err
+	}
+	if res.PartnerID != partnerID {
+		return models.CreditReservation{}, false, ErrReservationMismatch
+	}
+
+	switch {
+	case res.Status == models.ReservationStatusCaptured:
+		return res, true, nil
+	case res.Status == models.ReservationStatusReserved && res.ExpiresAt == nil:
+		return res, true, nil
+	case res.Status != models.ReservationStatusReserved:
+		return res, false, ErrInvalidReservationOp
+	}
+
+	// A hold past its TTL that the sweeper has not reached yet is still held, so it can be pinned
+	now := time.Now()
+	res.ExpiresAt = nil
+	res.UpdatedAt = now
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_reservations SET expires_at = NULL, updated_at = $1 WHERE tx_id = $2",
+		now, res.TxID)
+	if err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to pin reservation: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to commit pin: %w", err)
+	}
+	return res, false, nil
+}
+
+// Release returns a reservation's amount to the partner's available limit.
+// Both open holds and captured reservations (refunds) can be released.
+// The reservation must exist for the same partner and amount; releasing an
+// already released reservation returns it with replayed set.
+func Release(ctx context.Context, partnerID, txID string, amount int64, reason string) (res models.CreditReservation, replayed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return res, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return res, false, err
+	}
+
+	res, err = findReservation(ctx, tx, txID)
+	if err != nil {
+		return res, false, err
+	}
+	if res.PartnerID != partnerID || res.Amount != amount {
+		return models.CreditReservation{}, false, ErrReservationMismatch
+	}
+
+	switch res.Status {
+	case models.ReservationStatusReleased:
+		return res, true, nil
+	case models.ReservationStatusReserved, models.ReservationStatusCaptured:
+	default:
+		return res, false, ErrInvalidReservationOp
+	}
+
+	if err := releaseLocked(ctx, tx, &res, reason); err != nil {
+		return models.CreditReservation{}, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.CreditReservation{}, false, fmt.Errorf("failed to commit release: %w", err)
+	}
+	return res, false, nil
+}
+
+// ReleaseExpired releases up to limit holds whose TTL has passed and returns how many were released
+func ReleaseExpired(ctx context.Context, limit int) (int, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tx_id, partner_id FROM credit_reservations
+		 WHERE status = $1 AND expires_at < $2
+		 ORDER BY expires_at LIMIT $3`,
+		models.ReservationStatusReserved, time.Now(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired holds: %w", err)
+	}
+
+	type hold struct{ txID, partnerID string }
+	var holds []hold
+	for rows.Next() {
+		var h hold
+		if err := rows.Scan(&h.txID, &h.partnerID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired hold: %w", err)
+		}
+		holds = append(holds, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read expired holds: %w", err)
+	}
+
+	released := 0
+	for _, h := range holds {
+		ok, err := releaseIfExpired(ctx, h.partnerID, h.txID)
+		if err != nil {
+			log.Printf("Error releasing expired hold %s: %v", h.txID, err)
+			continue
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// releaseIfExpired releases a single hold if it is still open and expired once locked
+func releaseIfExpired(ctx context.Context, partnerID, txID string) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return false, err
+	}
+
+	res, err := findReservation(ctx, tx, txID)
+	if err != nil {
+		return false, err
+	}
+
+	// Compare in SQL: timestamps are stored as local wall-clock time without a zone
+	var expired bool
+	err = tx.QueryRow(ctx,
+		"SELECT expires_at IS NOT NULL AND expires_at < $1 FROM credit_reservations WHERE tx_id = $2",
+		time.Now(), txID).Scan(&expired)
+	if err != nil {
+		return false, fmt.Errorf("failed to check hold expiry: %w", err)
+	}
+	if !expired {
+		return false, nil
+	}
+
+	// Captured or released by another caller after the sweep query ran
+	if res.Status != models.ReservationStatusReserved {
+		return false, nil
+	}
+
+	if err := releaseLocked(ctx, tx, &res, models.ReleaseReasonExpired); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit expiry release: %w", err)
+	}
+	return true, nil
+}
+
+// releaseLocked returns a locked reservation's amount to the limit and marks it released.
+// Open holds come back from the held account, captured reservations from used, as far as
+// their usage is still outstanding.
+func releaseLocked(ctx context.Context, tx pgx.Tx, res *models.CreditReservation, reason string) error {
+	entryType, from := EntryRelease, AccountHeld
+	if res.Status == models.ReservationStatusCaptured {
+		entryType, from = EntryRefund, AccountUsed
+	}
+
+	amount, err := restorable(ctx, tx, res)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_limits SET limit_used = limit_used - $1, limit_available = limit_available + $1, updated_at = NOW() WHERE partner_id = $2",
+		amount, res.PartnerID)
+	if err != nil {
+		return fmt.Errorf("failed to update limit: %w", err)
+	}
+
+	now := time.Now()
+	res.Status = models.ReservationStatusReleased
+	res.ReleasedAt = &now
+	res.ReleaseReason = &reason
+	res.UpdatedAt = now
+	_, err = tx.Exec(ctx,
+		"UPDATE credit_reservations SET status = $1, released_at = $2, release_reason = $3, updated_at = $2 WHERE tx_id = $4",
+		res.Status, now, reason, res.TxID)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation: %w", err)
+	}
+
+	// Recorded even when nothing is restored, so that the release is not repeated
+	err = postEntry(ctx, tx, res.PartnerID, entryType, res.TxID, reason,
+		transfer(from, AccountAvailable, amount)...)
+	if err != nil {
+		return err
+	}
+
+	return outbox.Add(ctx, tx, "credit_reservation", res.TxID, eventbus.CreditRestored, eventbus.CreditEvent{
+		PartnerID: res.PartnerID,
+		TxID:      res.TxID,
+		Amount:    amount,
+		Reason:    reason,
+	})
+}
+
+// restorable returns how much of a reservation releasing it gives back, never more than the
+// partner's balance of the account it comes from. The usage of a captured reservation is
+// already freed once an invoice covering the transaction was paid, or once a limit reset
+// released it without carrying it over as unpaid; billing records such refunds as due.
+func restorable(ctx context.Context, tx pgx.Tx, res *models.CreditReservation) (int64, error) {
+	current, err := balances(ctx, tx, res.PartnerID)
+	if err != nil {
+		return 0, err
+	}
+	if res.Status != models.ReservationStatusCaptured {
+		if res.Amount > current.Held {
+			return current.Held, nil
+		}
+		return res.Amount, nil
+	}
+
+	var freed bool
+	err = tx.QueryRow(ctx,
+		`WITH inv AS (
+		   SELECT i.status FROM invoices i JOIN transactions t ON t.id = $1
+		   WHERE i.partner_id = $2 AND i.status IN ($3, $4, $5)
+		     AND t.created_at BETWEEN i.period_start AND i.period_end
+		 )
+		 SELECT EXISTS (SELECT 1 FROM inv WHERE status = $3)
+		     OR EXISTS (SELECT 1 FROM credit_limits l
+		                WHERE l.partner_id = $2 AND l.last_reset_at > $6
+		                  AND NOT (l.carry_over_unpaid AND EXISTS (SELECT 1 FROM inv WHERE status <> $3)))`,
+		res.TxID, res.PartnerID, models.InvoicStatusPaid, models.InvoiceStatusIssued, models.InvoiceStatusOverdue,
+		res.CapturedAt).Scan(&freed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check outstanding usage: %w", err)
+	}
+	if freed || current.Used <= 0 {
+		return 0, nil
+	}
+	if res.Amount > current.Used {
+		return current.Used, nil
+	}
+	return res.Amount, nil
+}
+
+// lockLimit locks the partner's credit_limits row and returns its available limit
+func lockLimit(ctx context.Context, tx pgx.Tx, partnerID string) (int64, error) {
+	var limitAvailable int64
+	err := tx.QueryRow(ctx,
+		"SELECT limit_available FROM credit_limits WHERE partner_id = $1 FOR UPDATE",
+		partnerID).Scan(&limitAvailable)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrLimitNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock limit: %w", err)
+	}
+	return limitAvailable, nil
+}
+
+// findReservation loads and locks a reservation by transaction ID
+func findReservation(ctx context.Context, tx pgx.Tx, txID string) (models.CreditReservation, error) {
+	var res models.CreditReservation
+	err := tx.QueryRow(ctx,
+		`SELECT tx_id, partner_id, amount, status, expires_at, captured_at, released_at, release_reason, created_at, updated_at
+		 FROM credit_reservations WHERE tx_id = $1 FOR UPDATE`,
+		txID).Scan(&res.TxID, &res.PartnerID, &res.Amount, &res.Status, &res.ExpiresAt,
+		&res.CapturedAt, &res.ReleasedAt, &res.ReleaseReason, &res.CreatedAt, &res.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, ErrReservationNotFound
+	}
+	if err != nil {
+		return res, fmt.Errorf("failed to load reservation: %w", err)
+	}
+	return res, nil
+}
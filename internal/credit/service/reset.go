@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/audit"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrUnknownResetPeriod is returned for a reset_period other than daily, weekly or monthly
+var ErrUnknownResetPeriod = errors.New("unknown reset period")
+
+// LimitReset describes one applied limit reset
+type LimitReset struct {
+	ResetPeriod string    `json:"reset_period"`
+	UsedBefore  int64     `json:"used_before"`
+	Released    int64     `json:"released"`
+	CarriedOver int64     `json:"carried_over"`
+	NextResetAt time.Time `json:"next_reset_at"`
+}
+
+// NextResetBoundary returns the first period boundary strictly after t in loc:
+// midnight for daily, Monday midnight for weekly and the first of the month for monthly
+func NextResetBoundary(period string, t time.Time, loc *time.Location) (time.Time, error) {
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch period {
+	case models.ResetPeriodDaily:
+		return midnight.AddDate(0, 0, 1), nil
+	case models.ResetPeriodWeekly:
+		days := (int(time.Monday) - int(t.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return midnight.AddDate(0, 0, days), nil
+	case models.ResetPeriodMonthly:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc), nil
+	default:
+		return time.Time{}, ErrUnknownResetPeriod
+	}
+}
+
+// ResetDue resets the usage of up to limit partners whose period boundary has passed
+// and returns how many were reset. Partners that were never scheduled only get their
+// next boundary set. Each partner is re-checked under its row lock, so several replicas
+// can run this concurrently without resetting a partner twice.
+func ResetDue(ctx context.Context, loc *time.Location, limit int) (int, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT partner_id FROM credit_limits
+		 WHERE next_reset_at IS NULL OR next_reset_at <= $1
+		 ORDER BY next_reset_at NULLS FIRST LIMIT $2`,
+		time.Now(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query due limits: %w", err)
+	}
+
+	var partnerIDs []string
+	for rows.Next() {
+		var partnerID string
+		if err := rows.Scan(&partnerID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan due limit: %w", err)
+		}
+		partnerIDs = append(partnerIDs, partnerID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read due limits: %w", err)
+	}
+
+	reset := 0
+	for _, partnerID := range partnerIDs {
+		ok, err := resetIfDue(ctx, partnerID, loc)
+		if err != nil {
+			log.Printf("Error resetting limit for partner %s: %v", partnerID, err)
+			continue
+		}
+		if ok {
+			reset++
+		}
+	}
+	return reset, nil
+}
+
+// resetIfDue resets a single partner's usage if its boundary has still passed once locked
+func resetIfDue(ctx context.Context, partnerID string, loc *time.Location) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockLimit(ctx, tx, partnerID); err != nil {
+		return false, err
+	}
+
+	// Compare in SQL: timestamps are stored as local wall-clock time without a zone
+	now := time.Now()
+	var period string
+	var carryOver, scheduled, due bool
+	err = tx.QueryRow(ctx,
+		`SELECT reset_period, carry_over_unpaid, next_reset_at IS NOT NULL, COALESCE(next_reset_at <= $1, false)
+		 FROM credit_limits WHERE partner_id = $2`,
+		now, partnerID).Scan(&period, &carryOver, &scheduled, &due)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrLimitNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load reset schedule: %w", err)
+	}
+	if scheduled && !due {
+		return false, nil
+	}
+
+	next, err := NextResetBoundary(period, now, loc)
+	if err != nil {
+		return false, err
+	}
+	// Stored in the process's local zone like every other timestamp
+	next = next.Local()
+
+	if !scheduled {
+		_, err = tx.Exec(ctx,
+			"UPDATE credit_limits SET next_reset_at = $1 WHERE partner_id = $2",
+			next, partnerID)
+		if err != nil {
+			return false, fmt.Errorf("failed to schedule reset: %w", err)
+		}
+		return false, tx.Commit(ctx)
+	}
+
+	current, err := balances(ctx, tx, partnerID)
+	if err != nil {
+		return false, err
+	}
+
+	reset := LimitReset{ResetPeriod: period, UsedBefore: current.Used, NextResetAt: next}
+	if carryOver {
+		unpaid, err := unpaidInvoiceAmount(ctx, tx, partnerID)
+		if err != nil {
+			return false, err
+		}
+		reset.CarriedOver = unpaid
+		if reset.CarriedOver > current.Used {
+			reset.CarriedOver = current.Used
+		}
+	}
+	// Open holds belong to in-flight transactions and survive the reset
+	reset.Released = current.Used - reset.CarriedOver
+
+	_, err = tx.Exec(ctx,
+		`UPDATE credit_limits
+		 SET limit_used = limit_used - $1, limit_available = limit_available + $1,
+		     last_reset_at = $2, next_reset_at = $3, updated_at = NOW()
+		 WHERE partner_id = $4`,
+		reset.Released, now, next, partnerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset limit: %w", err)
+	}
+
+	if reset.Released > 0 {
+		err = postEntry(ctx, tx, partnerID, EntryReset, now.In(loc).Format("2006-01-02"),
+			fmt.Sprintf("%s limit reset", period),
+			transfer(AccountUsed, AccountAvailable, reset.Released)...)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := audit.Record(ctx, tx, "credit_limit", partnerID, "limit_reset", reset); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit reset: %w", err)
+	}
+	return true, nil
+}
+
+// unpaidInvoiceAmount sums what a partner still owes on issued and overdue invoices
+func unpaidInvoiceAmount(ctx context.Context, q querier, partnerID string) (int64, error) {
+	var amount int64
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount_due), 0)::BIGINT FROM invoices
+		 WHERE partner_id = $1 AND status IN ($2, $3)`,
+		partnerID, models.InvoiceStatusIssued, models.InvoiceStatusOverdue).Scan(&amount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum unpaid invoices: %w", err)
+	}
+	return amount, nil
+}
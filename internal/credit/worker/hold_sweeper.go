@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+)
+
+// RunHoldSweeper releases expired credit holds every interval until ctx is cancelled.
+// Several replicas may run it at once: each hold is re-checked under its row lock before release.
+func RunHoldSweeper(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Drain in batches so a backlog does not wait for further ticks
+		for {
+			released, err := service.ReleaseExpired(ctx, batchSize)
+			if err != nil {
+				log.Printf("Error sweeping expired holds: %v", err)
+				break
+			}
+			if released > 0 {
+				log.Printf("Released %d expired credit holds", released)
+			}
+			if released < batchSize {
+				break
+			}
+		}
+	}
+}
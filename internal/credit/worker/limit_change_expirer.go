@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+)
+
+// RunLimitChangeExpirer reverts expired temporary limit increases every interval until ctx is cancelled
+func RunLimitChangeExpirer(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			reverted, err := service.RevertExpiredIncreases(ctx, batchSize)
+			if err != nil {
+				log.Printf("Error reverting expired limit increases: %v", err)
+				break
+			}
+			if reverted > 0 {
+				log.Printf("Reverted %d expired temporary limit increases", reverted)
+			}
+			if reverted < batchSize {
+				break
+			}
+		}
+	}
+}
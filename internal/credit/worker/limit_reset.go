@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/credit/service"
+)
+
+// RunLimitResetScheduler resets partner usage at each reset_period boundary in loc,
+// checking every interval until ctx is cancelled. It is safe to run on several replicas.
+func RunLimitResetScheduler(ctx context.Context, loc *time.Location, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			reset, err := service.ResetDue(ctx, loc, batchSize)
+			if err != nil {
+				log.Printf("Error resetting credit limits: %v", err)
+				break
+			}
+			if reset > 0 {
+				log.Printf("Reset %d credit limits", reset)
+			}
+			if reset < batchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Catalog errors
+var (
+	ErrProductNotFound  = errors.New("product not found")
+	ErrProductInactive  = errors.New("product is not active")
+	ErrProductNotPriced = errors.New("product is not available for this tenant")
+	ErrAmountMismatch   = errors.New("amount does not match product price")
+	ErrAmountRequired   = errors.New("amount must be greater than 0")
+	ErrInquiryRequired  = errors.New("bill products must be paid with an inquiry_id")
+)
+
+// Categories lists the product categories the catalog accepts
+var Categories = map[string]bool{
+	models.ProductCategoryPulsa:       true,
+	models.ProductCategoryData:        true,
+	models.ProductCategoryPLNPrepaid:  true,
+	models.ProductCategoryPLNPostpaid: true,
+	models.ProductCategoryBPJS:        true,
+	models.ProductCategoryPDAM:        true,
+	models.ProductCategoryEWallet:     true,
+	models.ProductCategoryGameVoucher: true,
+	models.ProductCategoryGiftCard:    true,
+}
+
+// Entry is an active product together with the price that applies to a partner
+type Entry struct {
+	Product models.Product
+	Price   models.TenantProductPrice
+}
+
+// Lookup returns the product and the partner's price, falling back to the tenant default.
+// An empty partnerID only considers the tenant default.
+func Lookup(ctx context.Context, tenantID, partnerID, productCode string) (Entry, error) {
+	var e Entry
+
+	p, err := GetProduct(ctx, productCode)
+	if err != nil {
+		return e, err
+	}
+	if !p.Active {
+		return e, ErrProductInactive
+	}
+	e.Product = p
+
+	err = db.Pool.QueryRow(ctx,
+		`SELECT id, tenant_id, partner_id, product_code, selling_price, fee, active, created_at, updated_at
+		 FROM tenant_product_prices
+		 WHERE tenant_id = $1 AND product_code = $2 AND active = true AND (partner_id IS NULL OR partner_id = $3)
+		 ORDER BY partner_id NULLS LAST LIMIT 1`,
+		tenantID, productCode, partnerID).Scan(&e.Price.ID, &e.Price.TenantID, &e.Price.PartnerID, &e.Price.ProductCode,
+		&e.Price.SellingPrice, &e.Price.Fee, &e.Price.Active, &e.Price.CreatedAt, &e.Price.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e, ErrProductNotPriced
+	}
+	if err != nil {
+		return e, fmt.Errorf("failed to load product price: %w", err)
+	}
+	return e, nil
+}
+
+// GetProduct loads a product by code, active or not
+func GetProduct(ctx context.Context, code string) (models.Product, error) {
+	var p models.Product
+	err := db.Pool.QueryRow(ctx,
+		`SELECT code, name, category, denomination, base_cost, cancel_window, active, created_at, updated_at
+		 FROM products WHERE code = $1`,
+		code).Scan(&p.Code, &p.Name, &p.Category, &p.Denomination, &p.BaseCost, &p.CancelWindow, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, ErrProductNotFound
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to load product: %w", err)
+	}
+	return p, nil
+}
+
+// Bill reports whether the product is a bill, whose amount is set by the provider's inquiry
+func (e Entry) Bill() bool {
+	return e.Product.Denomination == nil
+}
+
+// FixedAmount is the price of a fixed-denomination product, or 0 for bills
+func (e Entry) FixedAmount() int64 {
+	if e.Bill() {
+		return 0
+	}
+	if e.Price.SellingPrice != nil {
+		return *e.Price.SellingPrice
+	}
+	return *e.Product.Denomination
+}
+
+// Amount resolves the transaction amount. Fixed-denomination products are sold at their
+// price and requested may be zero or equal to it. Bills are only paid at the amount their
+// inquiry quoted, so a requested amount is never accepted for them.
+func (e Entry) Amount(requested int64) (int64, error) {
+	if e.Bill() {
+		return 0, ErrInquiryRequired
+	}
+	fixed := e.FixedAmount()
+	if requested != 0 && requested != fixed {
+		return 0, ErrAmountMismatch
+	}
+	return fixed, nil
+}
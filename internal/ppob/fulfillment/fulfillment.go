@@ -0,0 +1,75 @@
+package fulfillment
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/secret"
+)
+
+// Box encrypts the sensitive fields of fulfillments, set from configuration at startup
+var Box *secret.Box
+
+// sensitive holds the fulfillment fields stored in fulfillment_encrypted
+type sensitive struct {
+	Token string `json:"token,omitempty"`
+}
+
+// Seal splits a fulfillment into the JSON of its plain fields, for fulfillment_json, and the
+// ciphertext of its sensitive ones, for fulfillment_encrypted. Either is nil when there is
+// nothing to store. Sensitive fields are never stored in the clear nor dropped: without an
+// encryption key sealing fails, and so does the write of the transaction.
+func Seal(f *connector.Fulfillment) (*string, *string, error) {
+	if f == nil {
+		return nil, nil, nil
+	}
+	plain := *f
+	secrets := sensitive{Token: plain.Token}
+	plain.Token = ""
+
+	body, err := json.Marshal(plain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode fulfillment: %w", err)
+	}
+	plainJSON := string(body)
+	if secrets == (sensitive{}) {
+		return &plainJSON, nil, nil
+	}
+
+	body, err = json.Marshal(secrets)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode fulfillment: %w", err)
+	}
+	encrypted, err := Box.Encrypt(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt fulfillment: %w", err)
+	}
+	return &plainJSON, &encrypted, nil
+}
+
+// Open reassembles a fulfillment stored by Seal, or returns nil when none was stored. When
+// the sensitive fields cannot be decrypted the plain ones are returned with the error.
+func Open(plainJSON, encrypted *string) (*connector.Fulfillment, error) {
+	if plainJSON == nil {
+		return nil, nil
+	}
+	var f connector.Fulfillment
+	if err := json.Unmarshal([]byte(*plainJSON), &f); err != nil {
+		return nil, fmt.Errorf("invalid fulfillment: %w", err)
+	}
+	if encrypted == nil {
+		return &f, nil
+	}
+
+	body, err := Box.Decrypt(*encrypted)
+	if err != nil {
+		return &f, fmt.Errorf("failed to decrypt fulfillment: %w", err)
+	}
+	var secrets sensitive
+	if err := json.Unmarshal(body, &secrets); err != nil {
+		return &f, fmt.Errorf("invalid encrypted fulfillment: %w", err)
+	}
+	f.Token = secrets.Token
+	return &f, nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix marks tenant API keys so leaked keys are easy to recognise
+const apiKeyPrefix = "sk_live_"
+
+// knownScopes lists the scopes that can be granted to an API key
+var knownScopes = map[string]bool{
+	models.ScopeAll:               true,
+	models.ScopeTransactionsRead:  true,
+	models.ScopeTransactionsWrite: true,
+	models.ScopeInvoicesRead:      true,
+	models.ScopeInvoicesWrite:     true,
+}
+
+// IssueAPIKeyRequest is the request to issue a tenant API key
+type IssueAPIKeyRequest struct {
+	Label     string     `json:"label"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// IssueAPIKeyResponse contains the plaintext key, which is only ever returned here
+type IssueAPIKeyResponse struct {
+	models.TenantAPIKey
+	APIKey string `json:"api_key"`
+}
+
+// IssueAPIKey issues a new API key for a tenant
+func IssueAPIKey(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req IssueAPIKeyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.Label == "" || len(req.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "label and scopes are required",
+		})
+	}
+
+	for _, scope := range req.Scopes {
+		if !knownScopes[scope] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unknown scope " + scope,
+			})
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("Error generating API key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate API key",
+		})
+	}
+	apiKey := apiKeyPrefix + hex.EncodeToString(secret)
+
+	key := models.TenantAPIKey{
+		ID:        uuid.New().String(),
+		TenantID:  tenantID,
+		Label:     req.Label,
+		KeyPrefix: apiKey[:len(apiKeyPrefix)+4],
+		KeyHash:   middleware.HashAPIKey(apiKey),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	ctx := context.Background()
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO tenant_api_keys (id, tenant_id, label, key_prefix, key_hash, scopes, expires_at, created_at)
+		 SELECT $1, id, $3, $4, $5, $6, $7, $8 FROM tenants WHERE id = $2`,
+		key.ID, key.TenantID, key.Label, key.KeyPrefix, key.KeyHash, key.Scopes, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		log.Printf("Error issuing API key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to issue API key",
+		})
+	}
+
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tenant not found",
+		})
+	}
+
+	log.Printf("API key %s issued for tenant %s by %s", key.ID, tenantID, middleware.AdminID(c))
+
+	return c.Status(fiber.StatusCreated).JSON(IssueAPIKeyResponse{
+		TenantAPIKey: key,
+		APIKey:       apiKey,
+	})
+}
+
+// ListAPIKeys lists a tenant's API keys without their secrets
+func ListAPIKeys(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, tenant_id, label, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		 FROM tenant_api_keys WHERE tenant_id = $1 ORDER BY created_at DESC`,
+		tenantID)
+	if err != nil {
+		log.Printf("Error querying API keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list API keys",
+		})
+	}
+	defer rows.Close()
+
+	keys := []models.TenantAPIKey{}
+	for rows.Next() {
+		var key models.TenantAPIKey
+		err := rows.Scan(&key.ID, &key.TenantID, &key.Label, &key.KeyPrefix, &key.Scopes,
+			&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning API key: %v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// RevokeAPIKey revokes a tenant API key
+func RevokeAPIKey(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	keyID := c.Params("key_id")
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx,
+		"UPDATE tenant_api_keys SET revoked_at = $1 WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL",
+		time.Now(), keyID, tenantID)
+	if err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revoke API key",
+		})
+	}
+
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	middleware.EvictAPIKey(keyID)
+	log.Printf("API key %s revoked for tenant %s by %s", keyID, tenantID, middleware.AdminID(c))
+
+	return c.JSON(fiber.Map{
+		"status": "revoked",
+		"id":     keyID,
+	})
+}
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/pricing"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// FeeRuleRequest creates or replaces a fee rule. The scope (partner_id, product_code
+// and category) is only read on create.
+type FeeRuleRequest struct {
+	PartnerID   *string          `json:"partner_id"`
+	ProductCode *string          `json:"product_code"`
+	Category    *string          `json:"category"`
+	RuleType    string           `json:"rule_type"`
+	FlatFee     int64            `json:"flat_fee"`
+	PercentBps  int              `json:"percent_bps"`
+	MinFee      *int64           `json:"min_fee"`
+	MaxFee      *int64           `json:"max_fee"`
+	Tiers       []models.FeeTier `json:"tiers"`
+	Priority    *int             `json:"priority"`
+	Active      *bool            `json:"active"`
+}
+
+// QuoteRequest prices a transaction without creating it
+type QuoteRequest struct {
+	PartnerID   string `json:"partner_id"`
+	ProductCode string `json:"product_code"`
+	Amount      int64  `json:"amount"`
+}
+
+// CreateFeeRule adds a fee rule for a tenant, optionally scoped to a partner, product or category
+func CreateFeeRule(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req FeeRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	now := time.Now()
+	rule := models.FeeRule{
+		ID:          uuid.New().String(),
+		TenantID:    tenantID,
+		PartnerID:   emptyToNil(req.PartnerID),
+		ProductCode: emptyToNil(req.ProductCode),
+		Category:    emptyToNil(req.Category),
+		Priority:    100,
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	req.apply(&rule)
+	if rule.ProductCode != nil && rule.Category != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code and category are mutually exclusive",
+		})
+	}
+	if err := pricing.Validate(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	if rule.ProductCode != nil {
+		if _, err := catalog.GetProduct(ctx, *rule.ProductCode); err != nil {
+			return catalogError(c, err)
+		}
+	}
+
+	tiers, err := pricing.MarshalTiers(rule.Tiers)
+	if err != nil {
+		log.Printf("Error encoding fee tiers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create fee rule",
+		})
+	}
+
+	// The partner, when given, must belong to the tenant
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO fee_rules (id, tenant_id, partner_id, product_code, category, rule_type, flat_fee, percent_bps,
+			min_fee, max_fee, tiers_json, priority, active, created_at, updated_at)
+		 SELECT $1, t.id, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15 FROM tenants t
+		 WHERE t.id = $2 AND ($3::VARCHAR IS NULL OR EXISTS (SELECT 1 FROM partners WHERE id = $3 AND tenant_id = t.id))`,
+		rule.ID, rule.TenantID, rule.PartnerID, rule.ProductCode, rule.Category, rule.RuleType, rule.FlatFee,
+		rule.PercentBps, rule.MinFee, rule.MaxFee, tiers, rule.Priority, rule.Active, rule.CreatedAt, rule.UpdatedAt)
+	if err != nil {
+		log.Printf("Error creating fee rule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create fee rule",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tenant or partner not found",
+		})
+	}
+
+	log.Printf("Fee rule %s (%s) created for tenant %s by %s", rule.ID, rule.RuleType, tenantID, middleware.AdminID(c))
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// ListFeeRules lists a tenant's fee rules, optionally filtered by partner_id and product_code
+func ListFeeRules(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+pricing.RuleColumns+` FROM fee_rules
+		 WHERE tenant_id = $1 AND ($2 = '' OR partner_id = $2) AND ($3 = '' OR product_code = $3)
+		 ORDER BY partner_id NULLS FIRST, product_code NULLS FIRST, category NULLS FIRST, priority, created_at`,
+		tenantID, c.Query("partner_id"), c.Query("product_code"))
+	if err != nil {
+		log.Printf("Error querying fee rules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list fee rules",
+		})
+	}
+	defer rows.Close()
+
+	rules := []models.FeeRule{}
+	for rows.Next() {
+		rule, err := pricing.ScanRule(rows)
+		if err != nil {
+			log.Printf("Error scanning fee rule: %v", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return c.JSON(fiber.Map{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// UpdateFeeRule replaces a rule's type, amounts, tiers, priority and active flag
+func UpdateFeeRule(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	ruleID := c.Params("rule_id")
+	var req FeeRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	ctx := context.Background()
+	rule, err := pricing.ScanRule(db.Pool.QueryRow(ctx,
+		`SELECT `+pricing.RuleColumns+` FROM fee_rules WHERE id = $1 AND tenant_id = $2`,
+		ruleID, tenantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "fee rule not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error fetching fee rule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+
+	req.apply(&rule)
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+	if err := pricing.Validate(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	tiers, err := pricing.MarshalTiers(rule.Tiers)
+	if err != nil {
+		log.Printf("Error encoding fee tiers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update fee rule",
+		})
+	}
+
+	rule.UpdatedAt = time.Now()
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE fee_rules
+		 SET rule_type = $1, flat_fee = $2, percent_bps = $3, min_fee = $4, max_fee = $5, tiers_json = NULLIF($6, ''),
+			priority = $7, active = $8, updated_at = $9
+		 WHERE id = $10 AND tenant_id = $11`,
+		rule.RuleType, rule.FlatFee, rule.PercentBps, rule.MinFee, rule.MaxFee, tiers,
+		rule.Priority, rule.Active, rule.UpdatedAt, ruleID, tenantID)
+	if err != nil {
+		log.Printf("Error updating fee rule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update fee rule",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "fee rule not found",
+		})
+	}
+
+	log.Printf("Fee rule %s updated for tenant %s by %s", ruleID, tenantID, middleware.AdminID(c))
+	return c.JSON(rule)
+}
+
+// DeleteFeeRule removes a fee rule; transactions keep the fee_rule_id they were priced with
+func DeleteFeeRule(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	ruleID := c.Params("rule_id")
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx,
+		"DELETE FROM fee_rules WHERE id = $1 AND tenant_id = $2",
+		ruleID, tenantID)
+	if err != nil {
+		log.Printf("Error deleting fee rule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete fee rule",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "fee rule not found",
+		})
+	}
+
+	log.Printf("Fee rule %s deleted for tenant %s by %s", ruleID, tenantID, middleware.AdminID(c))
+	return c.JSON(fiber.Map{
+		"status": "deleted",
+		"id":     ruleID,
+	})
+}
+
+// QuoteTransaction is a dry run of the pricing CreateTransaction applies: it returns the
+// fee, provider cost and margin of a transaction without creating it or calling the provider
+func QuoteTransaction(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req QuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.ProductCode == "" || req.PartnerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code and partner_id are required",
+		})
+	}
+
+	price, err := pricing.Quote(context.Background(), pricing.Input{
+		TenantID:    tenantID,
+		PartnerID:   req.PartnerID,
+		ProductCode: req.ProductCode,
+		Amount:      req.Amount,
+	})
+	if err != nil {
+		return catalogError(c, err)
+	}
+	return c.JSON(price)
+}
+
+// apply copies the pricing fields of a request onto a rule
+func (r FeeRuleRequest) apply(rule *models.FeeRule) {
+	rule.RuleType = r.RuleType
+	rule.FlatFee = r.FlatFee
+	rule.PercentBps = r.PercentBps
+	rule.MinFee = r.MinFee
+	rule.MaxFee = r.MaxFee
+	rule.Tiers = r.Tiers
+	pricing.SortTiers(rule.Tiers)
+	if r.Priority != nil {
+		rule.Priority = *r.Priority
+	}
+}
+
+// emptyToNil treats an empty optional string as absent
+func emptyToNil(s *string) *string {
+	if s != nil && *s == "" {
+		return nil
+	}
+	return s
+}
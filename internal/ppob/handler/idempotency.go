@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// IdempotencyWait is how long a repeated request waits for the first one with its
+// idempotency key to finish, overridable from configuration at startup
+var IdempotencyWait = 30 * time.Second
+
+// maxIdempotencyKeyLength is the size of transactions.idempotency_key
+const maxIdempotencyKeyLength = 255
+
+// idempotencyPoll is how often a waiting request checks the first one's transaction
+const idempotencyPoll = 100 * time.Millisecond
+
+// errIdempotencyKeyMismatch is returned when the header and body carry different keys
+var errIdempotencyKeyMismatch = errors.New("idempotency_key does not match the Idempotency-Key header")
+
+// idempotencyKey returns the key of a create request: the Idempotency-Key header, or the
+// idempotency_key field of older clients
+func idempotencyKey(c *fiber.Ctx, req CreateTransactionRequest) (string, error) {
+	key := c.Get("Idempotency-Key")
+	switch {
+	case key == "":
+		key = req.IdempotencyKey
+	case req.IdempotencyKey != "" && req.IdempotencyKey != key:
+		return "", errIdempotencyKeyMismatch
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return "", errors.New("idempotency key is too long")
+	}
+	return key, nil
+}
+
+// requestHash fingerprints what a create request asks for, apart from its key. It is taken
+// before an inquiry fills in the request, so a replay hashes the same.
+func requestHash(req CreateTransactionRequest) string {
+	req.IdempotencyKey = ""
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayTransaction answers a request whose idempotency key already created a transaction.
+// A different request under the same key is rejected. A synchronous request still being
+// processed is waited for, so that the repeat returns its outcome rather than racing it.
+// It returns false when the tenant has no transaction with the key.
+func replayTransaction(c *fiber.Ctx, tenantID, key, hash string, async bool) (bool, error) {
+	ctx := context.Background()
+
+	var txID, status string
+	var storedHash *string
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, status, request_hash FROM transactions WHERE tenant_id = $1 AND idempotency_key = $2`,
+		tenantID, key).Scan(&txID, &status, &storedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Error checking idempotency key: %v", err)
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+
+	// Transactions created before hashes were recorded cannot be compared
+	if storedHash != nil && *storedHash != hash {
+		return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "idempotency key was already used for a different request",
+			"tx_id": txID,
+		})
+	}
+
+	if status == models.TxStatusPending && !async {
+		status, err = awaitTransaction(ctx, txID)
+		if err != nil {
+			log.Printf("Error waiting for transaction %s: %v", txID, err)
+			return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "database error",
+			})
+		}
+		if status == models.TxStatusPending {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return true, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "a request with this idempotency key is still in progress",
+				"tx_id": txID,
+			})
+		}
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	return true, getTransaction(c, tenantID, txID)
+}
+
+// awaitTransaction polls a transaction until it leaves pending or IdempotencyWait passes,
+// and returns its last status
+func awaitTransaction(ctx context.Context, txID string) (string, error) {
+	deadline := time.Now().Add(IdempotencyWait)
+	for {
+		var status string
+		err := db.Pool.QueryRow(ctx, `SELECT status FROM transactions WHERE id = $1`, txID).Scan(&status)
+		if err != nil {
+			return "", err
+		}
+		if status != models.TxStatusPending || !time.Now().Before(deadline) {
+			return status, nil
+		}
+		time.Sleep(idempotencyPoll)
+	}
+}
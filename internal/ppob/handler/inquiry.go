@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/pricing"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// InquiryTTL is how long an inquiry quote can be paid, overridable from configuration at startup
+var InquiryTTL = 15 * time.Minute
+
+// CreateInquiryRequest is the request to look up a customer's bill
+type CreateInquiryRequest struct {
+	ProductCode string `json:"product_code"`
+	CustomerNo  string `json:"customer_no"`
+	PartnerID   string `json:"partner_id"`
+}
+
+// InquiryResponse is a bill quote that CreateTransaction can pay by inquiry_id
+type InquiryResponse struct {
+	InquiryID    string    `json:"inquiry_id"`
+	ProductCode  string    `json:"product_code"`
+	CustomerNo   string    `json:"customer_no"`
+	CustomerName string    `json:"customer_name"`
+	Amount       int64     `json:"amount"`
+	AdminFee     int64     `json:"admin_fee"`
+	Total        int64     `json:"total"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// CreateInquiry asks the provider for a customer's bill and stores the quote
+func CreateInquiry(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	var req CreateInquiryRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.ProductCode == "" || req.CustomerNo == "" || req.PartnerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code, customer_no and partner_id are required",
+		})
+	}
+
+	ctx := context.Background()
+
+	partnerExists, err := tenantHasPartner(ctx, tenantID, req.PartnerID)
+	if err != nil {
+		log.Printf("Error checking partner: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+	if !partnerExists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "partner not found",
+		})
+	}
+
+	entry, err := catalog.Lookup(ctx, tenantID, req.PartnerID, req.ProductCode)
+	if err != nil {
+		return catalogError(c, err)
+	}
+
+	conn, err := saga.ResolveProvider(ctx, tenantID, req.ProductCode)
+	if err != nil {
+		log.Printf("Error resolving provider: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "no provider available",
+		})
+	}
+
+	quote, err := conn.Inquiry(ctx, connector.InquiryRequest{
+		ProductCode: req.ProductCode,
+		CustomerNo:  req.CustomerNo,
+	})
+	if connector.Classify(err) == connector.ClassBusiness {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "inquiry rejected by provider",
+		})
+	}
+	if err != nil {
+		log.Printf("Inquiry failed for %s/%s: %v", req.ProductCode, req.CustomerNo, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "inquiry failed",
+		})
+	}
+	if quote.Status != connector.StatusSuccess {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  "inquiry rejected by provider",
+			"status": quote.Status,
+		})
+	}
+
+	// Bills are quoted at the provider's amount, fixed products at their catalog price;
+	// the admin fee always comes from the tenant's fee rules
+	amount := quote.Amount
+	if fixed := entry.FixedAmount(); fixed > 0 {
+		amount = fixed
+	}
+	if amount <= 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "provider returned no amount due",
+		})
+	}
+
+	price, err := pricing.Compute(ctx, pricing.Input{
+		TenantID:    tenantID,
+		PartnerID:   req.PartnerID,
+		ProductCode: req.ProductCode,
+		Amount:      amount,
+	}, entry)
+	if err != nil {
+		log.Printf("Error pricing inquiry: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to price inquiry",
+		})
+	}
+
+	now := time.Now()
+	inquiry := models.Inquiry{
+		ID:           uuid.New().String(),
+		TenantID:     tenantID,
+		PartnerID:    req.PartnerID,
+		ProductCode:  req.ProductCode,
+		CustomerNo:   req.CustomerNo,
+		CustomerName: quote.CustomerName,
+		Amount:       amount,
+		AdminFee:     price.Fee,
+		FeeRuleID:    price.FeeRuleID,
+		Provider:     conn.Name(),
+		Status:       models.InquiryStatusOpen,
+		ExpiresAt:    now.Add(InquiryTTL),
+		CreatedAt:    now,
+	}
+	_, err = db.Pool.Exec(ctx,
+		`INSERT INTO inquiries (id, tenant_id, partner_id, product_code, customer_no, customer_name, amount, admin_fee, fee_rule_id, provider, status, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13)`,
+		inquiry.ID, inquiry.TenantID, inquiry.PartnerID, inquiry.ProductCode, inquiry.CustomerNo, inquiry.CustomerName,
+		inquiry.Amount, inquiry.AdminFee, inquiry.FeeRuleID, inquiry.Provider, inquiry.Status, inquiry.ExpiresAt, inquiry.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating inquiry: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create inquiry",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(InquiryResponse{
+		InquiryID:    inquiry.ID,
+		ProductCode:  inquiry.ProductCode,
+		CustomerNo:   inquiry.CustomerNo,
+		CustomerName: inquiry.CustomerName,
+		Amount:       inquiry.Amount,
+		AdminFee:     inquiry.AdminFee,
+		Total:        inquiry.Amount + inquiry.AdminFee,
+		ExpiresAt:    inquiry.ExpiresAt,
+	})
+}
+
+// errInquiryNotFound is returned by findInquiry when the tenant has no such inquiry
+var errInquiryNotFound = errors.New("inquiry not found")
+
+// findInquiry loads a tenant's inquiry
+func findInquiry(ctx context.Context, tenantID, inquiryID string) (models.Inquiry, error) {
+	var inq models.Inquiry
+	var customerName *string
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, tenant_id, partner_id, product_code, customer_no, customer_name, amount, admin_fee, COALESCE(fee_rule_id, ''),
+			provider, status, tx_id, expires_at, created_at
+		 FROM inquiries WHERE id = $1 AND tenant_id = $2`,
+		inquiryID, tenantID).Scan(&inq.ID, &inq.TenantID, &inq.PartnerID, &inq.ProductCode, &inq.CustomerNo, &customerName,
+		&inq.Amount, &inq.AdminFee, &inq.FeeRuleID, &inq.Provider, &inq.Status, &inq.TxID, &inq.ExpiresAt, &inq.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return inq, errInquiryNotFound
+	}
+	if customerName != nil {
+		inq.CustomerName = *customerName
+	}
+	return inq, err
+}
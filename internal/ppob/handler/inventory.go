@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/inventory"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// VoucherImportResponse is an imported batch with the lines that were skipped
+type VoucherImportResponse struct {
+	models.VoucherBatch
+	Invalid []inventory.RowError `json:"invalid"`
+}
+
+// LowStockThresholdRequest sets the stock level that raises a low-stock alert
+type LowStockThresholdRequest struct {
+	LowStockThreshold int `json:"low_stock_threshold"`
+}
+
+// RevealVoucherResponse carries a voucher code the one time it is shown
+type RevealVoucherResponse struct {
+	TxID       string     `json:"tx_id"`
+	Code       string     `json:"code"`
+	SerialNo   *string    `json:"serial_no"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevealedAt time.Time  `json:"revealed_at"`
+}
+
+// ImportVoucherBatch imports a CSV of voucher codes for a product as one batch.
+// The multipart form carries file, product_code, and optionally supplier_ref and a
+// default expires_at for rows without their own.
+func ImportVoucherBatch(c *fiber.Ctx) error {
+	productCode := c.FormValue("product_code")
+	if productCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code is required",
+		})
+	}
+	defaultExpiry, err := inventory.ParseExpiry(c.FormValue("expires_at"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "file is required",
+		})
+	}
+
+	ctx := context.Background()
+	if _, err := catalog.GetProduct(ctx, productCode); err != nil {
+		return catalogError(c, err)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Printf("Error opening voucher import: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to read file",
+		})
+	}
+	defer file.Close()
+
+	rows, invalid, err := inventory.ParseCSV(file, defaultExpiry)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(rows) == 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":   "no valid codes in file",
+			"invalid": invalid,
+		})
+	}
+
+	batch, err := inventory.Import(ctx, productCode, c.FormValue("supplier_ref"), middleware.AdminID(c), rows)
+	if err != nil {
+		log.Printf("Error importing voucher batch: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to import voucher codes",
+		})
+	}
+
+	if invalid == nil {
+		invalid = []inventory.RowError{}
+	}
+	log.Printf("Voucher batch %s imported for %s by %s: %d codes, %d duplicates, %d invalid",
+		batch.ID, productCode, batch.ImportedBy, batch.CodeCount, batch.DuplicateCount, len(invalid))
+	return c.Status(fiber.StatusCreated).JSON(VoucherImportResponse{
+		VoucherBatch: batch,
+		Invalid:      invalid,
+	})
+}
+
+// ListVoucherBatches lists the most recent imports, optionally for one product
+func ListVoucherBatches(c *fiber.Ctx) error {
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT id, product_code, supplier_ref, code_count, duplicate_count, COALESCE(imported_by, ''), created_at
+		 FROM voucher_batches WHERE $1 = '' OR product_code = $1
+		 ORDER BY created_at DESC LIMIT 100`,
+		c.Query("product_code"))
+	if err != nil {
+		log.Printf("Error querying voucher batches: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list voucher batches",
+		})
+	}
+	defer rows.Close()
+
+	batches := []models.VoucherBatch{}
+	for rows.Next() {
+		var b models.VoucherBatch
+		err := rows.Scan(&b.ID, &b.ProductCode, &b.SupplierRef, &b.CodeCount, &b.DuplicateCount, &b.ImportedBy, &b.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning voucher batch: %v", err)
+			continue
+		}
+		batches = append(batches, b)
+	}
+
+	return c.JSON(fiber.Map{
+		"batches": batches,
+		"count":   len(batches),
+	})
+}
+
+// GetVoucherStock returns stock levels per product, optionally for one product
+func GetVoucherStock(c *fiber.Ctx) error {
+	levels, err := inventory.Stock(context.Background(), c.Query("product_code"))
+	if err != nil {
+		log.Printf("Error fetching voucher stock: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch stock",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"stock": levels,
+		"count": len(levels),
+	})
+}
+
+// SetLowStockThreshold sets the available count at which a product raises inventory.low_stock
+func SetLowStockThreshold(c *fiber.Ctx) error {
+	code := c.Params("code")
+	var req LowStockThresholdRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if req.LowStockThreshold < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "low_stock_threshold must not be negative",
+		})
+	}
+
+	// A new threshold is alerted on afresh
+	tag, err := db.Pool.Exec(context.Background(),
+		"UPDATE products SET low_stock_threshold = $1, low_stock_alerted_at = NULL, updated_at = $2 WHERE code = $3",
+		req.LowStockThreshold, time.Now(), code)
+	if err != nil {
+		log.Printf("Error updating low stock threshold: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update threshold",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": catalog.ErrProductNotFound.Error(),
+		})
+	}
+
+	log.Printf("Low stock threshold of %s set to %d by %s", code, req.LowStockThreshold, middleware.AdminID(c))
+	return c.JSON(fiber.Map{
+		"product_code":        code,
+		"low_stock_threshold": req.LowStockThreshold,
+	})
+}
+
+// RevealVoucher returns the voucher code of a tenant's successful transaction. The code
+// is shown once; afterwards only its serial number and expiry are kept visible.
+func RevealVoucher(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	txID := c.Params("tx_id")
+
+	code, plaintext, err := inventory.Reveal(context.Background(), tenantID, txID)
+	switch {
+	case errors.Is(err, inventory.ErrNotAllocated):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, inventory.ErrNotSettled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, inventory.ErrAlreadyRevealed):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error":       err.Error(),
+			"serial_no":   code.SerialNo,
+			"revealed_at": code.RevealedAt,
+		})
+	case err != nil:
+		log.Printf("Error revealing voucher for %s: %v", txID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to reveal voucher",
+		})
+	}
+
+	log.Printf("Voucher code %d of transaction %s revealed to tenant %s", code.ID, txID, tenantID)
+	return c.JSON(RevealVoucherResponse{
+		TxID:       txID,
+		Code:       plaintext,
+		SerialNo:   code.SerialNo,
+		ExpiresAt:  code.ExpiresAt,
+		RevealedAt: *code.RevealedAt,
+	})
+}
@@ -0,0 +1,459 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ProductRequest creates or replaces a catalog product
+type ProductRequest struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	Category     string `json:"category"`
+	Denomination *int64 `json:"denomination"`
+	BaseCost     int64  `json:"base_cost"`
+	CancelWindow int    `json:"cancel_window"`
+	Active       *bool  `json:"active"`
+}
+
+// ProductPriceRequest creates or replaces a tenant or partner price
+type ProductPriceRequest struct {
+	ProductCode  string  `json:"product_code"`
+	PartnerID    *string `json:"partner_id"`
+	SellingPrice *int64  `json:"selling_price"`
+	Fee          int64   `json:"fee"`
+	Active       *bool   `json:"active"`
+}
+
+// TenantProductResponse is a product as sold to a tenant's partners
+type TenantProductResponse struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	Category     string `json:"category"`
+	Denomination *int64 `json:"denomination"`
+	// Price is the amount charged for a fixed-denomination product, nil for bills
+	Price *int64 `json:"price"`
+	Fee   int64  `json:"fee"`
+}
+
+// validate checks the fields shared by create and update
+func (r ProductRequest) validate() string {
+	if r.Name == "" || r.Category == "" {
+		return "name and category are required"
+	}
+	if !catalog.Categories[r.Category] {
+		return "unknown category " + r.Category
+	}
+	if r.Denomination != nil && *r.Denomination <= 0 {
+		return "denomination must be greater than 0"
+	}
+	if r.BaseCost < 0 {
+		return "base_cost must not be negative"
+	}
+	if r.CancelWindow < 0 {
+		return "cancel_window must not be negative"
+	}
+	return ""
+}
+
+// validate checks the fields shared by create and update
+func (r ProductPriceRequest) validate() string {
+	if r.SellingPrice != nil && *r.SellingPrice <= 0 {
+		return "selling_price must be greater than 0"
+	}
+	if r.Fee < 0 {
+		return "fee must not be negative"
+	}
+	return ""
+}
+
+// CreateProduct adds a product to the catalog
+func CreateProduct(c *fiber.Ctx) error {
+	var req ProductRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	now := time.Now()
+	p := models.Product{
+		Code:         req.Code,
+		Name:         req.Name,
+		Category:     req.Category,
+		Denomination: req.Denomination,
+		BaseCost:     req.BaseCost,
+		CancelWindow: req.CancelWindow,
+		Active:       req.Active == nil || *req.Active,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	ctx := context.Background()
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO products (code, name, category, denomination, base_cost, cancel_window, active, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		p.Code, p.Name, p.Category, p.Denomination, p.BaseCost, p.CancelWindow, p.Active, p.CreatedAt, p.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "product already exists",
+		})
+	}
+	if err != nil {
+		log.Printf("Error creating product: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create product",
+		})
+	}
+
+	log.Printf("Product %s created by %s", p.Code, middleware.AdminID(c))
+	return c.Status(fiber.StatusCreated).JSON(p)
+}
+
+// ListProducts lists catalog products, optionally filtered by category and active
+func ListProducts(c *fiber.Ctx) error {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT code, name, category, denomination, base_cost, cancel_window, active, created_at, updated_at
+		 FROM products
+		 WHERE ($1 = '' OR category = $1) AND ($2 = '' OR active = ($2 = 'true'))
+		 ORDER BY category, code`,
+		c.Query("category"), c.Query("active"))
+	if err != nil {
+		log.Printf("Error querying products: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list products",
+		})
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var p models.Product
+		err := rows.Scan(&p.Code, &p.Name, &p.Category, &p.Denomination, &p.BaseCost, &p.CancelWindow, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			log.Printf("Error scanning product: %v", err)
+			continue
+		}
+		products = append(products, p)
+	}
+
+	return c.JSON(fiber.Map{
+		"products": products,
+		"count":    len(products),
+	})
+}
+
+// GetProduct returns a catalog product
+func GetProduct(c *fiber.Ctx) error {
+	p, err := catalog.GetProduct(context.Background(), c.Params("code"))
+	if err != nil {
+		return catalogError(c, err)
+	}
+	return c.JSON(p)
+}
+
+// UpdateProduct replaces a product's attributes; the code cannot change
+func UpdateProduct(c *fiber.Ctx) error {
+	code := c.Params("code")
+	var req ProductRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx := context.Background()
+	var p models.Product
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE products
+		 SET name = $1, category = $2, denomination = $3, base_cost = $4, cancel_window = $5, active = COALESCE($6, active), updated_at = $7
+		 WHERE code = $8
+		 RETURNING code, name, category, denomination, base_cost, cancel_window, active, created_at, updated_at`,
+		req.Name, req.Category, req.Denomination, req.BaseCost, req.CancelWindow, req.Active, time.Now(), code).Scan(
+		&p.Code, &p.Name, &p.Category, &p.Denomination, &p.BaseCost, &p.CancelWindow, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return catalogError(c, catalog.ErrProductNotFound)
+	}
+	if err != nil {
+		log.Printf("Error updating product: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update product",
+		})
+	}
+
+	log.Printf("Product %s updated by %s", code, middleware.AdminID(c))
+	return c.JSON(p)
+}
+
+// DeleteProduct deactivates a product. Products stay in the catalog because
+// transactions refer to them by code.
+func DeleteProduct(c *fiber.Ctx) error {
+	code := c.Params("code")
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx,
+		"UPDATE products SET active = false, updated_at = $1 WHERE code = $2",
+		time.Now(), code)
+	if err != nil {
+		log.Printf("Error deactivating product: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to deactivate product",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return catalogError(c, catalog.ErrProductNotFound)
+	}
+
+	log.Printf("Product %s deactivated by %s", code, middleware.AdminID(c))
+	return c.JSON(fiber.Map{
+		"status": "inactive",
+		"code":   code,
+	})
+}
+
+// CreateProductPrice sets a tenant's default price for a product, or a partner override
+func CreateProductPrice(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req ProductPriceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if req.ProductCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code is required",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if req.PartnerID != nil && *req.PartnerID == "" {
+		req.PartnerID = nil
+	}
+
+	ctx := context.Background()
+	if _, err := catalog.GetProduct(ctx, req.ProductCode); err != nil {
+		return catalogError(c, err)
+	}
+
+	now := time.Now()
+	price := models.TenantProductPrice{
+		ID:           uuid.New().String(),
+		TenantID:     tenantID,
+		PartnerID:    req.PartnerID,
+		ProductCode:  req.ProductCode,
+		SellingPrice: req.SellingPrice,
+		Fee:          req.Fee,
+		Active:       req.Active == nil || *req.Active,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	// The partner, when given, must belong to the tenant
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO tenant_product_prices (id, tenant_id, partner_id, product_code, selling_price, fee, active, created_at, updated_at)
+		 SELECT $1, t.id, $3, $4, $5, $6, $7, $8, $9 FROM tenants t
+		 WHERE t.id = $2 AND ($3::VARCHAR IS NULL OR EXISTS (SELECT 1 FROM partners WHERE id = $3 AND tenant_id = t.id))`,
+		price.ID, price.TenantID, price.PartnerID, price.ProductCode, price.SellingPrice, price.Fee, price.Active,
+		price.CreatedAt, price.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "a price for this product already exists",
+		})
+	}
+	if err != nil {
+		log.Printf("Error creating product price: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create product price",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tenant or partner not found",
+		})
+	}
+
+	log.Printf("Price %s for %s created for tenant %s by %s", price.ID, price.ProductCode, tenantID, middleware.AdminID(c))
+	return c.Status(fiber.StatusCreated).JSON(price)
+}
+
+// ListProductPrices lists a tenant's prices, optionally filtered by product_code and partner_id
+func ListProductPrices(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, tenant_id, partner_id, product_code, selling_price, fee, active, created_at, updated_at
+		 FROM tenant_product_prices
+		 WHERE tenant_id = $1 AND ($2 = '' OR product_code = $2) AND ($3 = '' OR partner_id = $3)
+		 ORDER BY product_code, partner_id NULLS FIRST`,
+		tenantID, c.Query("product_code"), c.Query("partner_id"))
+	if err != nil {
+		log.Printf("Error querying product prices: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list product prices",
+		})
+	}
+	defer rows.Close()
+
+	prices := []models.TenantProductPrice{}
+	for rows.Next() {
+		var p models.TenantProductPrice
+		err := rows.Scan(&p.ID, &p.TenantID, &p.PartnerID, &p.ProductCode, &p.SellingPrice, &p.Fee, &p.Active,
+			&p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			log.Printf("Error scanning product price: %v", err)
+			continue
+		}
+		prices = append(prices, p)
+	}
+
+	return c.JSON(fiber.Map{
+		"prices": prices,
+		"count":  len(prices),
+	})
+}
+
+// UpdateProductPrice replaces a price's selling price, fee and active flag
+func UpdateProductPrice(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	priceID := c.Params("price_id")
+	var req ProductPriceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx := context.Background()
+	var p models.TenantProductPrice
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE tenant_product_prices
+		 SET selling_price = $1, fee = $2, active = COALESCE($3, active), updated_at = $4
+		 WHERE id = $5 AND tenant_id = $6
+		 RETURNING id, tenant_id, partner_id, product_code, selling_price, fee, active, created_at, updated_at`,
+		req.SellingPrice, req.Fee, req.Active, time.Now(), priceID, tenantID).Scan(
+		&p.ID, &p.TenantID, &p.PartnerID, &p.ProductCode, &p.SellingPrice, &p.Fee, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "product price not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error updating product price: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update product price",
+		})
+	}
+
+	log.Printf("Price %s updated for tenant %s by %s", priceID, tenantID, middleware.AdminID(c))
+	return c.JSON(p)
+}
+
+// DeleteProductPrice removes a price; without a price the product is no longer sold to the tenant or partner
+func DeleteProductPrice(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	priceID := c.Params("price_id")
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx,
+		"DELETE FROM tenant_product_prices WHERE id = $1 AND tenant_id = $2",
+		priceID, tenantID)
+	if err != nil {
+		log.Printf("Error deleting product price: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete product price",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "product price not found",
+		})
+	}
+
+	log.Printf("Price %s deleted for tenant %s by %s", priceID, tenantID, middleware.AdminID(c))
+	return c.JSON(fiber.Map{
+		"status": "deleted",
+		"id":     priceID,
+	})
+}
+
+// ListTenantProducts lists the active products a tenant sells, with the prices that apply
+// to the partner_id query parameter or the tenant defaults
+func ListTenantProducts(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT DISTINCT ON (p.code) p.code, p.name, p.category, p.denomination,
+			COALESCE(tp.selling_price, p.denomination), tp.fee
+		 FROM products p
+		 JOIN tenant_product_prices tp ON tp.product_code = p.code
+		 WHERE p.active = true AND tp.active = true AND tp.tenant_id = $1
+		   AND (tp.partner_id IS NULL OR tp.partner_id = $2)
+		   AND ($3 = '' OR p.category = $3)
+		 ORDER BY p.code, tp.partner_id NULLS LAST`,
+		tenantID, c.Query("partner_id"), c.Query("category"))
+	if err != nil {
+		log.Printf("Error querying tenant products: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list products",
+		})
+	}
+	defer rows.Close()
+
+	products := []TenantProductResponse{}
+	for rows.Next() {
+		var p TenantProductResponse
+		if err := rows.Scan(&p.Code, &p.Name, &p.Category, &p.Denomination, &p.Price, &p.Fee); err != nil {
+			log.Printf("Error scanning tenant product: %v", err)
+			continue
+		}
+		products = append(products, p)
+	}
+
+	return c.JSON(fiber.Map{
+		"products": products,
+		"count":    len(products),
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"log"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListProviderAttempts lists the provider calls made for a transaction, oldest first
+func ListProviderAttempts(c *fiber.Ctx) error {
+	txID := c.Params("tx_id")
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, tx_id, provider, operation, attempt, status, error_class, error, duration_ms, created_at
+		 FROM transaction_provider_attempts WHERE tx_id = $1 ORDER BY id`,
+		txID)
+	if err != nil {
+		log.Printf("Error querying provider attempts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list provider attempts",
+		})
+	}
+	defer rows.Close()
+
+	attempts := []models.ProviderAttempt{}
+	for rows.Next() {
+		var a models.ProviderAttempt
+		err := rows.Scan(&a.ID, &a.TxID, &a.Provider, &a.Operation, &a.Attempt, &a.Status,
+			&a.ErrorClass, &a.Error, &a.DurationMs, &a.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning provider attempt: %v", err)
+			continue
+		}
+		attempts = append(attempts, a)
+	}
+
+	return c.JSON(fiber.Map{
+		"attempts": attempts,
+		"count":    len(attempts),
+	})
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"context"
+	"log"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/provider"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListProviderBreakers shows the circuit breaker of each provider config as seen by this
+// instance, optionally filtered by the tenant_id query parameter
+func ListProviderBreakers(c *fiber.Ctx) error {
+	ctx := context.Background()
+
+	breakers, err := provider.Breakers(ctx, c.Query("tenant_id"))
+	if err != nil {
+		log.Printf("Error listing provider breakers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list provider breakers",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"breakers": breakers,
+		"count":    len(breakers),
+	})
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/receipt"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// TenantBrandingRequest sets what a tenant's receipts show
+type TenantBrandingRequest struct {
+	DisplayName string  `json:"display_name"`
+	Address     *string `json:"address"`
+	Phone       *string `json:"phone"`
+	Footer      *string `json:"footer"`
+}
+
+// ReceiptURLResponse is a signed download URL of a receipt
+type ReceiptURLResponse struct {
+	TxID      string    `json:"tx_id"`
+	Format    string    `json:"format"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetReceipt returns the receipt of a successful transaction as a PDF (format=pdf, the
+// default) or thermal-printer text (format=text). With signed_url=true it returns a
+// time-limited download URL instead, where the storage backend supports one.
+func GetReceipt(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	txID := c.Params("tx_id")
+	format := c.Query("format", receipt.FormatPDF)
+
+	ctx := context.Background()
+	r, err := receipt.Find(ctx, tenantID, txID)
+	switch {
+	case errors.Is(err, receipt.ErrTransactionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, receipt.ErrNotPaid):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Error rendering receipt of %s: %v", txID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to render receipt",
+		})
+	}
+
+	key, contentType, ok := receipt.Key(r, format)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be pdf or text",
+		})
+	}
+
+	if c.QueryBool("signed_url") {
+		url, err := receipt.Store.SignedURL(ctx, key, receipt.URLTTL)
+		if errors.Is(err, storage.ErrSigningUnsupported) {
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			log.Printf("Error signing receipt URL of %s: %v", txID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to sign receipt url",
+			})
+		}
+		return c.JSON(ReceiptURLResponse{
+			TxID:      txID,
+			Format:    format,
+			URL:       url,
+			ExpiresAt: time.Now().Add(receipt.URLTTL),
+		})
+	}
+
+	body, err := receipt.Store.Get(ctx, key)
+	if err != nil {
+		log.Printf("Error reading receipt %s: %v", key, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to read receipt",
+		})
+	}
+	filename := "receipt-" + txID + ".pdf"
+	if format == receipt.FormatText {
+		filename = "receipt-" + txID + ".txt"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="`+filename+`"`)
+	return c.Send(body)
+}
+
+// PutTenantBranding creates or replaces the branding printed on a tenant's receipts.
+// Receipts already rendered keep the branding they were rendered with.
+func PutTenantBranding(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req TenantBrandingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if req.DisplayName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "display_name is required",
+		})
+	}
+
+	now := time.Now()
+	b := models.TenantBranding{
+		TenantID:    tenantID,
+		DisplayName: req.DisplayName,
+		Address:     req.Address,
+		Phone:       req.Phone,
+		Footer:      req.Footer,
+		UpdatedAt:   now,
+	}
+	err := db.Pool.QueryRow(context.Background(),
+		`INSERT INTO tenant_branding (tenant_id, display_name, address, phone, footer, created_at, updated_at)
+		 SELECT id, $2, $3, $4, $5, $6, $6 FROM tenants WHERE id = $1
+		 ON CONFLICT (tenant_id) DO UPDATE
+		 SET display_name = EXCLUDED.display_name, address = EXCLUDED.address, phone = EXCLUDED.phone,
+		     footer = EXCLUDED.footer, updated_at = EXCLUDED.updated_at
+		 RETURNING created_at`,
+		b.TenantID, b.DisplayName, b.Address, b.Phone, b.Footer, now).Scan(&b.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tenant not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error saving tenant branding: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save branding",
+		})
+	}
+
+	log.Printf("Receipt branding of tenant %s updated by %s", tenantID, middleware.AdminID(c))
+	return c.JSON(b)
+}
+
+// GetTenantBranding returns the branding printed on a tenant's receipts
+func GetTenantBranding(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+
+	var b models.TenantBranding
+	err := db.Pool.QueryRow(context.Background(),
+		`SELECT tenant_id, display_name, address, phone, footer, created_at, updated_at
+		 FROM tenant_branding WHERE tenant_id = $1`,
+		tenantID).Scan(&b.TenantID, &b.DisplayName, &b.Address, &b.Phone, &b.Footer, &b.CreatedAt, &b.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "branding not configured",
+		})
+	}
+	if err != nil {
+		log.Printf("Error fetching tenant branding: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+	return c.JSON(b)
+}
@@ -1,29 +1,42 @@
 package handler
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
-	"net/http"
 	"time"
 
+	"github.com/aziz46/core-e-voucher-services/internal/common/client"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/fulfillment"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/pricing"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/worker"
 	"github.com/aziz46/core-e-voucher-services/pkg/connector"
 	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-// CreateTransactionRequest is the request to create a transaction
+// CreateTransactionRequest is the request to create a transaction.
+// With inquiry_id the product, customer, partner and amount come from the inquiry quote;
+// bill products can only be paid that way.
 type CreateTransactionRequest struct {
 	ProductCode    string `json:"product_code"`
 	CustomerNo     string `json:"customer_no"`
 	Amount         int64  `json:"amount"`
 	PartnerID      string `json:"partner_id"`
+	InquiryID      string `json:"inquiry_id"`
 	IdempotencyKey string `json:"idempotency_key"`
+	// Async returns 202 with the pending transaction and processes it in the background;
+	// the outcome is reported to the tenant's webhook
+	Async bool `json:"async"`
 }
 
+// AsyncPool processes asynchronous transactions, set at startup
+var AsyncPool *worker.TransactionPool
+
 // TransactionResponse is the response for a transaction
 type TransactionResponse struct {
 	ID           string    `json:"id"`
@@ -34,6 +47,8 @@ type TransactionResponse struct {
 	ProviderTxID string    `json:"provider_tx_id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// Fulfillment is what the payment delivered, such as a PLN token or voucher serial number
+	Fulfillment *connector.Fulfillment `json:"fulfillment,omitempty"`
 }
 
 // CreateTransaction creates a new PPOB transaction
@@ -47,139 +62,262 @@ func CreateTransaction(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Amount <= 0 {
+	key, err := idempotencyKey(c, req)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "amount must be greater than 0",
+			"error": err.Error(),
 		})
 	}
+	hash := requestHash(req)
+	if key != "" {
+		if replayed, err := replayTransaction(c, tenantID, key, hash, req.Async); replayed {
+			return err
+		}
+	}
 
 	ctx := context.Background()
 
-	// Check idempotency
-	if req.IdempotencyKey != "" {
-		var existingTxID string
-		err := db.Pool.QueryRow(ctx,
-			"SELECT id FROM transactions WHERE idempotency_key = $1 AND tenant_id = $2 LIMIT 1",
-			req.IdempotencyKey, tenantID).Scan(&existingTxID)
+	var quotedFee int64
+	var quotedRuleID string
+	providerName := ""
+	if req.InquiryID != "" {
+		inq, err := findInquiry(ctx, tenantID, req.InquiryID)
+		if errors.Is(err, errInquiryNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "inquiry not found",
+			})
+		}
+		if err != nil {
+			log.Printf("Error fetching inquiry: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "database error",
+			})
+		}
 
-		if err == nil {
-			// Transaction already exists, return existing
-			return getTransaction(c, tenantID, existingTxID)
+		if req.PartnerID != "" && req.PartnerID != inq.PartnerID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "inquiry belongs to another partner",
+			})
+		}
+		if req.Amount != 0 && req.Amount != inq.Amount {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "amount does not match inquiry",
+			})
+		}
+		// The quote pays exactly the bill that was inquired, never another customer's
+		if req.ProductCode != "" && req.ProductCode != inq.ProductCode {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "product_code does not match inquiry",
+			})
+		}
+		if req.CustomerNo != "" && req.CustomerNo != inq.CustomerNo {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "customer_no does not match inquiry",
+			})
 		}
+
+		req.PartnerID = inq.PartnerID
+		req.ProductCode = inq.ProductCode
+		req.CustomerNo = inq.CustomerNo
+		req.Amount = inq.Amount
+		// The quote already carries the fee, and the bill is paid where it was quoted
+		quotedFee = inq.AdminFee
+		quotedRuleID = inq.FeeRuleID
+		providerName = inq.Provider
 	}
 
-	// Calculate fee (2.5% for demo)
-	fee := req.Amount / 40
-	total := req.Amount + fee
-	txID := uuid.New().String()
+	if req.ProductCode == "" || req.CustomerNo == "" || req.PartnerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "product_code, customer_no and partner_id are required",
+		})
+	}
 
-	// Start database transaction
-	tx, err := db.Pool.Begin(ctx)
+	// The hold is taken from the partner's credit, which only its own tenant may spend
+	partnerExists, err := tenantHasPartner(ctx, tenantID, req.PartnerID)
 	if err != nil {
+		log.Printf("Error checking partner: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "database error",
 		})
 	}
-	defer tx.Rollback(ctx)
-
-	// Create transaction record
-	now := time.Now()
-	_, err = tx.Exec(ctx,
-		`INSERT INTO transactions (id, tenant_id, partner_id, amount, fee, total, status, provider, idempotency_key, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		txID, tenantID, req.PartnerID, req.Amount, fee, total, "pending", "mock_provider", req.IdempotencyKey, now, now)
-
-	if err != nil {
-		log.Printf("Error creating transaction: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to create transaction",
+	if !partnerExists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "partner not found",
 		})
 	}
 
-	// Reserve credit from credit-service
-	reserveReq := map[string]interface{}{
-		"tx_id":  txID,
-		"amount": total,
+	// Unknown and inactive products are rejected even when paying a quote
+	entry, err := catalog.Lookup(ctx, tenantID, req.PartnerID, req.ProductCode)
+	if err != nil {
+		return catalogError(c, err)
+	}
+	var price pricing.Breakdown
+	if req.InquiryID != "" {
+		price = pricing.Costs(entry, req.Amount, quotedFee)
+		price.FeeRuleID = quotedRuleID
+	} else {
+		req.Amount, err = entry.Amount(req.Amount)
+		if err != nil {
+			return catalogError(c, err)
+		}
+		price, err = pricing.Compute(ctx, pricing.Input{
+			TenantID:    tenantID,
+			PartnerID:   req.PartnerID,
+			ProductCode: req.ProductCode,
+			Amount:      req.Amount,
+		}, entry)
+		if err != nil {
+			log.Printf("Error pricing transaction: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to price transaction",
+			})
+		}
 	}
 
-	reserveBody, _ := json.Marshal(reserveReq)
-	creditURL := fmt.Sprintf("http://credit-service:8080/v1/partners/%s/reserve", req.PartnerID)
+	if providerName == "" {
+		conn, err := saga.ResolveProvider(ctx, tenantID, req.ProductCode)
+		if err != nil {
+			log.Printf("Error resolving provider: %v", err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "no provider available",
+			})
+		}
+		providerName = conn.Name()
+	}
 
-	httpReq, _ := http.NewRequestWithContext(ctx, "POST", creditURL, bytes.NewBuffer(reserveBody))
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-Service-Token", "internal-service-token")
+	now := time.Now()
+	t := models.Transaction{
+		ID:             uuid.New().String(),
+		TenantID:       tenantID,
+		PartnerID:      req.PartnerID,
+		Amount:         price.Amount,
+		Fee:            price.Fee,
+		Total:          price.Total,
+		ProviderCost:   price.ProviderCost,
+		Margin:         price.Margin,
+		FeeRuleID:      price.FeeRuleID,
+		Status:         models.TxStatusPending,
+		Provider:       providerName,
+		ProductCode:    req.ProductCode,
+		CustomerNo:     req.CustomerNo,
+		InquiryID:      req.InquiryID,
+		IdempotencyKey: key,
+		RequestHash:    hash,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(httpReq)
+	// An async transaction needs a queue slot before it is created
+	if req.Async && (AsyncPool == nil || !AsyncPool.Reserve()) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "async queue is full, retry later",
+		})
+	}
 
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to reserve credit: %v", err)
+	// Persist the transaction and its saga before any external call
+	token, err := saga.Start(ctx, t)
+	if err != nil && req.Async {
+		AsyncPool.Release()
+	}
+	// A concurrent request with the same key created the transaction first
+	if errors.Is(err, saga.ErrDuplicateKey) {
+		if replayed, err := replayTransaction(c, tenantID, key, hash, req.Async); replayed {
+			return err
+		}
+	}
+	if errors.Is(err, saga.ErrInquiryUnavailable) {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error": "insufficient credit limit",
+			"error": err.Error(),
 		})
 	}
-	resp.Body.Close()
-
-	// Call provider payment
-	provider := connector.NewMockProvider(0) // 0% failure rate for demo
-	payReq := connector.PayRequest{
-		ProductCode: req.ProductCode,
-		CustomerNo:  req.CustomerNo,
-		Amount:      req.Amount,
-		RefNo:       txID,
+	if err != nil {
+		log.Printf("Error creating transaction: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create transaction",
+		})
 	}
 
-	payResp, err := provider.Pay(ctx, payReq)
+	if req.Async {
+		AsyncPool.Submit(t.ID, token)
+		return c.Status(fiber.StatusAccepted).JSON(toTransactionResponse(t))
+	}
 
+	res, err := saga.Run(ctx, t.ID, token)
 	if err != nil {
-		// Restore credit on failure
-		restoreReq := map[string]interface{}{
-			"tx_id":  txID,
-			"amount": total,
-		}
-		restoreBody, _ := json.Marshal(restoreReq)
-		restoreURL := fmt.Sprintf("http://credit-service:8080/v1/partners/%s/restore", req.PartnerID)
-
-		httpReq, _ := http.NewRequestWithContext(ctx, "POST", restoreURL, bytes.NewBuffer(restoreBody))
-		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("X-Service-Token", "internal-service-token")
-		client.Do(httpReq)
-
-		// Mark transaction as failed
-		_, _ = tx.Exec(ctx, "UPDATE transactions SET status = $1, updated_at = $2 WHERE id = $3",
-			"failed", now, txID)
-		tx.Commit(ctx)
+		log.Printf("Saga for transaction %s interrupted in state %s: %v", t.ID, res.State, err)
+	}
 
+	switch {
+	case res.Transaction.Status == models.TxStatusSuccess:
+		return c.Status(fiber.StatusCreated).JSON(toTransactionResponse(res.Transaction))
+	case errors.Is(res.Err, client.ErrInsufficientCredit):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "insufficient credit limit",
+		})
+	case errors.Is(res.Err, client.ErrReservationMismatch), errors.Is(res.Err, client.ErrInvalidReservationState):
+		// The transaction's hold conflicts with an earlier one; this is not the partner's limit
+		log.Printf("Credit hold conflict for %s: %v", t.ID, res.Err)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "credit hold conflicts with an earlier reservation",
+			"tx_id": t.ID,
+		})
+	case errors.Is(res.Err, client.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "credit limit not found for partner",
+		})
+	case res.FailedAt == models.SagaStatePending:
+		log.Printf("Failed to reserve credit for %s: %v", t.ID, res.Err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "credit service unavailable",
+		})
+	case res.Transaction.Status == models.TxStatusSuspect:
+		// The provider has not confirmed the payment; status checks settle it in the background
+		return c.Status(fiber.StatusAccepted).JSON(toTransactionResponse(res.Transaction))
+	case res.Transaction.Status == models.TxStatusFailed && connector.Classify(res.Err) == connector.ClassTransient:
+		log.Printf("Provider unavailable for %s: %v", t.ID, res.Err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "provider unavailable",
+			"tx_id": t.ID,
+		})
+	case res.Transaction.Status == models.TxStatusFailed:
+		log.Printf("Payment failed for %s: %v", t.ID, res.Err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "payment failed",
 		})
+	default:
+		// Left for the recovery worker; the client can poll the transaction
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "transaction processing interrupted",
+			"tx_id": t.ID,
+		})
 	}
+}
 
-	// Update transaction with provider response
-	_, err = tx.Exec(ctx,
-		"UPDATE transactions SET status = $1, provider_tx_id = $2, updated_at = $3 WHERE id = $4",
-		"success", payResp.ProviderRefNo, now, txID)
-
-	if err != nil {
-		log.Printf("Error updating transaction: %v", err)
-	}
+// tenantHasPartner reports whether the partner exists and belongs to the tenant
+func tenantHasPartner(ctx context.Context, tenantID, partnerID string) (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM partners WHERE id = $1 AND tenant_id = $2)",
+		partnerID, tenantID).Scan(&exists)
+	return exists, err
+}
 
-	if err = tx.Commit(ctx); err != nil {
+// catalogError maps catalog lookup errors to responses
+func catalogError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, catalog.ErrProductNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, catalog.ErrProductInactive), errors.Is(err, catalog.ErrProductNotPriced):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, catalog.ErrAmountMismatch), errors.Is(err, catalog.ErrAmountRequired),
+		errors.Is(err, catalog.ErrInquiryRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	default:
+		log.Printf("Error resolving product: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "transaction commit failed",
+			"error": "database error",
 		})
 	}
-
-	return c.Status(fiber.StatusCreated).JSON(TransactionResponse{
-		ID:           txID,
-		Status:       "success",
-		Amount:       req.Amount,
-		Fee:          fee,
-		Total:        total,
-		ProviderTxID: payResp.ProviderRefNo,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-	})
 }
 
 // GetTransaction retrieves a transaction by ID
@@ -194,37 +332,39 @@ func getTransaction(c *fiber.Ctx, tenantID, txID string) error {
 	ctx := context.Background()
 
 	row := db.Pool.QueryRow(ctx,
-		`SELECT id, status, amount, fee, total, provider_tx_id, created_at, updated_at 
+		`SELECT id, status, amount, fee, total, COALESCE(provider_tx_id, ''), fulfillment_json, fulfillment_encrypted, created_at, updated_at
 		 FROM transactions WHERE id = $1 AND tenant_id = $2`,
 		txID, tenantID)
 
-	var tx struct {
-		ID           string
-		Status       string
-		Amount       int64
-		Fee          int64
-		Total        int64
-		ProviderTxID string
-		CreatedAt    time.Time
-		UpdatedAt    time.Time
-	}
-
-	err := row.Scan(&tx.ID, &tx.Status, &tx.Amount, &tx.Fee, &tx.Total, &tx.ProviderTxID, &tx.CreatedAt, &tx.UpdatedAt)
+	var tx models.Transaction
+	var fulfillmentJSON, fulfillmentEncrypted *string
+	err := row.Scan(&tx.ID, &tx.Status, &tx.Amount, &tx.Fee, &tx.Total, &tx.ProviderTxID, &fulfillmentJSON, &fulfillmentEncrypted,
+		&tx.CreatedAt, &tx.UpdatedAt)
 	if err != nil {
 		log.Printf("Error fetching transaction: %v", err)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "transaction not found",
 		})
 	}
+	// The plain fields are still returned when the token cannot be decrypted
+	tx.Fulfillment, err = fulfillment.Open(fulfillmentJSON, fulfillmentEncrypted)
+	if err != nil {
+		log.Printf("Error reading fulfillment of transaction %s: %v", txID, err)
+	}
+
+	return c.JSON(toTransactionResponse(tx))
+}
 
-	return c.JSON(TransactionResponse{
-		ID:           tx.ID,
-		Status:       tx.Status,
-		Amount:       tx.Amount,
-		Fee:          tx.Fee,
-		Total:        tx.Total,
-		ProviderTxID: tx.ProviderTxID,
-		CreatedAt:    tx.CreatedAt,
-		UpdatedAt:    tx.UpdatedAt,
-	})
+func toTransactionResponse(t models.Transaction) TransactionResponse {
+	return TransactionResponse{
+		ID:           t.ID,
+		Status:       t.Status,
+		Amount:       t.Amount,
+		Fee:          t.Fee,
+		Total:        t.Total,
+		ProviderTxID: t.ProviderTxID,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.UpdatedAt,
+		Fulfillment:  t.Fulfillment,
+	}
 }
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CancelTransactionRequest optionally explains a cancellation
+type CancelTransactionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelTransactionResponse is a transaction with the progress of its cancellation
+type CancelTransactionResponse struct {
+	TransactionResponse
+	// CancelState is cancel_pending until the provider confirms the reversal, then cancelled
+	CancelState string `json:"cancel_state"`
+}
+
+// CancelTransaction reverses a paid transaction within its product's reversal window.
+// Repeating the request returns the cancellation as it stands.
+func CancelTransaction(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	txID := c.Params("tx_id")
+	var req CancelTransactionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid request",
+			})
+		}
+	}
+
+	requestedBy := "api_key:" + middleware.APIKeyID(c)
+	res, err := saga.Cancel(context.Background(), tenantID, txID, req.Reason, requestedBy)
+	switch {
+	case errors.Is(err, saga.ErrTransactionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, saga.ErrNotCancellable), errors.Is(err, saga.ErrCancelWindowClosed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil && res.State == models.SagaStateCancelPending, err != nil && res.State == models.SagaStateCancelled:
+		// Left for the recovery worker, which re-sends the cancel or restores the credit
+		log.Printf("Cancellation of transaction %s interrupted in state %s: %v", txID, res.State, err)
+		return c.Status(fiber.StatusAccepted).JSON(CancelTransactionResponse{
+			TransactionResponse: toTransactionResponse(res.Transaction),
+			CancelState:         res.State,
+		})
+	case err != nil:
+		log.Printf("Error cancelling transaction %s: %v", txID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to cancel transaction",
+			"tx_id": txID,
+		})
+	case errors.Is(res.Err, saga.ErrCancelRejected):
+		log.Printf("Provider refused to cancel transaction %s: %v", txID, res.Err)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": saga.ErrCancelRejected.Error(),
+			"tx_id": txID,
+		})
+	}
+
+	resp := CancelTransactionResponse{
+		TransactionResponse: toTransactionResponse(res.Transaction),
+		CancelState:         res.State,
+	}
+	if res.State != models.SagaStateCancelled {
+		return c.Status(fiber.StatusAccepted).JSON(resp)
+	}
+	log.Printf("Transaction %s cancelled by %s", txID, requestedBy)
+	return c.JSON(resp)
+}
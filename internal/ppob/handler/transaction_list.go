@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/search"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TransactionListItem is a transaction in a listing. Fulfillments are left out; they are
+// returned when fetching the transaction itself.
+type TransactionListItem struct {
+	TransactionResponse
+	PartnerID    string `json:"partner_id"`
+	ProductCode  string `json:"product_code"`
+	CustomerNo   string `json:"customer_no"`
+	Provider     string `json:"provider"`
+	CancelReason string `json:"cancel_reason,omitempty"`
+}
+
+// TransactionListResponse is a page of a tenant's transactions
+type TransactionListResponse struct {
+	Transactions []TransactionListItem `json:"transactions"`
+	// NextCursor fetches the following page; it is empty on the last one
+	NextCursor string `json:"next_cursor"`
+	// Totals cover every page of the filter, unless totals=false was asked for
+	Totals *search.Totals `json:"totals,omitempty"`
+}
+
+// transactionStatuses are the statuses a listing can be filtered on
+var transactionStatuses = map[string]bool{
+	models.TxStatusPending:   true,
+	models.TxStatusSuccess:   true,
+	models.TxStatusFailed:    true,
+	models.TxStatusCancelled: true,
+	models.TxStatusSuspect:   true,
+}
+
+// ListTransactions lists a tenant's transactions newest first, filtered by partner_id,
+// status (comma-separated), product_code, provider, customer_no, a from/to date range and
+// a min_amount/max_amount range. Pages are limit long and continue from cursor.
+func ListTransactions(c *fiber.Ctx) error {
+	f, err := transactionFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit := search.DefaultLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > search.MaxLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("limit must be between 1 and %d", search.MaxLimit),
+			})
+		}
+	}
+
+	var after *search.Cursor
+	if v := c.Query("cursor"); v != "" {
+		after, err = search.ParseCursor(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	ctx := context.Background()
+	txs, next, err := search.List(ctx, f, after, limit)
+	if err != nil {
+		log.Printf("Error listing transactions of tenant %s: %v", f.TenantID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list transactions",
+		})
+	}
+
+	resp := TransactionListResponse{Transactions: make([]TransactionListItem, 0, len(txs))}
+	for _, t := range txs {
+		resp.Transactions = append(resp.Transactions, TransactionListItem{
+			TransactionResponse: toTransactionResponse(t),
+			PartnerID:           t.PartnerID,
+			ProductCode:         t.ProductCode,
+			CustomerNo:          t.CustomerNo,
+			Provider:            t.Provider,
+			CancelReason:        t.CancelReason,
+		})
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	if c.QueryBool("totals", true) {
+		totals, err := search.Sum(ctx, f)
+		if err != nil {
+			log.Printf("Error summing transactions of tenant %s: %v", f.TenantID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to list transactions",
+			})
+		}
+		resp.Totals = &totals
+	}
+	return c.JSON(resp)
+}
+
+// transactionFilter reads the filters of a listing from the query string
+func transactionFilter(c *fiber.Ctx) (search.Filter, error) {
+	f := search.Filter{
+		TenantID:    c.Params("tenant"),
+		PartnerID:   c.Query("partner_id"),
+		ProductCode: c.Query("product_code"),
+		Provider:    c.Query("provider"),
+		CustomerNo:  c.Query("customer_no"),
+	}
+
+	if v := c.Query("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if !transactionStatuses[s] {
+				return f, fmt.Errorf("unknown status %q", s)
+			}
+			f.Statuses = append(f.Statuses, s)
+		}
+	}
+
+	var err error
+	if f.From, err = listDate(c.Query("from"), false); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = listDate(c.Query("to"), true); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return f, errors.New("from must be before to")
+	}
+
+	if f.MinAmount, err = listAmount(c.Query("min_amount")); err != nil {
+		return f, fmt.Errorf("invalid min_amount: %w", err)
+	}
+	if f.MaxAmount, err = listAmount(c.Query("max_amount")); err != nil {
+		return f, fmt.Errorf("invalid max_amount: %w", err)
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && *f.MinAmount > *f.MaxAmount {
+		return f, errors.New("min_amount must not exceed max_amount")
+	}
+	return f, nil
+}
+
+// listDate reads an RFC 3339 timestamp or a YYYY-MM-DD date in server time. A date
+// given as the end of a range covers that whole day.
+func listDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		// Timestamps are stored in server wall time
+		t = t.In(time.Local)
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("expected RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// listAmount reads a non-negative amount in rupiah
+func listAmount(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount < 0 {
+		return nil, errors.New("expected a non-negative integer")
+	}
+	return &amount, nil
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// UnsettledTransaction is a suspect transaction with its status-check progress
+type UnsettledTransaction struct {
+	TxID              string     `json:"tx_id"`
+	TenantID          string     `json:"tenant_id"`
+	PartnerID         string     `json:"partner_id"`
+	ProductCode       string     `json:"product_code"`
+	Provider          string     `json:"provider"`
+	Total             int64      `json:"total"`
+	State             string     `json:"state"`
+	StatusChecks      int        `json:"status_checks"`
+	NextStatusCheckAt *time.Time `json:"next_status_check_at"`
+	LastError         *string    `json:"last_error"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// ResolveTransactionRequest settles a suspect transaction by hand
+type ResolveTransactionRequest struct {
+	Status       string `json:"status"`
+	ProviderTxID string `json:"provider_tx_id"`
+	Note         string `json:"note"`
+}
+
+// ListUnsettledTransactions lists suspect transactions, by default those awaiting manual review.
+// The state query parameter selects suspect or manual_review.
+func ListUnsettledTransactions(c *fiber.Ctx) error {
+	state := c.Query("state", models.SagaStateManualReview)
+	if state != models.SagaStateSuspect && state != models.SagaStateManualReview {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "state must be suspect or manual_review",
+		})
+	}
+
+	ctx := context.Background()
+	rows, err := db.Pool.Query(ctx,
+		`SELECT t.id, t.tenant_id, t.partner_id, COALESCE(t.product_code, ''), t.provider, t.total, s.state,
+			s.status_checks, s.next_status_check_at, s.last_error, t.created_at, s.updated_at
+		 FROM transaction_sagas s
+		 JOIN transactions t ON t.id = s.tx_id
+		 WHERE s.state = $1 AND s.finished_at IS NULL AND ($2 = '' OR t.tenant_id = $2)
+		 ORDER BY s.updated_at LIMIT 200`,
+		state, c.Query("tenant_id"))
+	if err != nil {
+		log.Printf("Error querying unsettled transactions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list transactions",
+		})
+	}
+	defer rows.Close()
+
+	transactions := []UnsettledTransaction{}
+	for rows.Next() {
+		var u UnsettledTransaction
+		err := rows.Scan(&u.TxID, &u.TenantID, &u.PartnerID, &u.ProductCode, &u.Provider, &u.Total, &u.State,
+			&u.StatusChecks, &u.NextStatusCheckAt, &u.LastError, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			log.Printf("Error scanning unsettled transaction: %v", err)
+			continue
+		}
+		transactions = append(transactions, u)
+	}
+
+	return c.JSON(fiber.Map{
+		"transactions": transactions,
+		"count":        len(transactions),
+	})
+}
+
+// ResolveTransaction settles a suspect or manual-review transaction as success, capturing
+// its credit, or as failed, releasing it. Operators resolve after confirming with the biller.
+func ResolveTransaction(c *fiber.Ctx) error {
+	txID := c.Params("tx_id")
+	var req ResolveTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if req.Status != models.TxStatusSuccess && req.Status != models.TxStatusFailed {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be success or failed",
+		})
+	}
+
+	adminID := middleware.AdminID(c)
+	note := "by " + adminID
+	if req.Note != "" {
+		note += ": " + req.Note
+	}
+
+	res, err := saga.Resolve(context.Background(), txID, req.Status, req.ProviderTxID, note)
+	if errors.Is(err, saga.ErrNotUnsettled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error resolving transaction %s: %v", txID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to resolve transaction",
+			"tx_id": txID,
+		})
+	}
+
+	log.Printf("Transaction %s resolved as %s by %s", txID, req.Status, adminID)
+	return c.JSON(toTransactionResponse(res.Transaction))
+}
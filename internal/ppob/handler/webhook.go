@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/webhook"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/middleware"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// TenantWebhookRequest sets a tenant's callback URL
+type TenantWebhookRequest struct {
+	URL    string `json:"url"`
+	Active *bool  `json:"active"`
+	// RotateSecret replaces the signing secret; a new webhook always gets one
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// TenantWebhookResponse carries the plaintext secret only when it was just generated
+type TenantWebhookResponse struct {
+	models.TenantWebhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResponse is a delivery with its payload and attempt log
+type WebhookDeliveryResponse struct {
+	models.WebhookDelivery
+	Payload     json.RawMessage                 `json:"payload"`
+	AttemptsLog []models.WebhookDeliveryAttempt `json:"attempts_log"`
+}
+
+// PutTenantWebhook creates or replaces a tenant's webhook URL
+func PutTenantWebhook(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	var req TenantWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "url must be an absolute http or https URL",
+		})
+	}
+
+	ctx := context.Background()
+	var secretEncrypted string
+	err = db.Pool.QueryRow(ctx,
+		"SELECT secret_encrypted FROM tenant_webhooks WHERE tenant_id = $1",
+		tenantID).Scan(&secretEncrypted)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error fetching tenant webhook: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+
+	var plainSecret string
+	if secretEncrypted == "" || req.RotateSecret {
+		plainSecret, err = webhook.GenerateSecret()
+		if err == nil {
+			secretEncrypted, err = webhook.Box.Encrypt([]byte(plainSecret))
+		}
+		if err != nil {
+			log.Printf("Error creating webhook secret: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to create webhook secret",
+			})
+		}
+	}
+
+	now := time.Now()
+	hook := models.TenantWebhook{
+		TenantID:  tenantID,
+		URL:       req.URL,
+		Active:    req.Active == nil || *req.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = db.Pool.QueryRow(ctx,
+		`INSERT INTO tenant_webhooks (tenant_id, url, secret_encrypted, active, created_at, updated_at)
+		 SELECT id, $2, $3, $4, $5, $5 FROM tenants WHERE id = $1
+		 ON CONFLICT (tenant_id) DO UPDATE
+		 SET url = EXCLUDED.url, secret_encrypted = EXCLUDED.secret_encrypted, active = EXCLUDED.active, updated_at = EXCLUDED.updated_at
+		 RETURNING created_at`,
+		hook.TenantID, hook.URL, secretEncrypted, hook.Active, now).Scan(&hook.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tenant not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error saving tenant webhook: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save webhook",
+		})
+	}
+
+	log.Printf("Webhook for tenant %s set to %s by %s (secret rotated: %t)", tenantID, hook.URL, middleware.AdminID(c), plainSecret != "")
+	return c.JSON(TenantWebhookResponse{
+		TenantWebhook: hook,
+		Secret:        plainSecret,
+	})
+}
+
+// GetTenantWebhook returns a tenant's webhook without its secret
+func GetTenantWebhook(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+
+	var hook models.TenantWebhook
+	err := db.Pool.QueryRow(context.Background(),
+		"SELECT tenant_id, url, active, created_at, updated_at FROM tenant_webhooks WHERE tenant_id = $1",
+		tenantID).Scan(&hook.TenantID, &hook.URL, &hook.Active, &hook.CreatedAt, &hook.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook not configured",
+		})
+	}
+	if err != nil {
+		log.Printf("Error fetching tenant webhook: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+	return c.JSON(hook)
+}
+
+// ListWebhookDeliveries lists a tenant's most recent deliveries, optionally filtered by tx_id and status
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+
+	rows, err := db.Pool.Query(context.Background(),
+		`SELECT id, tenant_id, tx_id, event_type, status, attempts, next_attempt_at, last_error, delivered_at, created_at, updated_at
+		 FROM webhook_deliveries
+		 WHERE tenant_id = $1 AND ($2 = '' OR tx_id = $2) AND ($3 = '' OR status = $3)
+		 ORDER BY created_at DESC LIMIT 100`,
+		tenantID, c.Query("tx_id"), c.Query("status"))
+	if err != nil {
+		log.Printf("Error querying webhook deliveries: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list webhook deliveries",
+		})
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.TenantID, &d.TxID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastError, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			log.Printf("Error scanning webhook delivery: %v", err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// GetWebhookDelivery returns a delivery with its payload and every attempt made
+func GetWebhookDelivery(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	deliveryID := c.Params("delivery_id")
+	ctx := context.Background()
+
+	var d models.WebhookDelivery
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, tenant_id, tx_id, event_type, payload_json, status, attempts, next_attempt_at, last_error, delivered_at, created_at, updated_at
+		 FROM webhook_deliveries WHERE id = $1 AND tenant_id = $2`,
+		deliveryID, tenantID).Scan(&d.ID, &d.TenantID, &d.TxID, &d.EventType, &d.PayloadJSON, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastError, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": webhook.ErrDeliveryNotFound.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error fetching webhook delivery: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, delivery_id, attempt, url, status_code, error, duration_ms, created_at
+		 FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id`,
+		deliveryID)
+	if err != nil {
+		log.Printf("Error querying webhook attempts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "database error",
+		})
+	}
+	defer rows.Close()
+
+	resp := WebhookDeliveryResponse{
+		WebhookDelivery: d,
+		Payload:         json.RawMessage(d.PayloadJSON),
+		AttemptsLog:     []models.WebhookDeliveryAttempt{},
+	}
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.URL, &a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt); err != nil {
+			log.Printf("Error scanning webhook attempt: %v", err)
+			continue
+		}
+		resp.AttemptsLog = append(resp.AttemptsLog, a)
+	}
+
+	return c.JSON(resp)
+}
+
+// RedeliverWebhook queues a delivery to be sent again with a fresh set of retries
+func RedeliverWebhook(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant")
+	deliveryID := c.Params("delivery_id")
+
+	err := webhook.Redeliver(context.Background(), tenantID, deliveryID)
+	if errors.Is(err, webhook.ErrDeliveryNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, webhook.ErrDeliveryInProgress) {
+		c.Set(fiber.HeaderRetryAfter, "10")
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error redelivering webhook %s: %v", deliveryID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to redeliver webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status": models.WebhookDeliveryPending,
+		"id":     deliveryID,
+	})
+}
@@ -0,0 +1,458 @@
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/aziz46/core-e-voucher-services/pkg/secret"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Inventory settings, overridable from configuration at startup
+var (
+	// Box encrypts voucher codes and fingerprints them for duplicate detection
+	Box *secret.Box
+	// MaxImportRows bounds the size of one CSV batch
+	MaxImportRows = 50000
+)
+
+// Inventory errors
+var (
+	ErrOutOfStock      = errors.New("no voucher codes in stock")
+	ErrNotAllocated    = errors.New("no voucher code allocated to this transaction")
+	ErrAlreadyRevealed = errors.New("voucher code has already been revealed")
+	ErrNotSettled      = errors.New("transaction has not succeeded")
+	ErrTooManyRows     = errors.New("import has too many rows")
+	ErrEmptyImport     = errors.New("import has no codes")
+)
+
+// expiryLayouts are the accepted expires_at formats of an import
+var expiryLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// ImportRow is one code of a CSV import
+type ImportRow struct {
+	Code      string
+	SerialNo  string
+	ExpiresAt *time.Time
+}
+
+// RowError explains why a CSV line was not imported
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// StockLevel is the stock of one product
+type StockLevel struct {
+	ProductCode       string     `json:"product_code"`
+	Available         int        `json:"available"`
+	Allocated         int        `json:"allocated"`
+	Expired           int        `json:"expired"`
+	LowStockThreshold int        `json:"low_stock_threshold"`
+	LowStock          bool       `json:"low_stock"`
+	NextExpiry        *time.Time `json:"next_expiry"`
+}
+
+// ParseExpiry reads an expires_at value of an import
+func ParseExpiry(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range expiryLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid expires_at %q", value)
+}
+
+// ParseCSV reads an import with the header code,serial_no,expires_at; only code is
+// required. Rows without their own expiry get defaultExpiry. Unusable lines are reported
+// and skipped, and codes repeated within the file are kept once.
+func ParseCSV(r io.Reader, defaultExpiry *time.Time) ([]ImportRow, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, ErrEmptyImport
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	codeCol, ok := cols["code"]
+	if !ok {
+		return nil, nil, errors.New("csv header must include a code column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []ImportRow
+	var invalid []RowError
+	seen := map[string]bool{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			invalid = append(invalid, RowError{Line: line, Error: err.Error()})
+			continue
+		}
+		if codeCol >= len(record) || strings.TrimSpace(record[codeCol]) == "" {
+			invalid = append(invalid, RowError{Line: line, Error: "code is empty"})
+			continue
+		}
+		row := ImportRow{
+			Code:      strings.TrimSpace(record[codeCol]),
+			SerialNo:  field(record, "serial_no"),
+			ExpiresAt: defaultExpiry,
+		}
+		if v := field(record, "expires_at"); v != "" {
+			row.ExpiresAt, err = ParseExpiry(v)
+			if err != nil {
+				invalid = append(invalid, RowError{Line: line, Error: err.Error()})
+				continue
+			}
+		}
+		if seen[row.Code] {
+			invalid = append(invalid, RowError{Line: line, Error: "code repeated in file"})
+			continue
+		}
+		seen[row.Code] = true
+		rows = append(rows, row)
+		if len(rows) > MaxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d", ErrTooManyRows, MaxImportRows)
+		}
+	}
+	if len(rows) == 0 && len(invalid) == 0 {
+		return nil, nil, ErrEmptyImport
+	}
+	return rows, invalid, nil
+}
+
+// Import stores a batch of codes for a product in one transaction. Codes are encrypted,
+// and codes the product already has, in any batch, are counted as duplicates and skipped.
+func Import(ctx context.Context, productCode, supplierRef, importedBy string, rows []ImportRow) (models.VoucherBatch, error) {
+	now := time.Now()
+	batch := models.VoucherBatch{
+		ID:          uuid.New().String(),
+		ProductCode: productCode,
+		ImportedBy:  importedBy,
+		CreatedAt:   now,
+	}
+	if supplierRef != "" {
+		batch.SupplierRef = &supplierRef
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return batch, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO voucher_batches (id, product_code, supplier_ref, imported_by, created_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		batch.ID, batch.ProductCode, batch.SupplierRef, batch.ImportedBy, now)
+	if err != nil {
+		return batch, fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	for _, row := range rows {
+		encrypted, err := Box.Encrypt([]byte(row.Code))
+		if err != nil {
+			return batch, fmt.Errorf("failed to encrypt code: %w", err)
+		}
+		hash, err := Box.Fingerprint([]byte(row.Code))
+		if err != nil {
+			return batch, fmt.Errorf("failed to fingerprint code: %w", err)
+		}
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO voucher_codes (batch_id, product_code, code_encrypted, code_hash, serial_no, expires_at, status, created_at)
+			 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+			 ON CONFLICT (product_code, code_hash) DO NOTHING`,
+			batch.ID, productCode, encrypted, hash, row.SerialNo, row.ExpiresAt, models.VoucherStatusAvailable, now)
+		if err != nil {
+			return batch, fmt.Errorf("failed to store code: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			batch.DuplicateCount++
+			continue
+		}
+		batch.CodeCount++
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE voucher_batches SET code_count = $1, duplicate_count = $2 WHERE id = $3",
+		batch.CodeCount, batch.DuplicateCount, batch.ID)
+	if err != nil {
+		return batch, fmt.Errorf("failed to update batch: %w", err)
+	}
+
+	// A restocked product alerts again the next time it runs low
+	_, err = tx.Exec(ctx,
+		`UPDATE products p SET low_stock_alerted_at = NULL
+		 WHERE p.code = $1 AND p.low_stock_alerted_at IS NOT NULL
+		   AND (SELECT COUNT(*) FROM voucher_codes
+		        WHERE product_code = p.code AND status = $2 AND (expires_at IS NULL OR expires_at > $3)) > p.low_stock_threshold`,
+		productCode, models.VoucherStatusAvailable, now)
+	if err != nil {
+		return batch, fmt.Errorf("failed to reset low-stock alert: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return batch, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return batch, nil
+}
+
+// Allocate assigns the oldest unexpired available code of a product to a transaction.
+// It is idempotent per transaction, and concurrent allocations never share a code. When
+// the product's stock is at or below its low-stock threshold and has not been alerted yet,
+// an inventory.low_stock event is recorded with the allocation.
+func Allocate(ctx context.Context, txID, productCode string) (models.VoucherCode, error) {
+	code, err := Allocated(ctx, txID)
+	if err == nil || !errors.Is(err, ErrNotAllocated) {
+		return code, err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return code, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	code, err = scanCode(tx.QueryRow(ctx,
+		`UPDATE voucher_codes
+		 SET status = $1, tx_id = $2, tenant_id = (SELECT tenant_id FROM transactions WHERE id = $2), allocated_at = $3
+		 WHERE id = (
+		   SELECT id FROM voucher_codes
+		   WHERE product_code = $4 AND status = $5 AND (expires_at IS NULL OR expires_at > $3)
+		   ORDER BY id LIMIT 1
+		   FOR UPDATE SKIP LOCKED)
+		 RETURNING `+codeColumns,
+		models.VoucherStatusAllocated, txID, now, productCode, models.VoucherStatusAvailable))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return code, ErrOutOfStock
+	}
+	if err != nil {
+		return code, fmt.Errorf("failed to allocate code: %w", err)
+	}
+
+	if err := alertLowStock(ctx, tx, productCode, now); err != nil {
+		return code, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return code, fmt.Errorf("failed to commit allocation: %w", err)
+	}
+	return code, nil
+}
+
+// Allocated returns the code allocated to a transaction
+func Allocated(ctx context.Context, txID string) (models.VoucherCode, error) {
+	code, err := scanCode(db.Pool.QueryRow(ctx,
+		`SELECT `+codeColumns+` FROM voucher_codes WHERE tx_id = $1`, txID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return code, ErrNotAllocated
+	}
+	if err != nil {
+		return code, fmt.Errorf("failed to load allocated code: %w", err)
+	}
+	return code, nil
+}
+
+// Release returns a transaction's code to stock, unless the tenant has already seen it.
+// Releasing a transaction without a code does nothing.
+func Release(ctx context.Context, txID string) error {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE voucher_codes SET status = $1, tx_id = NULL, tenant_id = NULL, allocated_at = NULL
+		 WHERE tx_id = $2 AND revealed_at IS NULL`,
+		models.VoucherStatusAvailable, txID)
+	if err != nil {
+		return fmt.Errorf("failed to release code: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	if _, err := Allocated(ctx, txID); err == nil {
+		return ErrAlreadyRevealed
+	} else if !errors.Is(err, ErrNotAllocated) {
+		return err
+	}
+	return nil
+}
+
+// Reveal returns the plaintext code of a tenant's successful transaction. A code is
+// revealed once; later calls get ErrAlreadyRevealed.
+func Reveal(ctx context.Context, tenantID, txID string) (models.VoucherCode, string, error) {
+	now := time.Now()
+	code, err := scanCode(db.Pool.QueryRow(ctx,
+		`UPDATE voucher_codes v SET revealed_at = $1
+		 FROM transactions t
+		 WHERE v.tx_id = $2 AND v.tenant_id = $3 AND v.revealed_at IS NULL
+		   AND t.id = v.tx_id AND t.status = $4
+		 RETURNING `+qualifiedCodeColumns,
+		now, txID, tenantID, models.TxStatusSuccess))
+	if errors.Is(err, pgx.ErrNoRows) {
+		code, err = Allocated(ctx, txID)
+		switch {
+		case errors.Is(err, ErrNotAllocated):
+			return code, "", ErrNotAllocated
+		case err != nil:
+			return code, "", err
+		case code.TenantID == nil || *code.TenantID != tenantID:
+			return models.VoucherCode{}, "", ErrNotAllocated
+		case code.RevealedAt != nil:
+			return code, "", ErrAlreadyRevealed
+		default:
+			return code, "", ErrNotSettled
+		}
+	}
+	if err != nil {
+		return code, "", fmt.Errorf("failed to reveal code: %w", err)
+	}
+
+	plaintext, err := Box.Decrypt(code.CodeEncrypted)
+	if err != nil {
+		return code, "", fmt.Errorf("failed to decrypt code: %w", err)
+	}
+	return code, string(plaintext), nil
+}
+
+// Stock returns the stock of every product with imported codes, or of one product
+func Stock(ctx context.Context, productCode string) ([]StockLevel, error) {
+	now := time.Now()
+	rows, err := db.Pool.Query(ctx,
+		`SELECT p.code,
+		        COUNT(*) FILTER (WHERE v.status = $2 AND (v.expires_at IS NULL OR v.expires_at > $3)),
+		        COUNT(*) FILTER (WHERE v.status = $4),
+		        COUNT(*) FILTER (WHERE v.status = $5 OR (v.status = $2 AND v.expires_at <= $3)),
+		        p.low_stock_threshold,
+		        MIN(v.expires_at) FILTER (WHERE v.status = $2 AND v.expires_at > $3)
+		 FROM products p JOIN voucher_codes v ON v.product_code = p.code
+		 WHERE $1 = '' OR p.code = $1
+		 GROUP BY p.code, p.low_stock_threshold
+		 ORDER BY p.code`,
+		productCode, models.VoucherStatusAvailable, now, models.VoucherStatusAllocated, models.VoucherStatusExpired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stock: %w", err)
+	}
+	defer rows.Close()
+
+	levels := []StockLevel{}
+	for rows.Next() {
+		var l StockLevel
+		if err := rows.Scan(&l.ProductCode, &l.Available, &l.Allocated, &l.Expired, &l.LowStockThreshold, &l.NextExpiry); err != nil {
+			return nil, fmt.Errorf("failed to scan stock: %w", err)
+		}
+		l.LowStock = l.LowStockThreshold > 0 && l.Available <= l.LowStockThreshold
+		levels = append(levels, l)
+	}
+	return levels, rows.Err()
+}
+
+// ExpireCodes marks available codes past their expiry as expired and raises the low-stock
+// alert of every product now at or below its threshold. Checking all products also catches
+// a crossing that concurrent allocations missed, since each counts without the others.
+func ExpireCodes(ctx context.Context) (int64, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	tag, err := tx.Exec(ctx,
+		"UPDATE voucher_codes SET status = $1 WHERE status = $2 AND expires_at <= $3",
+		models.VoucherStatusExpired, models.VoucherStatusAvailable, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire codes: %w", err)
+	}
+	if err := alertLowStock(ctx, tx, "", now); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit expiry: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// alertLowStock records an inventory.low_stock event for the product, or for every product
+// when productCode is empty, whose available stock is at or below its threshold and that has
+// not been alerted since it was last restocked. Setting the marker locks the product row, so
+// concurrent checks raise the alert once.
+func alertLowStock(ctx context.Context, tx pgx.Tx, productCode string, now time.Time) error {
+	rows, err := tx.Query(ctx,
+		`UPDATE products p SET low_stock_alerted_at = $1
+		 FROM (SELECT code, (SELECT COUNT(*) FROM voucher_codes
+		                     WHERE product_code = products.code AND status = $2 AND (expires_at IS NULL OR expires_at > $1)) AS available
+		       FROM products
+		       WHERE low_stock_threshold > 0 AND low_stock_alerted_at IS NULL AND ($3::text = '' OR code = $3)) s
+		 WHERE p.code = s.code AND p.low_stock_alerted_at IS NULL AND s.available <= p.low_stock_threshold
+		 RETURNING p.code, s.available, p.low_stock_threshold`,
+		now, models.VoucherStatusAvailable, productCode)
+	if err != nil {
+		return fmt.Errorf("failed to check low stock: %w", err)
+	}
+	var events []eventbus.InventoryEvent
+	for rows.Next() {
+		var e eventbus.InventoryEvent
+		if err := rows.Scan(&e.ProductCode, &e.Available, &e.Threshold); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan low stock: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check low stock: %w", err)
+	}
+
+	for _, e := range events {
+		if err := outbox.Add(ctx, tx, "product", e.ProductCode, eventbus.InventoryLowStock, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeColumns are the voucher_codes columns read by scanCode
+const codeColumns = `id, batch_id, product_code, code_encrypted, code_hash, serial_no, expires_at, status,
+	tx_id, tenant_id, allocated_at, revealed_at, created_at`
+
+// qualifiedCodeColumns are codeColumns for statements that join voucher_codes as v
+const qualifiedCodeColumns = `v.id, v.batch_id, v.product_code, v.code_encrypted, v.code_hash, v.serial_no, v.expires_at,
+	v.status, v.tx_id, v.tenant_id, v.allocated_at, v.revealed_at, v.created_at`
+
+// scanCode reads a row selected with codeColumns
+func scanCode(row pgx.Row) (models.VoucherCode, error) {
+	var c models.VoucherCode
+	err := row.Scan(&c.ID, &c.BatchID, &c.ProductCode, &c.CodeEncrypted, &c.CodeHash, &c.SerialNo, &c.ExpiresAt,
+		&c.Status, &c.TxID, &c.TenantID, &c.AllocatedAt, &c.RevealedAt, &c.CreatedAt)
+	return c, err
+}
@@ -0,0 +1,168 @@
+package inventory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	defaultExpiry := time.Date(2025, 12, 31, 0, 0, 0, 0, time.Local)
+	ownExpiry := time.Date(2025, 6, 30, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name        string
+		csv         string
+		wantRows    []ImportRow
+		wantInvalid []RowError
+		wantErr     error
+	}{
+		{
+			name: "all columns",
+			csv:  "code,serial_no,expires_at\nAAA-111,SN1,2025-06-30\nBBB-222,SN2,\n",
+			wantRows: []ImportRow{
+				{Code: "AAA-111", SerialNo: "SN1", ExpiresAt: &ownExpiry},
+				{Code: "BBB-222", SerialNo: "SN2", ExpiresAt: &defaultExpiry},
+			},
+		},
+		{
+			name:     "code only, header in any case and order with a BOM",
+			csv:      "\ufeffExpires_At, CODE\n,AAA-111\n",
+			wantRows: []ImportRow{{Code: "AAA-111", ExpiresAt: &defaultExpiry}},
+		},
+		{
+			name:     "values are trimmed",
+			csv:      "code,serial_no\n  AAA-111  ,  SN1 \n",
+			wantRows: []ImportRow{{Code: "AAA-111", SerialNo: "SN1", ExpiresAt: &defaultExpiry}},
+		},
+		{
+			name:     "empty code",
+			csv:      "code,serial_no\n,SN1\nAAA-111,SN2\n",
+			wantRows: []ImportRow{{Code: "AAA-111", SerialNo: "SN2", ExpiresAt: &defaultExpiry}},
+			wantInvalid: []RowError{
+				{Line: 2, Error: "code is empty"},
+			},
+		},
+		{
+			name:     "short line",
+			csv:      "serial_no,code\nSN1\nSN2,AAA-111\n",
+			wantRows: []ImportRow{{Code: "AAA-111", SerialNo: "SN2", ExpiresAt: &defaultExpiry}},
+			wantInvalid: []RowError{
+				{Line: 2, Error: "code is empty"},
+			},
+		},
+		{
+			name:     "invalid expiry",
+			csv:      "code,expires_at\nAAA-111,next year\nBBB-222,2025-06-30\n",
+			wantRows: []ImportRow{{Code: "BBB-222", ExpiresAt: &ownExpiry}},
+			wantInvalid: []RowError{
+				{Line: 2, Error: `invalid expires_at "next year"`},
+			},
+		},
+		{
+			name:     "repeated code",
+			csv:      "code\nAAA-111\nAAA-111\n",
+			wantRows: []ImportRow{{Code: "AAA-111", ExpiresAt: &defaultExpiry}},
+			wantInvalid: []RowError{
+				{Line: 3, Error: "code repeated in file"},
+			},
+		},
+		{
+			name:    "no code column",
+			csv:     "serial_no\nSN1\n",
+			wantErr: errors.New("csv header must include a code column"),
+		},
+		{
+			name:    "empty file",
+			csv:     "",
+			wantErr: ErrEmptyImport,
+		},
+		{
+			name:    "header only",
+			csv:     "code,serial_no\n",
+			wantErr: ErrEmptyImport,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, invalid, err := ParseCSV(strings.NewReader(tt.csv), &defaultExpiry)
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()) {
+					t.Fatalf("ParseCSV() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCSV() error = %v", err)
+			}
+
+			if len(rows) != len(tt.wantRows) {
+				t.Fatalf("rows = %+v, want %+v", rows, tt.wantRows)
+			}
+			for i, want := range tt.wantRows {
+				got := rows[i]
+				if got.Code != want.Code || got.SerialNo != want.SerialNo || !sameTime(got.ExpiresAt, want.ExpiresAt) {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+			}
+
+			if len(invalid) != len(tt.wantInvalid) {
+				t.Fatalf("invalid = %+v, want %+v", invalid, tt.wantInvalid)
+			}
+			for i, want := range tt.wantInvalid {
+				if invalid[i] != want {
+					t.Errorf("invalid %d = %+v, want %+v", i, invalid[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCSVLimitsRows(t *testing.T) {
+	defer func(max int) { MaxImportRows = max }(MaxImportRows)
+	MaxImportRows = 2
+
+	_, _, err := ParseCSV(strings.NewReader("code\nA\nB\nC\n"), nil)
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("ParseCSV() error = %v, want %v", err, ErrTooManyRows)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *time.Time
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "  "},
+		{value: "2025-06-30", want: ptr(time.Date(2025, 6, 30, 0, 0, 0, 0, time.Local))},
+		{value: "2025-06-30 23:59:59", want: ptr(time.Date(2025, 6, 30, 23, 59, 59, 0, time.Local))},
+		{value: "2025-06-30T23:59:59Z", want: ptr(time.Date(2025, 6, 30, 23, 59, 59, 0, time.UTC))},
+		{value: "30/06/2025", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseExpiry(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseExpiry(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !sameTime(got, tt.want) {
+			t.Errorf("ParseExpiry(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
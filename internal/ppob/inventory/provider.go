@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+// Provider fulfills transactions from imported voucher codes instead of a biller. Paying
+// allocates a code to the transaction; cancelling returns it to stock if it is unrevealed.
+type Provider struct {
+	name string
+}
+
+// NewProvider creates an inventory provider named after its provider config
+func NewProvider(name string) *Provider {
+	return &Provider{name: name}
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// Inquiry succeeds while the product has codes in stock
+func (p *Provider) Inquiry(ctx context.Context, request connector.InquiryRequest) (connector.InquiryResponse, error) {
+	var available bool
+	err := db.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM voucher_codes
+		 WHERE product_code = $1 AND status = $2 AND (expires_at IS NULL OR expires_at > $3))`,
+		request.ProductCode, models.VoucherStatusAvailable, time.Now()).Scan(&available)
+	if err != nil {
+		return connector.InquiryResponse{}, fmt.Errorf("%w: failed to check stock: %v", connector.ErrUnavailable, err)
+	}
+	if !available {
+		return connector.InquiryResponse{}, fmt.Errorf("%w: %v", connector.ErrRejected, ErrOutOfStock)
+	}
+	return connector.InquiryResponse{
+		CustomerNo: request.CustomerNo,
+		Status:     connector.StatusSuccess,
+	}, nil
+}
+
+// Pay allocates a code to the transaction; paying the same ref_no again returns the same code
+func (p *Provider) Pay(ctx context.Context, request connector.PayRequest) (connector.PayResponse, error) {
+	code, err := Allocate(ctx, request.RefNo, request.ProductCode)
+	if errors.Is(err, ErrOutOfStock) {
+		return connector.PayResponse{
+			RefNo:   request.RefNo,
+			Status:  connector.StatusFailed,
+			Message: err.Error(),
+		}, fmt.Errorf("%w: %v", connector.ErrRejected, err)
+	}
+	if err != nil {
+		// Nothing was allocated unless the commit itself failed; CheckStatus tells which
+		log.Printf("Error allocating voucher code for %s: %v", request.RefNo, err)
+		return connector.PayResponse{}, err
+	}
+	return connector.PayResponse{
+		RefNo:         request.RefNo,
+		ProviderRefNo: providerRefNo(code),
+		Status:        connector.StatusSuccess,
+		Message:       "voucher code allocated",
+		Fulfillment:   codeFulfillment(code),
+	}, nil
+}
+
+// Cancel returns the transaction's code to stock; a revealed code cannot be taken back
+func (p *Provider) Cancel(ctx context.Context, request connector.CancelRequest) (connector.CancelResponse, error) {
+	err := Release(ctx, request.RefNo)
+	if errors.Is(err, ErrAlreadyRevealed) {
+		return connector.CancelResponse{
+			RefNo:   request.RefNo,
+			Status:  connector.StatusFailed,
+			Message: err.Error(),
+		}, fmt.Errorf("%w: %v", connector.ErrRejected, err)
+	}
+	if err != nil {
+		return connector.CancelResponse{}, fmt.Errorf("%w: %v", connector.ErrUnavailable, err)
+	}
+	return connector.CancelResponse{
+		RefNo:   request.RefNo,
+		Status:  connector.StatusSuccess,
+		Message: "voucher code returned to stock",
+	}, nil
+}
+
+// CheckStatus reports a payment as successful when a code is allocated to it
+func (p *Provider) CheckStatus(ctx context.Context, request connector.StatusRequest) (connector.StatusResponse, error) {
+	code, err := Allocated(ctx, request.RefNo)
+	if errors.Is(err, ErrNotAllocated) {
+		return connector.StatusResponse{
+			RefNo:   request.RefNo,
+			Status:  connector.StatusFailed,
+			Message: err.Error(),
+		}, nil
+	}
+	if err != nil {
+		return connector.StatusResponse{}, fmt.Errorf("%w: %v", connector.ErrUnavailable, err)
+	}
+	return connector.StatusResponse{
+		RefNo:         request.RefNo,
+		ProviderRefNo: providerRefNo(code),
+		Status:        connector.StatusSuccess,
+		Fulfillment:   codeFulfillment(code),
+	}, nil
+}
+
+// codeFulfillment describes an allocated code without the code itself, which is only
+// handed out by Reveal
+func codeFulfillment(code models.VoucherCode) *connector.Fulfillment {
+	f := &connector.Fulfillment{ExpiresAt: code.ExpiresAt}
+	if code.SerialNo != nil {
+		f.SerialNo = *code.SerialNo
+	}
+	return f
+}
+
+// providerRefNo identifies an allocated code by its serial number, or its id without one
+func providerRefNo(code models.VoucherCode) string {
+	if code.SerialNo != nil && *code.SerialNo != "" {
+		return *code.SerialNo
+	}
+	return "VC" + strconv.FormatInt(code.ID, 10)
+}
@@ -0,0 +1,259 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Input is what a fee is priced on
+type Input struct {
+	TenantID    string
+	PartnerID   string
+	ProductCode string
+	// Amount is the requested amount; fixed-denomination products may leave it zero
+	Amount int64
+}
+
+// Breakdown splits what the partner pays into what the provider is paid and what we keep
+type Breakdown struct {
+	ProductCode string `json:"product_code"`
+	Amount      int64  `json:"amount"`
+	Fee         int64  `json:"fee"`
+	Total       int64  `json:"total"`
+	// ProviderCost is the product's base cost, plus the bill itself for products without a denomination
+	ProviderCost int64 `json:"provider_cost"`
+	Margin       int64 `json:"margin"`
+	// FeeRuleID is empty when no rule matched and the catalog fee applied
+	FeeRuleID string `json:"fee_rule_id,omitempty"`
+	RuleType  string `json:"rule_type"`
+	// Volume is the partner's monthly volume a tiered rule was priced on
+	Volume *int64 `json:"volume,omitempty"`
+}
+
+// RuleColumns are the fee_rules columns read by ScanRule
+const RuleColumns = `id, tenant_id, partner_id, product_code, category, rule_type, flat_fee, percent_bps,
+	min_fee, max_fee, tiers_json, priority, active, created_at, updated_at`
+
+// Quote resolves the product and amount like CreateTransaction does and prices the fee.
+// A bill is priced at the amount given, since nothing is charged on a quote.
+func Quote(ctx context.Context, in Input) (Breakdown, error) {
+	entry, err := catalog.Lookup(ctx, in.TenantID, in.PartnerID, in.ProductCode)
+	if err != nil {
+		return Breakdown{}, err
+	}
+	if entry.Bill() {
+		if in.Amount <= 0 {
+			return Breakdown{}, catalog.ErrAmountRequired
+		}
+		return Compute(ctx, in, entry)
+	}
+	amount, err := entry.Amount(in.Amount)
+	if err != nil {
+		return Breakdown{}, err
+	}
+	in.Amount = amount
+	return Compute(ctx, in, entry)
+}
+
+// Compute prices the fee of a resolved amount with the most specific active rule,
+// falling back to the catalog fee of the entry
+func Compute(ctx context.Context, in Input, entry catalog.Entry) (Breakdown, error) {
+	rule, err := matchRule(ctx, in.TenantID, in.PartnerID, entry.Product)
+	if errors.Is(err, pgx.ErrNoRows) {
+		b := Costs(entry, in.Amount, entry.Price.Fee)
+		b.RuleType = models.FeeRuleFlat
+		return b, nil
+	}
+	if err != nil {
+		return Breakdown{}, fmt.Errorf("failed to load fee rule: %w", err)
+	}
+
+	var volume int64
+	if rule.RuleType == models.FeeRuleTiered {
+		volume, err = PartnerVolume(ctx, in.TenantID, in.PartnerID, time.Now())
+		if err != nil {
+			return Breakdown{}, err
+		}
+	}
+
+	b := Costs(entry, in.Amount, Fee(rule, in.Amount, volume))
+	b.FeeRuleID = rule.ID
+	b.RuleType = rule.RuleType
+	if rule.RuleType == models.FeeRuleTiered {
+		b.Volume = &volume
+	}
+	return b, nil
+}
+
+// Costs breaks down an amount charged with a known fee
+func Costs(entry catalog.Entry, amount, fee int64) Breakdown {
+	cost := entry.Product.BaseCost
+	if entry.Product.Denomination == nil {
+		// Bills are passed through to the biller on top of its charge
+		cost += amount
+	}
+	return Breakdown{
+		ProductCode:  entry.Product.Code,
+		Amount:       amount,
+		Fee:          fee,
+		Total:        amount + fee,
+		ProviderCost: cost,
+		Margin:       amount + fee - cost,
+	}
+}
+
+// Fee applies a rule to an amount, bounded by the rule's minimum and maximum.
+// volume only matters for tiered rules.
+func Fee(rule models.FeeRule, amount, volume int64) int64 {
+	var fee int64
+	switch rule.RuleType {
+	case models.FeeRuleFlat:
+		fee = rule.FlatFee
+	case models.FeeRulePercent:
+		fee = percentOf(amount, rule.PercentBps)
+	case models.FeeRuleTiered:
+		if tier, ok := tierFor(rule.Tiers, volume); ok {
+			fee = tier.FlatFee + percentOf(amount, tier.PercentBps)
+		}
+	}
+	if rule.MinFee != nil && fee < *rule.MinFee {
+		fee = *rule.MinFee
+	}
+	if rule.MaxFee != nil && fee > *rule.MaxFee {
+		fee = *rule.MaxFee
+	}
+	return fee
+}
+
+// percentOf returns bps basis points of amount, rounded half up to whole rupiah
+func percentOf(amount int64, bps int) int64 {
+	return (amount*int64(bps) + 5000) / 10000
+}
+
+// tierFor picks the highest tier whose minimum volume has been reached
+func tierFor(tiers []models.FeeTier, volume int64) (models.FeeTier, bool) {
+	var best models.FeeTier
+	found := false
+	for _, t := range tiers {
+		if t.MinVolume <= volume && (!found || t.MinVolume > best.MinVolume) {
+			best = t
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Validate checks that a rule's type has the settings it needs
+func Validate(rule models.FeeRule) error {
+	if rule.FlatFee < 0 || rule.PercentBps < 0 {
+		return errors.New("flat_fee and percent_bps must not be negative")
+	}
+	if (rule.MinFee != nil && *rule.MinFee < 0) || (rule.MaxFee != nil && *rule.MaxFee < 0) {
+		return errors.New("min_fee and max_fee must not be negative")
+	}
+	if rule.MinFee != nil && rule.MaxFee != nil && *rule.MinFee > *rule.MaxFee {
+		return errors.New("min_fee must not exceed max_fee")
+	}
+	if rule.Category != nil && !catalog.Categories[*rule.Category] {
+		return fmt.Errorf("unknown category %s", *rule.Category)
+	}
+
+	switch rule.RuleType {
+	case models.FeeRuleFlat, models.FeeRulePercent:
+		if len(rule.Tiers) > 0 {
+			return fmt.Errorf("tiers only apply to %s rules", models.FeeRuleTiered)
+		}
+	case models.FeeRuleTiered:
+		if len(rule.Tiers) == 0 {
+			return errors.New("tiered rules need at least one tier")
+		}
+		seen := map[int64]bool{}
+		for _, t := range rule.Tiers {
+			if t.MinVolume < 0 || t.FlatFee < 0 || t.PercentBps < 0 {
+				return errors.New("tier values must not be negative")
+			}
+			if seen[t.MinVolume] {
+				return fmt.Errorf("duplicate tier for min_volume %d", t.MinVolume)
+			}
+			seen[t.MinVolume] = true
+		}
+	default:
+		return fmt.Errorf("rule_type must be %s, %s or %s", models.FeeRuleFlat, models.FeeRulePercent, models.FeeRuleTiered)
+	}
+	return nil
+}
+
+// SortTiers orders tiers by minimum volume for storage and display
+func SortTiers(tiers []models.FeeTier) {
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinVolume < tiers[j].MinVolume })
+}
+
+// MarshalTiers encodes tiers for tiers_json, empty for rules without tiers
+func MarshalTiers(tiers []models.FeeTier) (string, error) {
+	if len(tiers) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(tiers)
+	return string(b), err
+}
+
+// Location is the reporting timezone whose calendar months volumes are counted in,
+// set from SERVER_TIMEZONE at startup
+var Location = time.Local
+
+// PartnerVolume sums a partner's successful transaction amounts in the calendar month of now,
+// in Location
+func PartnerVolume(ctx context.Context, tenantID, partnerID string, now time.Time) (int64, error) {
+	now = now.In(Location)
+	// created_at holds server wall time, so the month start is compared in it
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, Location).In(time.Local)
+	var volume int64
+	err := db.Pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM transactions
+		 WHERE tenant_id = $1 AND partner_id = $2 AND status = $3 AND created_at >= $4`,
+		tenantID, partnerID, models.TxStatusSuccess, since).Scan(&volume)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum partner volume: %w", err)
+	}
+	return volume, nil
+}
+
+// matchRule finds the most specific active rule: partner before tenant-wide, then
+// product before category before any product, then by priority
+func matchRule(ctx context.Context, tenantID, partnerID string, product models.Product) (models.FeeRule, error) {
+	return ScanRule(db.Pool.QueryRow(ctx,
+		`SELECT `+RuleColumns+` FROM fee_rules
+		 WHERE tenant_id = $1 AND active = true
+		   AND (partner_id IS NULL OR partner_id = $2)
+		   AND (product_code IS NULL OR product_code = $3)
+		   AND (category IS NULL OR category = $4)
+		 ORDER BY partner_id IS NULL, product_code IS NULL, category IS NULL, priority, created_at
+		 LIMIT 1`,
+		tenantID, partnerID, product.Code, product.Category))
+}
+
+// ScanRule reads a row selected with RuleColumns
+func ScanRule(row pgx.Row) (models.FeeRule, error) {
+	var r models.FeeRule
+	var tiers *string
+	err := row.Scan(&r.ID, &r.TenantID, &r.PartnerID, &r.ProductCode, &r.Category, &r.RuleType, &r.FlatFee,
+		&r.PercentBps, &r.MinFee, &r.MaxFee, &tiers, &r.Priority, &r.Active, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return r, err
+	}
+	if tiers != nil && *tiers != "" {
+		if err := json.Unmarshal([]byte(*tiers), &r.Tiers); err != nil {
+			return r, fmt.Errorf("invalid tiers in fee rule %s: %w", r.ID, err)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,211 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+var volumeTiers = []models.FeeTier{
+	{MinVolume: 0, FlatFee: 2500},
+	{MinVolume: 10_000_000, FlatFee: 2000},
+	{MinVolume: 50_000_000, FlatFee: 1000, PercentBps: 10},
+}
+
+func TestFee(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   models.FeeRule
+		amount int64
+		volume int64
+		want   int64
+	}{
+		{
+			name:   "flat",
+			rule:   models.FeeRule{RuleType: models.FeeRuleFlat, FlatFee: 2500},
+			amount: 100000,
+			want:   2500,
+		},
+		{
+			name:   "percent",
+			rule:   models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 150},
+			amount: 100000,
+			want:   1500,
+		},
+		{
+			name:   "percent rounds half up",
+			rule:   models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 125},
+			amount: 1000,
+			want:   13,
+		},
+		{
+			name:   "percent rounds down below half",
+			rule:   models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 124},
+			amount: 1000,
+			want:   12,
+		},
+		{
+			name:   "percent raised to minimum",
+			rule:   models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 100, MinFee: int64Ptr(1000)},
+			amount: 20000,
+			want:   1000,
+		},
+		{
+			name:   "percent capped at maximum",
+			rule:   models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 100, MaxFee: int64Ptr(5000)},
+			amount: 1_000_000,
+			want:   5000,
+		},
+		{
+			name:   "lowest tier",
+			rule:   models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: volumeTiers},
+			amount: 100000,
+			volume: 9_999_999,
+			want:   2500,
+		},
+		{
+			name:   "tier reached exactly",
+			rule:   models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: volumeTiers},
+			amount: 100000,
+			volume: 10_000_000,
+			want:   2000,
+		},
+		{
+			name:   "highest tier adds its percentage",
+			rule:   models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: volumeTiers},
+			amount: 100000,
+			volume: 80_000_000,
+			want:   1100,
+		},
+		{
+			name:   "no tier reached",
+			rule:   models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: []models.FeeTier{{MinVolume: 1000, FlatFee: 500}}},
+			amount: 100000,
+			volume: 999,
+			want:   0,
+		},
+		{
+			name:   "no tier reached still gets the minimum",
+			rule:   models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: []models.FeeTier{{MinVolume: 1000, FlatFee: 500}}, MinFee: int64Ptr(300)},
+			amount: 100000,
+			volume: 0,
+			want:   300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fee(tt.rule, tt.amount, tt.volume); got != tt.want {
+				t.Errorf("Fee() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	// Tiers are matched whatever order they are stored in
+	unsorted := []models.FeeTier{volumeTiers[2], volumeTiers[0], volumeTiers[1]}
+
+	tests := []struct {
+		name      string
+		tiers     []models.FeeTier
+		volume    int64
+		wantMin   int64
+		wantFound bool
+	}{
+		{name: "no tiers", volume: 100},
+		{name: "below every tier", tiers: []models.FeeTier{{MinVolume: 1}}, volume: 0},
+		{name: "first tier", tiers: unsorted, volume: 0, wantMin: 0, wantFound: true},
+		{name: "middle tier", tiers: unsorted, volume: 49_999_999, wantMin: 10_000_000, wantFound: true},
+		{name: "top tier", tiers: unsorted, volume: 50_000_000, wantMin: 50_000_000, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier, found := tierFor(tt.tiers, tt.volume)
+			if found != tt.wantFound {
+				t.Fatalf("tierFor() found = %v, want %v", found, tt.wantFound)
+			}
+			if found && tier.MinVolume != tt.wantMin {
+				t.Errorf("tierFor() = %+v, want the tier from %d", tier, tt.wantMin)
+			}
+		})
+	}
+}
+
+func TestCosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		product models.Product
+		amount  int64
+		fee     int64
+		want    Breakdown
+	}{
+		{
+			name:    "denomination",
+			product: models.Product{Code: "PULSA_TSEL_50", Denomination: int64Ptr(50000), BaseCost: 49500},
+			amount:  50000,
+			fee:     1000,
+			want:    Breakdown{ProductCode: "PULSA_TSEL_50", Amount: 50000, Fee: 1000, Total: 51000, ProviderCost: 49500, Margin: 1500},
+		},
+		{
+			name:    "bill passes the amount through",
+			product: models.Product{Code: "PLN_POSTPAID", BaseCost: 1500},
+			amount:  250000,
+			fee:     2500,
+			want:    Breakdown{ProductCode: "PLN_POSTPAID", Amount: 250000, Fee: 2500, Total: 252500, ProviderCost: 251500, Margin: 1000},
+		},
+		{
+			name:    "negative margin",
+			product: models.Product{Code: "PLN_PREPAID", Denomination: int64Ptr(50000), BaseCost: 50500},
+			amount:  50000,
+			want:    Breakdown{ProductCode: "PLN_PREPAID", Amount: 50000, Total: 50000, ProviderCost: 50500, Margin: -500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Costs(catalog.Entry{Product: tt.product}, tt.amount, tt.fee)
+			if got.ProductCode != tt.want.ProductCode || got.Amount != tt.want.Amount || got.Fee != tt.want.Fee ||
+				got.Total != tt.want.Total || got.ProviderCost != tt.want.ProviderCost || got.Margin != tt.want.Margin {
+				t.Errorf("Costs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	category := models.ProductCategoryPulsa
+	unknown := "lottery"
+
+	tests := []struct {
+		name    string
+		rule    models.FeeRule
+		wantErr bool
+	}{
+		{name: "flat", rule: models.FeeRule{RuleType: models.FeeRuleFlat, FlatFee: 1000, Category: &category}},
+		{name: "percent with bounds", rule: models.FeeRule{RuleType: models.FeeRulePercent, PercentBps: 100, MinFee: int64Ptr(500), MaxFee: int64Ptr(5000)}},
+		{name: "tiered", rule: models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: volumeTiers}},
+		{name: "unknown type", rule: models.FeeRule{RuleType: "sliding"}, wantErr: true},
+		{name: "negative flat fee", rule: models.FeeRule{RuleType: models.FeeRuleFlat, FlatFee: -1}, wantErr: true},
+		{name: "minimum above maximum", rule: models.FeeRule{RuleType: models.FeeRulePercent, MinFee: int64Ptr(5000), MaxFee: int64Ptr(500)}, wantErr: true},
+		{name: "unknown category", rule: models.FeeRule{RuleType: models.FeeRuleFlat, Category: &unknown}, wantErr: true},
+		{name: "tiers on a flat rule", rule: models.FeeRule{RuleType: models.FeeRuleFlat, Tiers: volumeTiers}, wantErr: true},
+		{name: "tiered without tiers", rule: models.FeeRule{RuleType: models.FeeRuleTiered}, wantErr: true},
+		{name: "duplicate tier", rule: models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: []models.FeeTier{{MinVolume: 0}, {MinVolume: 0}}}, wantErr: true},
+		{name: "negative tier", rule: models.FeeRule{RuleType: models.FeeRuleTiered, Tiers: []models.FeeTier{{MinVolume: -1}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
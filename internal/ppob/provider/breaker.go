@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+// BreakerStatus is the breaker of one provider config as seen by this process
+type BreakerStatus struct {
+	ProviderConfigID string `json:"provider_config_id"`
+	TenantID         string `json:"tenant_id"`
+	ProviderName     string `json:"provider_name"`
+	Priority         int    `json:"priority"`
+	Active           bool   `json:"active"`
+	connector.BreakerSnapshot
+}
+
+// breakers holds one breaker per provider config ID. State is per process: each replica
+// opens its own breakers from the failures it sees.
+var breakers = struct {
+	sync.Mutex
+	m map[string]*connector.Breaker
+}{m: make(map[string]*connector.Breaker)}
+
+// breakerFor returns the breaker of a provider config, applying its current thresholds
+func breakerFor(cfg models.ProviderConfig) *connector.Breaker {
+	bc := connector.BreakerConfig{
+		FailureThreshold: cfg.BreakerFailureThreshold,
+		OpenTimeout:      time.Duration(cfg.BreakerOpenTimeoutMs) * time.Millisecond,
+		HalfOpenMax:      cfg.BreakerHalfOpenMax,
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	b, ok := breakers.m[cfg.ID]
+	if !ok {
+		b = connector.NewBreaker(bc)
+		breakers.m[cfg.ID] = b
+		return b
+	}
+	b.SetConfig(bc)
+	return b
+}
+
+// Breakers returns the breaker state of every provider config, optionally for one tenant
+func Breakers(ctx context.Context, tenantID string) ([]BreakerStatus, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+configColumns+` FROM provider_configs
+		 WHERE $1 = '' OR tenant_id = $1
+		 ORDER BY tenant_id, priority, created_at`,
+		tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider configs: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := []BreakerStatus{}
+	for rows.Next() {
+		cfg, err := scanConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan provider config: %w", err)
+		}
+		statuses = append(statuses, BreakerStatus{
+			ProviderConfigID: cfg.ID,
+			TenantID:         cfg.TenantID,
+			ProviderName:     cfg.ProviderName,
+			Priority:         cfg.Priority,
+			Active:           cfg.Active,
+			BreakerSnapshot:  breakerFor(cfg).Snapshot(),
+		})
+	}
+	return statuses, rows.Err()
+}
@@ -0,0 +1,252 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/inventory"
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+// Routing errors
+var (
+	ErrNoProvider        = errors.New("no active provider configured")
+	ErrNoHealthyProvider = errors.New("every configured provider has an open circuit breaker")
+)
+
+// Box decrypts creds_encrypted, set from configuration at startup
+var Box *secret.Box
+
+// RetryPolicy applies to every resolved provider, overridable from configuration at startup
+var RetryPolicy = connector.DefaultRetryPolicy
+
+// Credentials is the decrypted creds_encrypted JSON of an HTTP provider
+type Credentials struct {
+	APIKey string `json:"api_key"`
+	Secret string `json:"secret"`
+}
+
+// configColumns are the provider_configs columns read by scanConfig
+const configColumns = `id, tenant_id, provider_name, adapter, endpoint, creds_encrypted, timeout_ms, status_map_json,
+	priority, product_codes, breaker_failure_threshold, breaker_open_timeout_ms, breaker_half_open_max, active, created_at`
+
+// Route picks the provider for a tenant's product: the highest-priority active config
+// covering the product whose circuit breaker lets calls through. When the primary's
+// breaker is open, traffic fails over to the next config.
+func Route(ctx context.Context, tenantID, productCode string) (connector.Provider, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+configColumns+` FROM provider_configs
+		 WHERE tenant_id = $1 AND active = true AND (product_codes IS NULL OR $2 = ANY(product_codes))
+		 ORDER BY priority, created_at`,
+		tenantID, productCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider configs: %w", err)
+	}
+
+	var configs []models.ProviderConfig
+	for rows.Next() {
+		cfg, err := scanConfig(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan provider config: %w", err)
+		}
+		configs = append(configs, cfg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read provider configs: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, ErrNoProvider
+	}
+
+	for _, cfg := range configs {
+		if !breakerFor(cfg).Available() {
+			continue
+		}
+		p, err := build(cfg)
+		if err != nil {
+			log.Printf("Skipping provider config %s: %v", cfg.ID, err)
+			continue
+		}
+		return p, nil
+	}
+	return nil, ErrNoHealthyProvider
+}
+
+// Lookup returns a tenant's provider by name, active or not, so that a transaction
+// is always completed with the provider it was routed to
+func Lookup(ctx context.Context, tenantID, providerName string) (connector.Provider, error) {
+	cfg, err := scanConfig(db.Pool.QueryRow(ctx,
+		`SELECT `+configColumns+` FROM provider_configs WHERE tenant_id = $1 AND provider_name = $2`,
+		tenantID, providerName))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoProvider
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider config: %w", err)
+	}
+	return build(cfg)
+}
+
+// scanConfig reads a row selected with configColumns
+func scanConfig(row pgx.Row) (models.ProviderConfig, error) {
+	var cfg models.ProviderConfig
+	var endpoint, creds, statusMap *string
+	err := row.Scan(&cfg.ID, &cfg.TenantID, &cfg.ProviderName, &cfg.Adapter, &endpoint, &creds,
+		&cfg.TimeoutMs, &statusMap, &cfg.Priority, &cfg.ProductCodes, &cfg.BreakerFailureThreshold,
+		&cfg.BreakerOpenTimeoutMs, &cfg.BreakerHalfOpenMax, &cfg.Active, &cfg.CreatedAt)
+	if err != nil {
+		return cfg, err
+	}
+	if endpoint != nil {
+		cfg.Endpoint = *endpoint
+	}
+	if creds != nil {
+		cfg.CredsEncrypted = *creds
+	}
+	if statusMap != nil {
+		cfg.StatusMapJSON = *statusMap
+	}
+	return cfg, nil
+}
+
+// connectors caches the connector built for each provider config ID, so that an HTTP provider's
+// client and its connections are reused across calls
+var connectors = struct {
+	sync.Mutex
+	m map[string]cachedConnector
+}{m: make(map[string]cachedConnector)}
+
+type cachedConnector struct {
+	key      connectorKey
+	provider connector.Provider
+}
+
+// connectorKey holds the columns a connector is built from; when any of them changes the
+// connector is rebuilt. Breaker thresholds are applied on every call instead.
+type connectorKey struct {
+	providerName   string
+	adapter        string
+	endpoint       string
+	credsEncrypted string
+	timeoutMs      int
+	statusMapJSON  string
+}
+
+// build returns a config's connector with retries whose attempts are recorded against the
+// transaction. Each attempt passes the circuit breaker, so breaker_failure_threshold counts
+// failed calls rather than failed retry series, and retries stop once the breaker opens.
+func build(cfg models.ProviderConfig) (connector.Provider, error) {
+	breaker := breakerFor(cfg)
+	key := connectorKey{
+		providerName:   cfg.ProviderName,
+		adapter:        cfg.Adapter,
+		endpoint:       cfg.Endpoint,
+		credsEncrypted: cfg.CredsEncrypted,
+		timeoutMs:      cfg.TimeoutMs,
+		statusMapJSON:  cfg.StatusMapJSON,
+	}
+
+	connectors.Lock()
+	defer connectors.Unlock()
+
+	if c, ok := connectors.m[cfg.ID]; ok && c.key == key {
+		return c.provider, nil
+	}
+	p, err := Build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := cachedConnector{
+		key:      key,
+		provider: connector.NewRetrying(connector.NewGuarded(p, breaker), RetryPolicy, recordAttempt),
+	}
+	connectors.m[cfg.ID] = c
+	return c.provider, nil
+}
+
+// recordAttempt stores a provider call made for a transaction; inquiries have no transaction yet.
+// It does not use the call's context so that attempts cut short by a deadline are still recorded.
+func recordAttempt(_ context.Context, a connector.Attempt) {
+	if a.RefNo == "" {
+		if a.Err != nil {
+			log.Printf("Provider %s %s attempt %d failed (%s): %v", a.Provider, a.Operation, a.Number, a.Class, a.Err)
+		}
+		return
+	}
+
+	var errMsg string
+	if a.Err != nil {
+		errMsg = a.Err.Error()
+	}
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO transaction_provider_attempts (tx_id, provider, operation, attempt, status, error_class, error, duration_ms, created_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9)`,
+		a.RefNo, a.Provider, a.Operation, a.Number, a.Status, string(a.Class), errMsg, a.Duration.Milliseconds(), time.Now())
+	if err != nil {
+		log.Printf("Error recording provider attempt for %s: %v", a.RefNo, err)
+	}
+}
+
+// Build creates the connector described by a provider config
+func Build(cfg models.ProviderConfig) (connector.Provider, error) {
+	switch cfg.Adapter {
+	case models.ProviderAdapterMock:
+		return connector.NewMockProvider(0).WithName(cfg.ProviderName), nil // 0% failure rate for demo
+
+	case models.ProviderAdapterHTTP:
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("provider config %s has no endpoint", cfg.ID)
+		}
+
+		var creds Credentials
+		if cfg.CredsEncrypted != "" {
+			plaintext, err := Box.Decrypt(cfg.CredsEncrypted)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt credentials of provider config %s: %w", cfg.ID, err)
+			}
+			if err := json.Unmarshal(plaintext, &creds); err != nil {
+				return nil, fmt.Errorf("invalid credentials in provider config %s: %w", cfg.ID, err)
+			}
+		}
+
+		var statusMap map[string]string
+		if cfg.StatusMapJSON != "" {
+			if err := json.Unmarshal([]byte(cfg.StatusMapJSON), &statusMap); err != nil {
+				return nil, fmt.Errorf("invalid status map in provider config %s: %w", cfg.ID, err)
+			}
+			for rc, status := range statusMap {
+				switch status {
+				case connector.StatusSuccess, connector.StatusFailed, connector.StatusPending:
+				default:
+					return nil, fmt.Errorf("provider config %s maps rc %s to unknown status %q", cfg.ID, rc, status)
+				}
+			}
+		}
+
+		return connector.NewHTTPProvider(connector.HTTPConfig{
+			Name:      cfg.ProviderName,
+			Endpoint:  cfg.Endpoint,
+			APIKey:    creds.APIKey,
+			Secret:    creds.Secret,
+			Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+			StatusMap: statusMap,
+		}), nil
+
+	case models.ProviderAdapterInventory:
+		return inventory.NewProvider(cfg.ProviderName), nil
+
+	default:
+		return nil, fmt.Errorf("provider config %s has unknown adapter %q", cfg.ID, cfg.Adapter)
+	}
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+func testConfig(id string) models.ProviderConfig {
+	return models.ProviderConfig{
+		ID:                      id,
+		TenantID:                "tenant_001",
+		ProviderName:            "mock_" + id,
+		Adapter:                 models.ProviderAdapterMock,
+		TimeoutMs:               10000,
+		BreakerFailureThreshold: 5,
+		BreakerOpenTimeoutMs:    30000,
+		BreakerHalfOpenMax:      1,
+	}
+}
+
+func TestBuildReusesConnector(t *testing.T) {
+	cfg := testConfig("cache-reuse")
+
+	first, err := build(cfg)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	// Breaker thresholds are not part of the connector
+	cfg.BreakerFailureThreshold = 2
+	second, err := build(cfg)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	if first != second {
+		t.Error("build() rebuilt the connector of an unchanged config")
+	}
+}
+
+func TestBuildRebuildsChangedConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *models.ProviderConfig)
+	}{
+		{name: "endpoint", change: func(cfg *models.ProviderConfig) { cfg.Endpoint = "http://biller.local" }},
+		{name: "credentials", change: func(cfg *models.ProviderConfig) { cfg.CredsEncrypted = "rotated" }},
+		{name: "timeout", change: func(cfg *models.ProviderConfig) { cfg.TimeoutMs = 5000 }},
+		{name: "status map", change: func(cfg *models.ProviderConfig) { cfg.StatusMapJSON = `{"00":"success"}` }},
+		{name: "name", change: func(cfg *models.ProviderConfig) { cfg.ProviderName = "renamed" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("cache-" + tt.name)
+			first, err := build(cfg)
+			if err != nil {
+				t.Fatalf("build() error = %v", err)
+			}
+			tt.change(&cfg)
+			second, err := build(cfg)
+			if err != nil {
+				t.Fatalf("build() error = %v", err)
+			}
+			if first == second {
+				t.Error("build() kept the connector of a changed config")
+			}
+		})
+	}
+}
+
+func TestBuildSharesBreakerAcrossRebuilds(t *testing.T) {
+	cfg := testConfig("cache-breaker")
+	if _, err := build(cfg); err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	before := breakerFor(cfg)
+	cfg.Endpoint = "http://biller.local"
+	if _, err := build(cfg); err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	if breakerFor(cfg) != before {
+		t.Error("rebuilding the connector replaced its breaker")
+	}
+}
@@ -0,0 +1,201 @@
+package receipt
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+// Receipt widths in characters: 32 fits a 58mm thermal printer, 48 the PDF page
+const (
+	ThermalWidth = 32
+	pdfWidth     = 48
+)
+
+// Data is everything a receipt shows
+type Data struct {
+	Branding     models.TenantBranding
+	TxID         string
+	PartnerName  string
+	ProductName  string
+	CustomerNo   string
+	Amount       int64
+	Fee          int64
+	Total        int64
+	ProviderTxID string
+	CreatedAt    time.Time
+	Fulfillment  *connector.Fulfillment
+}
+
+// line is one line of a receipt; bold lines are emphasized where the format allows
+type line struct {
+	text string
+	bold bool
+}
+
+// layout is a monospaced receipt of the given width
+type layout struct {
+	width int
+	lines []line
+}
+
+// Text renders the receipt for a thermal printer, width characters wide
+func Text(d Data, width int) []byte {
+	var b strings.Builder
+	for _, l := range build(d, width) {
+		b.WriteString(l.text)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// build lays out a receipt: tenant header, transaction details, amounts, what the customer
+// received, and the tenant's footer
+func build(d Data, width int) []line {
+	l := &layout{width: width}
+
+	l.center(strings.ToUpper(d.Branding.DisplayName), true)
+	if d.Branding.Address != nil {
+		l.center(*d.Branding.Address, false)
+	}
+	if d.Branding.Phone != nil {
+		l.center("Telp "+*d.Branding.Phone, false)
+	}
+	l.rule()
+	l.center("STRUK PEMBAYARAN", true)
+	l.rule()
+
+	l.pair("Tanggal", d.CreatedAt.Format("02-01-2006 15:04:05"), false)
+	l.pair("No. Ref", d.TxID, false)
+	l.pair("Produk", d.ProductName, false)
+	l.pair("No. Pelanggan", d.CustomerNo, false)
+	f := d.Fulfillment
+	if f != nil && f.CustomerName != "" {
+		l.pair("Nama", f.CustomerName, false)
+	}
+	if d.PartnerName != "" {
+		l.pair("Mitra", d.PartnerName, false)
+	}
+	l.rule()
+
+	l.pair("Harga", rupiah(d.Amount), false)
+	l.pair("Biaya Admin", rupiah(d.Fee), false)
+	l.pair("TOTAL", rupiah(d.Total), true)
+
+	if f != nil && (f.Token != "" || f.SerialNo != "" || f.KWh != "" || f.Tariff != "" || f.ExpiresAt != nil) {
+		l.rule()
+		if f.Token != "" {
+			l.center("TOKEN", true)
+			l.center(f.Token, true)
+		}
+		if f.KWh != "" {
+			l.pair("kWh", f.KWh, false)
+		}
+		if f.Tariff != "" {
+			l.pair("Tarif/Daya", f.Tariff, false)
+		}
+		if f.SerialNo != "" {
+			l.pair("SN", f.SerialNo, false)
+		}
+		if f.ExpiresAt != nil {
+			l.pair("Berlaku s/d", f.ExpiresAt.Format("02-01-2006"), false)
+		}
+	} else if d.ProviderTxID != "" {
+		l.rule()
+		l.pair("SN", d.ProviderTxID, false)
+	}
+
+	l.rule()
+	footer := "Terima kasih"
+	if d.Branding.Footer != nil && *d.Branding.Footer != "" {
+		footer = *d.Branding.Footer
+	}
+	l.center(footer, false)
+	return l.lines
+}
+
+// center adds text centered, wrapping it at word boundaries
+func (l *layout) center(text string, bold bool) {
+	for _, part := range wrap(text, l.width) {
+		pad := (l.width - utf8.RuneCountInString(part)) / 2
+		l.lines = append(l.lines, line{text: strings.Repeat(" ", pad) + part, bold: bold})
+	}
+}
+
+// pair adds a label with its value right-aligned, moving the value to lines of its own
+// when both do not fit
+func (l *layout) pair(label, value string, bold bool) {
+	gap := l.width - utf8.RuneCountInString(label) - utf8.RuneCountInString(value)
+	if gap >= 1 {
+		l.lines = append(l.lines, line{text: label + strings.Repeat(" ", gap) + value, bold: bold})
+		return
+	}
+	l.lines = append(l.lines, line{text: label, bold: bold})
+	for _, part := range chunk(value, l.width) {
+		pad := l.width - utf8.RuneCountInString(part)
+		l.lines = append(l.lines, line{text: strings.Repeat(" ", pad) + part, bold: bold})
+	}
+}
+
+// rule adds a separator
+func (l *layout) rule() {
+	l.lines = append(l.lines, line{text: strings.Repeat("-", l.width)})
+}
+
+// wrap breaks text into lines of at most width characters at spaces, splitting longer words
+func wrap(text string, width int) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		for _, part := range chunk(word, width) {
+			switch {
+			case current == "":
+				current = part
+			case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(part) <= width:
+				current += " " + part
+			default:
+				lines = append(lines, current)
+				current = part
+			}
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// chunk splits s into pieces of at most width characters
+func chunk(s string, width int) []string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return []string{s}
+	}
+	var parts []string
+	for len(runes) > width {
+		parts = append(parts, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(parts, string(runes))
+}
+
+// rupiah formats an amount as "Rp 52.500"
+func rupiah(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	var b strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	return sign + "Rp " + b.String()
+}
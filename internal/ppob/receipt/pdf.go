@@ -0,0 +1,78 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PDF page metrics in points. Courier is monospaced, so the text layout is reused as is.
+const (
+	pdfMargin   = 24.0
+	pdfFontSize = 9.0
+	pdfLeading  = 12.0
+	// pdfCharWidth is the advance of every Courier glyph at pdfFontSize
+	pdfCharWidth = 0.6 * pdfFontSize
+)
+
+// PDF renders the receipt as a single-page PDF sized to its content
+func PDF(d Data) []byte {
+	lines := build(d, pdfWidth)
+	width := 2*pdfMargin + pdfWidth*pdfCharWidth
+	height := 2*pdfMargin + float64(len(lines))*pdfLeading
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT\n%.1f TL\n%.1f %.1f Td\n", pdfLeading, pdfMargin, height-pdfMargin-pdfFontSize)
+	for _, l := range lines {
+		font := "F1"
+		if l.bold {
+			font = "F2"
+		}
+		fmt.Fprintf(&content, "/%s %.1f Tf (%s) Tj T*\n", font, pdfFontSize, pdfString(l.text))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.1f %.1f] "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>", width, height),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString escapes text for a PDF literal string in WinAnsiEncoding; characters the
+// standard fonts cannot show become '?'
+func pdfString(text string) string {
+	var b bytes.Buffer
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package receipt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/fulfillment"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/aziz46/core-e-voucher-services/pkg/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// Consumer is the consumer name under which ppob-core renders receipts
+const Consumer = "ppob.receipts"
+
+// Receipt formats and their content types
+const (
+	FormatPDF  = "pdf"
+	FormatText = "text"
+
+	ContentTypePDF  = "application/pdf"
+	ContentTypeText = "text/plain; charset=utf-8"
+)
+
+// Receipt settings, set from configuration at startup
+var (
+	// Store holds rendered receipts
+	Store storage.Store
+	// URLTTL is how long a signed download URL stays valid
+	URLTTL = 15 * time.Minute
+)
+
+// Receipt errors
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrNotPaid             = errors.New("receipts are only issued for successful transactions")
+)
+
+// Querier is satisfied by both the pool and a transaction
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Subscribe renders a receipt for every successful transaction
+func Subscribe(ctx context.Context, bus eventbus.Bus) error {
+	return bus.Subscribe(ctx, Consumer, []string{eventbus.TransactionSucceeded},
+		outbox.Idempotent(Consumer, func(ctx context.Context, tx pgx.Tx, event eventbus.Event) error {
+			var payload eventbus.TransactionEvent
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				return eventbus.Permanent(fmt.Errorf("failed to decode transaction event: %w", err))
+			}
+			_, err := Generate(ctx, tx, payload.TxID)
+			// Cancelled before the event was handled: there is nothing left to prove
+			if errors.Is(err, ErrNotPaid) {
+				return nil
+			}
+			// The event is published with the transaction, so it will not appear later
+			if errors.Is(err, ErrTransactionNotFound) {
+				return eventbus.Permanent(err)
+			}
+			return err
+		}))
+}
+
+// Find returns the receipt of a tenant's successful transaction, rendering it if the
+// event has not been handled yet or the transaction predates receipts
+func Find(ctx context.Context, tenantID, txID string) (models.Receipt, error) {
+	var r models.Receipt
+	var status string
+	var hasReceipt bool
+	err := db.Pool.QueryRow(ctx,
+		`SELECT t.status, r.tx_id IS NOT NULL, COALESCE(r.pdf_key, ''), COALESCE(r.text_key, ''), COALESCE(r.created_at, t.created_at)
+		 FROM transactions t LEFT JOIN receipts r ON r.tx_id = t.id
+		 WHERE t.id = $1 AND t.tenant_id = $2`,
+		txID, tenantID).Scan(&status, &hasReceipt, &r.PDFKey, &r.TextKey, &r.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r, ErrTransactionNotFound
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to load receipt: %w", err)
+	}
+	if status != models.TxStatusSuccess {
+		return r, ErrNotPaid
+	}
+	if hasReceipt {
+		r.TxID, r.TenantID = txID, tenantID
+		return r, nil
+	}
+
+	log.Printf("Rendering missing receipt of transaction %s", txID)
+	return Generate(ctx, db.Pool, txID)
+}
+
+// Generate renders a successful transaction's receipt in both formats, stores them and
+// records their keys. Rendering again overwrites the same objects.
+func Generate(ctx context.Context, q Querier, txID string) (models.Receipt, error) {
+	d, tenantID, status, err := load(ctx, q, txID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Receipt{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if status != models.TxStatusSuccess {
+		return models.Receipt{}, ErrNotPaid
+	}
+
+	r := models.Receipt{
+		TxID:     txID,
+		TenantID: tenantID,
+		PDFKey:   fmt.Sprintf("receipts/%s/%s.pdf", tenantID, txID),
+		TextKey:  fmt.Sprintf("receipts/%s/%s.txt", tenantID, txID),
+	}
+	if err := Store.Put(ctx, r.PDFKey, ContentTypePDF, PDF(d)); err != nil {
+		return r, fmt.Errorf("failed to store receipt: %w", err)
+	}
+	if err := Store.Put(ctx, r.TextKey, ContentTypeText, Text(d, ThermalWidth)); err != nil {
+		return r, fmt.Errorf("failed to store receipt: %w", err)
+	}
+
+	err = q.QueryRow(ctx,
+		`INSERT INTO receipts (tx_id, tenant_id, pdf_key, text_key, created_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (tx_id) DO UPDATE SET pdf_key = EXCLUDED.pdf_key, text_key = EXCLUDED.text_key
+		 RETURNING created_at`,
+		r.TxID, r.TenantID, r.PDFKey, r.TextKey, time.Now()).Scan(&r.CreatedAt)
+	if err != nil {
+		return r, fmt.Errorf("failed to record receipt: %w", err)
+	}
+	return r, nil
+}
+
+// Key returns the object key of a receipt format
+func Key(r models.Receipt, format string) (string, string, bool) {
+	switch format {
+	case FormatPDF:
+		return r.PDFKey, ContentTypePDF, true
+	case FormatText:
+		return r.TextKey, ContentTypeText, true
+	default:
+		return "", "", false
+	}
+}
+
+// load reads what a transaction's receipt shows, with its tenant and status
+func load(ctx context.Context, q Querier, txID string) (Data, string, string, error) {
+	var d Data
+	var tenantID, status string
+	var fulfillmentJSON, fulfillmentEncrypted *string
+	err := q.QueryRow(ctx,
+		`SELECT t.id, t.tenant_id, t.status, t.amount, t.fee, t.total, COALESCE(t.provider_tx_id, ''),
+		        COALESCE(t.customer_no, ''), t.fulfillment_json, t.fulfillment_encrypted, t.created_at,
+		        COALESCE(p.name, t.product_code, ''), COALESCE(pa.name, ''),
+		        COALESCE(b.display_name, tn.name), b.address, b.phone, b.footer
+		 FROM transactions t
+		 JOIN tenants tn ON tn.id = t.tenant_id
+		 LEFT JOIN products p ON p.code = t.product_code
+		 LEFT JOIN partners pa ON pa.id = t.partner_id
+		 LEFT JOIN tenant_branding b ON b.tenant_id = t.tenant_id
+		 WHERE t.id = $1`,
+		txID).Scan(&d.TxID, &tenantID, &status, &d.Amount, &d.Fee, &d.Total, &d.ProviderTxID,
+		&d.CustomerNo, &fulfillmentJSON, &fulfillmentEncrypted, &d.CreatedAt,
+		&d.ProductName, &d.PartnerName,
+		&d.Branding.DisplayName, &d.Branding.Address, &d.Branding.Phone, &d.Branding.Footer)
+	if err != nil {
+		return d, "", "", err
+	}
+	d.Branding.TenantID = tenantID
+
+	// A receipt without its token would be useless to the customer, so it is not rendered
+	d.Fulfillment, err = fulfillment.Open(fulfillmentJSON, fulfillmentEncrypted)
+	if err != nil {
+		return d, "", "", err
+	}
+	return d, tenantID, status, nil
+}
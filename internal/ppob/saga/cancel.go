@@ -0,0 +1,187 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/catalog"
+	"github.com/aziz46/core-e-voucher-services/pkg/audit"
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Cancellation errors
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrNotCancellable      = errors.New("only a settled successful transaction can be cancelled")
+	ErrCancelWindowClosed  = errors.New("reversal window for this transaction has closed")
+	ErrCancelRejected      = errors.New("provider refused to cancel the transaction")
+)
+
+// auditResource is the audit_logs resource type of transaction entries
+const auditResource = "transaction"
+
+// cancelRequest is the audit payload of a cancellation request
+type cancelRequest struct {
+	TenantID    string `json:"tenant_id"`
+	PartnerID   string `json:"partner_id"`
+	Total       int64  `json:"total"`
+	RequestedBy string `json:"requested_by"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// cancelStep is the audit payload of a cancellation saga step
+type cancelStep struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Detail string `json:"detail"`
+}
+
+// Cancel reverses a tenant's paid transaction within its product's reversal window. The
+// finished saga is reopened in cancel_pending and the provider cancel is sent; once the
+// provider confirms, the transaction is cancelled and its captured credit restored. A
+// refusal leaves the transaction paid and is reported in Result.Err as ErrCancelRejected.
+//
+// Cancelling a transaction that is already cancelling or cancelled returns it as it is,
+// so retries are safe; an interrupted cancellation is finished by the recovery worker.
+func Cancel(ctx context.Context, tenantID, txID, reason, requestedBy string) (Result, error) {
+	var res Result
+
+	t, err := loadTransaction(ctx, txID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && t.TenantID != tenantID) {
+		return res, ErrTransactionNotFound
+	}
+	if err != nil {
+		return res, err
+	}
+	s, err := loadSaga(ctx, txID)
+	if err != nil {
+		return res, err
+	}
+
+	switch {
+	case s.State == models.SagaStateCancelPending || s.State == models.SagaStateCancelled:
+		res.State, res.Transaction = s.State, t
+		return res, nil
+	case s.State != models.SagaStateSuccess || s.FinishedAt == nil || t.ProductCode == "":
+		// Only a transaction whose credit was captured has anything to reverse
+		return res, ErrNotCancellable
+	}
+
+	product, err := catalog.GetProduct(ctx, t.ProductCode)
+	if err != nil {
+		return res, err
+	}
+	if product.CancelWindow <= 0 {
+		return res, ErrCancelWindowClosed
+	}
+
+	token, ok, err := claimCancel(ctx, t, product.CancelWindow, reason, requestedBy)
+	if err != nil {
+		return res, err
+	}
+	if !ok {
+		// Either another request reopened the saga first or the window has passed
+		s, err = loadSaga(ctx, txID)
+		if err != nil {
+			return res, err
+		}
+		if s.State == models.SagaStateCancelPending || s.State == models.SagaStateCancelled {
+			res.State, res.Transaction = s.State, t
+			return res, nil
+		}
+		return res, ErrCancelWindowClosed
+	}
+
+	return Run(ctx, txID, token)
+}
+
+// claimCancel reopens a finished success saga in cancel_pending with a fresh lease if the
+// transaction is still inside its reversal window, auditing the request in the same
+// transaction. The window is compared in SQL, where timestamps are stored as local time.
+func claimCancel(ctx context.Context, t models.Transaction, window int, reason, requestedBy string) (string, bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	token := uuid.New().String()
+	tag, err := tx.Exec(ctx,
+		`UPDATE transaction_sagas s
+		 SET state = $1, lease_owner = $2, locked_until = $3, finished_at = NULL, attempts = 0, last_error = NULL, updated_at = $4
+		 FROM transactions t
+		 WHERE s.tx_id = $5 AND t.id = s.tx_id AND s.state = $6 AND s.finished_at IS NOT NULL
+		   AND t.created_at + make_interval(secs => $7) >= $4`,
+		models.SagaStateCancelPending, token, now.Add(Lease), now, t.ID, models.SagaStateSuccess, window)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to reopen saga: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", false, nil
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE transactions SET cancel_reason = NULLIF($1, ''), updated_at = $2 WHERE id = $3",
+		reason, now, t.ID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to update transaction: %w", err)
+	}
+
+	detail := "cancel requested by " + requestedBy
+	if reason != "" {
+		detail += ": " + reason
+	}
+	if err := recordStep(ctx, tx, t.ID, models.SagaStateSuccess, models.SagaStateCancelPending, detail); err != nil {
+		return "", false, err
+	}
+	err = audit.Record(ctx, tx, auditResource, t.ID, "cancel_requested", cancelRequest{
+		TenantID:    t.TenantID,
+		PartnerID:   t.PartnerID,
+		Total:       t.Total,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", false, fmt.Errorf("failed to commit cancel request: %w", err)
+	}
+	return token, true, nil
+}
+
+// cancel asks the transaction's provider to reverse the payment sent with its ref_no
+func cancel(ctx context.Context, t models.Transaction) error {
+	provider, err := LookupProvider(ctx, t.TenantID, t.Provider)
+	if err != nil {
+		return fmt.Errorf("%w: failed to resolve provider: %v", connector.ErrUnavailable, err)
+	}
+	_, err = provider.Cancel(ctx, connector.CancelRequest{
+		RefNo:         t.ID,
+		ProviderRefNo: t.ProviderTxID,
+	})
+	return err
+}
+
+// isCancelStep reports whether a saga step belongs to a cancellation
+func isCancelStep(from, to string) bool {
+	return from == models.SagaStateCancelPending || from == models.SagaStateCancelled ||
+		to == models.SagaStateCancelPending || to == models.SagaStateCancelled
+}
+
+// auditCancelStep records a cancellation step in audit_logs within the step's transaction
+func auditCancelStep(ctx context.Context, tx pgx.Tx, txID, from, to, detail string) error {
+	return audit.Record(ctx, tx, auditResource, txID, "cancel_step", cancelStep{
+		From:   from,
+		To:     to,
+		Detail: detail,
+	})
+}
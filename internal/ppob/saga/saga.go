@@ -0,0 +1,629 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/common/client"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/fulfillment"
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/webhook"
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/outbox"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Saga settings, overridable from configuration at startup
+var (
+	// Lease is how long a runner may drive a saga before the recovery worker can take it over.
+	// It is renewed while the provider is called, so a slow call does not lose it.
+	Lease = 2 * time.Minute
+	// MaxAttempts is how often the recovery worker resumes a saga before leaving it for manual review
+	MaxAttempts = 10
+	// StatusCheckDelay is the wait before a suspect transaction's first status check;
+	// each further check waits twice as long, up to StatusCheckMaxDelay
+	StatusCheckDelay    = 30 * time.Second
+	StatusCheckMaxDelay = 30 * time.Minute
+	// MaxStatusChecks is how often a suspect transaction is checked before manual review
+	MaxStatusChecks = 10
+)
+
+// ResolveProvider routes a tenant's product to a provider connector
+var ResolveProvider = func(ctx context.Context, tenantID, productCode string) (connector.Provider, error) {
+	return connector.NewMockProvider(0), nil // 0% failure rate for demo
+}
+
+// LookupProvider returns the provider a transaction was routed to by name
+var LookupProvider = func(ctx context.Context, tenantID, providerName string) (connector.Provider, error) {
+	return connector.NewMockProvider(0), nil
+}
+
+// Saga errors
+var (
+	ErrLeaseLost          = errors.New("saga lease lost to another runner")
+	ErrInquiryUnavailable = errors.New("inquiry is expired or already used")
+	// ErrDuplicateKey means the tenant already created a transaction with the idempotency key
+	ErrDuplicateKey = errors.New("idempotency key already used")
+	// ErrProviderLookup means the provider a transaction was routed to could not be resolved
+	ErrProviderLookup = errors.New("failed to resolve provider")
+)
+
+// Result is where a saga run left the transaction
+type Result struct {
+	Transaction models.Transaction
+	State       string
+	// FailedAt is the state in which the transaction failed and Err the reason, e.g.
+	// client.ErrInsufficientCredit while pending or a provider error while provider_pending
+	FailedAt string
+	Err      error
+}
+
+// Start persists a new pending transaction together with its saga and returns
+// the lease token that lets the caller drive it with Run
+func Start(ctx context.Context, t models.Transaction) (string, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// A concurrent request with the same idempotency key waits here until the first commits
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO transactions (id, tenant_id, partner_id, amount, fee, total, provider_cost, margin, fee_rule_id, status, provider, product_code, customer_no, inquiry_id, idempotency_key, request_hash, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, NULLIF($14, ''), NULLIF($15, ''), NULLIF($16, ''), $17, $18)
+		 ON CONFLICT (tenant_id, idempotency_key) DO NOTHING`,
+		t.ID, t.TenantID, t.PartnerID, t.Amount, t.Fee, t.Total, t.ProviderCost, t.Margin, t.FeeRuleID, models.TxStatusPending, t.Provider,
+		t.ProductCode, t.CustomerNo, t.InquiryID, t.IdempotencyKey, t.RequestHash, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create transaction: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", ErrDuplicateKey
+	}
+
+	// An inquiry quote pays exactly one transaction, and only while it is valid
+	if t.InquiryID != "" {
+		tag, err := tx.Exec(ctx,
+			`UPDATE inquiries SET status = $1, tx_id = $2
+			 WHERE id = $3 AND tenant_id = $4 AND status = $5 AND expires_at > $6`,
+			models.InquiryStatusUsed, t.ID, t.InquiryID, t.TenantID, models.InquiryStatusOpen, t.CreatedAt)
+		if err != nil {
+			return "", fmt.Errorf("failed to use inquiry: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return "", ErrInquiryUnavailable
+		}
+	}
+
+	token := uuid.New().String()
+	_, err = tx.Exec(ctx,
+		`INSERT INTO transaction_sagas (tx_id, state, lease_owner, locked_until, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $5)`,
+		t.ID, models.SagaStatePending, token, t.CreatedAt.Add(Lease), t.CreatedAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create saga: %w", err)
+	}
+
+	if err := recordStep(ctx, tx, t.ID, "", models.SagaStatePending, "transaction created"); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return token, nil
+}
+
+// Run drives a saga forward until it finishes or a step cannot complete, in which case
+// the error is returned and the recovery worker resumes it once the lease expires.
+// Business failures such as insufficient credit are reported in Result, not as errors.
+func Run(ctx context.Context, txID, token string) (Result, error) {
+	var res Result
+
+	t, err := loadTransaction(ctx, txID)
+	if err != nil {
+		return res, err
+	}
+	s, err := loadSaga(ctx, txID)
+	if err != nil {
+		return res, err
+	}
+
+	// A saga resumed by the recovery worker was interrupted mid-flight
+	recovering := s.Attempts > 0
+	state := s.State
+
+	for {
+		res.State = state
+
+		switch state {
+		case models.SagaStatePending:
+			// A recovered saga never moves forward from here: the caller already got an error
+			// and may have retried, so it is failed and any hold that was made is released
+			if recovering {
+				res.FailedAt, res.Err = state, errors.New("interrupted before credit was reserved")
+				state, err = fail(ctx, &t, token, state, res.Err)
+				break
+			}
+			err = client.Credit.Reserve(ctx, t.PartnerID, t.ID, t.Total)
+			if err != nil {
+				res.FailedAt, res.Err = state, err
+				state, err = fail(ctx, &t, token, state, err)
+				break
+			}
+			state, err = advance(ctx, txID, token, state, models.SagaStateCreditReserved, "credit reserved", nil)
+
+		case models.SagaStateCreditReserved:
+			// The provider is only called after provider_pending is durable, so it was never reached
+			if recovering {
+				res.FailedAt, res.Err = state, errors.New("interrupted before the provider was called")
+				state, err = fail(ctx, &t, token, state, res.Err)
+				break
+			}
+			// Once the provider is called the outcome may take status checks long past the hold TTL
+			// to settle, so the hold must not expire under it
+			if err = client.Credit.Pin(ctx, t.PartnerID, t.ID); errors.Is(err, client.ErrConflict) {
+				res.FailedAt, res.Err = state, fmt.Errorf("credit hold expired: %w", err)
+				state, err = fail(ctx, &t, token, state, res.Err)
+				break
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to pin credit hold: %w", err)
+				break
+			}
+			state, err = advance(ctx, txID, token, state, models.SagaStateProviderPending, "calling provider", nil)
+
+		case models.SagaStateProviderPending:
+			// The lease is renewed before and during the call, which with retries may outlast it,
+			// so that the recovery worker does not send the payment again alongside
+			var renewed bool
+			if renewed, err = Renew(ctx, txID, token); err == nil && !renewed {
+				err = ErrLeaseLost
+			}
+			if err != nil {
+				break
+			}
+			// A recovered saga re-sends the same ref_no, which billers treat as the same payment
+			var payResp connector.PayResponse
+			stopRenewing := keepLease(ctx, txID, token)
+			payResp, err = pay(ctx, t)
+			stopRenewing()
+			if err != nil && payFailed(err, recovering) {
+				res.FailedAt, res.Err = state, err
+				state, err = fail(ctx, &t, token, state, err)
+				break
+			}
+			// The biller may have taken the payment, so nothing is refunded until a status check settles it
+			if err != nil {
+				res.Err = err
+				t.Status = models.TxStatusSuspect
+				state, err = advance(ctx, txID, token, state, models.SagaStateSuspect, "provider outcome unknown: "+err.Error(), &t)
+				break
+			}
+			// The biller has not settled yet
+			if payResp.Status == connector.StatusPending {
+				t.Status = models.TxStatusSuspect
+				t.ProviderTxID = payResp.ProviderRefNo
+				t.Fulfillment = payResp.Fulfillment
+				state, err = advance(ctx, txID, token, state, models.SagaStateSuspect, "provider payment pending: "+payResp.Message, &t)
+				break
+			}
+			t.Status = models.TxStatusSuccess
+			t.ProviderTxID = payResp.ProviderRefNo
+			t.Fulfillment = payResp.Fulfillment
+			state, err = advance(ctx, txID, token, state, models.SagaStateSuccess, "provider paid "+payResp.ProviderRefNo, &t)
+
+		case models.SagaStateSuccess:
+			if err = client.Credit.Capture(ctx, t.PartnerID, t.ID); err != nil {
+				err = fmt.Errorf("failed to capture credit: %w", err)
+				break
+			}
+			err = finish(ctx, txID, token, state, state, "credit captured")
+			if err == nil {
+				res.Transaction = t
+				return res, nil
+			}
+
+		case models.SagaStateFailed:
+			err = client.Credit.Release(ctx, t.PartnerID, t.ID, t.Total)
+			// No reservation means the reserve never took effect, so there is nothing to release
+			if err != nil && !errors.Is(err, client.ErrNotFound) {
+				err = fmt.Errorf("failed to release credit: %w", err)
+				break
+			}
+			err = finish(ctx, txID, token, state, models.SagaStateCompensated, "credit released")
+			if err == nil {
+				res.State = models.SagaStateCompensated
+				res.Transaction = t
+				return res, nil
+			}
+
+		case models.SagaStateCompensated:
+			res.Transaction = t
+			return res, nil
+
+		case models.SagaStateSuspect, models.SagaStateManualReview:
+			// Parked until a status check or an operator settles the payment
+			res.Transaction = t
+			return res, nil
+
+		case models.SagaStateCancelPending:
+			// A recovered cancellation re-sends the same ref_no, which billers treat as the same reversal
+			err = cancel(ctx, t)
+			if connector.Classify(err) == connector.ClassBusiness {
+				// The payment stands, so the saga finishes where it was before the request
+				res.Err = fmt.Errorf("%w: %v", ErrCancelRejected, err)
+				err = finish(ctx, txID, token, state, models.SagaStateSuccess, "provider refused cancel: "+err.Error())
+				if err == nil {
+					res.State = models.SagaStateSuccess
+					res.Transaction = t
+					return res, nil
+				}
+				break
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to cancel with provider: %w", err)
+				break
+			}
+			t.Status = models.TxStatusCancelled
+			state, err = advance(ctx, txID, token, state, models.SagaStateCancelled, "provider cancelled payment", &t)
+
+		case models.SagaStateCancelled:
+			// Releasing a captured reservation refunds it to the partner's limit
+			if err = client.Credit.Release(ctx, t.PartnerID, t.ID, t.Total); err != nil {
+				err = fmt.Errorf("failed to restore credit: %w", err)
+				break
+			}
+			err = finish(ctx, txID, token, state, state, "credit restored")
+			if err == nil {
+				res.Transaction = t
+				return res, nil
+			}
+
+		default:
+			err = fmt.Errorf("unknown saga state %q", state)
+		}
+
+		if err != nil {
+			res.Transaction = t
+			recordError(ctx, txID, token, err)
+			return res, err
+		}
+	}
+}
+
+// Recover resumes up to limit unfinished sagas whose lease has expired
+// and returns how many it finished. Suspect sagas are left to CheckSuspects.
+func Recover(ctx context.Context, limit int) (int, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tx_id FROM transaction_sagas
+		 WHERE finished_at IS NULL AND attempts < $1 AND (locked_until IS NULL OR locked_until < $2)
+		   AND state NOT IN ($4, $5)
+		 ORDER BY locked_until NULLS FIRST LIMIT $3`,
+		MaxAttempts, time.Now(), limit, models.SagaStateSuspect, models.SagaStateManualReview)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query stale sagas: %w", err)
+	}
+
+	var txIDs []string
+	for rows.Next() {
+		var txID string
+		if err := rows.Scan(&txID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan stale saga: %w", err)
+		}
+		txIDs = append(txIDs, txID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read stale sagas: %w", err)
+	}
+
+	finished := 0
+	for _, txID := range txIDs {
+		token, ok, err := claim(ctx, txID)
+		if err != nil {
+			log.Printf("Error claiming saga %s: %v", txID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		res, err := Run(ctx, txID, token)
+		if err != nil {
+			log.Printf("Error resuming saga %s: %v", txID, err)
+			continue
+		}
+		log.Printf("Recovered saga %s in state %s", txID, res.State)
+		finished++
+	}
+	return finished, nil
+}
+
+// claim takes over a stale saga with a fresh lease, counting the attempt
+func claim(ctx context.Context, txID string) (string, bool, error) {
+	now := time.Now()
+	token := uuid.New().String()
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE transaction_sagas
+		 SET lease_owner = $1, locked_until = $2, attempts = attempts + 1, updated_at = $3
+		 WHERE tx_id = $4 AND finished_at IS NULL AND (locked_until IS NULL OR locked_until < $3)`,
+		token, now.Add(Lease), now, txID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to claim saga: %w", err)
+	}
+	return token, tag.RowsAffected() == 1, nil
+}
+
+// Renew extends the lease of a saga held under token, reporting false when the lease was lost,
+// e.g. to the recovery worker after it expired
+func Renew(ctx context.Context, txID, token string) (bool, error) {
+	now := time.Now()
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE transaction_sagas SET locked_until = $1, updated_at = $2
+		 WHERE tx_id = $3 AND lease_owner = $4 AND finished_at IS NULL AND locked_until IS NOT NULL`,
+		now.Add(Lease), now, txID, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew saga lease: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// keepLease renews the lease of a saga every third of Lease until the returned function is called
+func keepLease(ctx context.Context, txID, token string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed, err := Renew(ctx, txID, token)
+			if err != nil {
+				log.Printf("Error renewing lease of saga %s: %v", txID, err)
+			} else if !renewed {
+				log.Printf("Lease of saga %s lost while calling the provider", txID)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// payFailed reports whether a pay error proves the payment did not go through. On a first
+// attempt a rejection, a transient error or a failed lookup all mean the biller does not have it.
+// A recovered saga may follow an attempt that reached the biller before the interruption,
+// so only the biller's explicit rejection counts and anything else waits for a status check.
+func payFailed(err error, recovering bool) bool {
+	class := connector.Classify(err)
+	if recovering {
+		return class == connector.ClassBusiness
+	}
+	return class == connector.ClassBusiness || class == connector.ClassTransient || errors.Is(err, ErrProviderLookup)
+}
+
+// pay calls the transaction's provider with the transaction ID as the idempotent ref_no.
+// It never fails over: a recovered payment must reach the biller that may already have it.
+func pay(ctx context.Context, t models.Transaction) (connector.PayResponse, error) {
+	provider, err := LookupProvider(ctx, t.TenantID, t.Provider)
+	if err != nil {
+		return connector.PayResponse{}, fmt.Errorf("%w %s: %v", ErrProviderLookup, t.Provider, err)
+	}
+	return provider.Pay(ctx, connector.PayRequest{
+		ProductCode: t.ProductCode,
+		CustomerNo:  t.CustomerNo,
+		Amount:      t.Amount,
+		RefNo:       t.ID,
+	})
+}
+
+// fail marks the transaction failed so that its credit is released next
+func fail(ctx context.Context, t *models.Transaction, token, from string, cause error) (string, error) {
+	t.Status = models.TxStatusFailed
+	return advance(ctx, t.ID, token, from, models.SagaStateFailed, cause.Error(), t)
+}
+
+// advance moves the saga from one state to the next, renewing the lease.
+// When t is set its status, provider reference and fulfillment, and the matching transaction event,
+// are written in the same transaction.
+func advance(ctx context.Context, txID, token, from, to, detail string, t *models.Transaction) (string, error) {
+	if err := transition(ctx, txID, token, from, to, detail, t, false); err != nil {
+		return from, err
+	}
+	return to, nil
+}
+
+// finish moves the saga into its final state once the capture or release is done
+func finish(ctx context.Context, txID, token, from, to, detail string) error {
+	return transition(ctx, txID, token, from, to, detail, nil, true)
+}
+
+func transition(ctx context.Context, txID, token, from, to, detail string, t *models.Transaction, finished bool) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	var finishedAt *time.Time
+	if finished {
+		finishedAt = &now
+	}
+
+	// Parked sagas hold no lease; a suspect one waits for its first status check
+	lockedUntil := now.Add(Lease)
+	lease := &lockedUntil
+	var nextCheck *time.Time
+	switch to {
+	case models.SagaStateSuspect:
+		next := now.Add(StatusCheckDelay)
+		lease, nextCheck = nil, &next
+	case models.SagaStateManualReview:
+		lease = nil
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE transaction_sagas
+		 SET state = $1, locked_until = $2, finished_at = $3, next_status_check_at = $4, last_error = NULL, updated_at = $5
+		 WHERE tx_id = $6 AND state = $7 AND lease_owner = $8`,
+		to, lease, finishedAt, nextCheck, now, txID, from, token)
+	if err != nil {
+		return fmt.Errorf("failed to update saga: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+
+	if t != nil {
+		t.UpdatedAt = now
+		plainJSON, encrypted, err := fulfillment.Seal(t.Fulfillment)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE transactions
+			 SET status = $1, provider_tx_id = NULLIF($2, ''), fulfillment_json = COALESCE($3, fulfillment_json),
+			     fulfillment_encrypted = COALESCE($4, fulfillment_encrypted), updated_at = $5
+			 WHERE id = $6`,
+			t.Status, t.ProviderTxID, plainJSON, encrypted, now, txID)
+		if err != nil {
+			return fmt.Errorf("failed to update transaction: %w", err)
+		}
+
+		if err := addTransactionEvent(ctx, tx, t); err != nil {
+			return err
+		}
+	}
+
+	// A refused cancellation leaves the payment standing, so the request's reason is dropped
+	// from the transaction and kept only in the audit log
+	if from == models.SagaStateCancelPending && to == models.SagaStateSuccess {
+		_, err = tx.Exec(ctx,
+			"UPDATE transactions SET cancel_reason = NULL, updated_at = $1 WHERE id = $2",
+			now, txID)
+		if err != nil {
+			return fmt.Errorf("failed to update transaction: %w", err)
+		}
+	}
+
+	if err := recordStep(ctx, tx, txID, from, to, detail); err != nil {
+		return err
+	}
+	// A cancellation reverses a paid transaction, so each of its steps is also audited
+	if isCancelStep(from, to) {
+		if err := auditCancelStep(ctx, tx, txID, from, to, detail); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit saga step: %w", err)
+	}
+	return nil
+}
+
+// addTransactionEvent publishes a settled or cancelled transaction to other services and to
+// the tenant's webhook; suspect ones have nothing to report yet
+func addTransactionEvent(ctx context.Context, tx pgx.Tx, t *models.Transaction) error {
+	var eventType string
+	switch t.Status {
+	case models.TxStatusSuccess:
+		eventType = eventbus.TransactionSucceeded
+	case models.TxStatusFailed:
+		eventType = eventbus.TransactionFailed
+	case models.TxStatusCancelled:
+		eventType = eventbus.TransactionCancelled
+	default:
+		return nil
+	}
+	event := eventbus.TransactionEvent{
+		TxID:         t.ID,
+		TenantID:     t.TenantID,
+		PartnerID:    t.PartnerID,
+		ProductCode:  t.ProductCode,
+		Amount:       t.Amount,
+		Fee:          t.Fee,
+		Total:        t.Total,
+		Status:       t.Status,
+		ProviderTxID: t.ProviderTxID,
+	}
+	if err := outbox.Add(ctx, tx, "transaction", t.ID, eventType, event); err != nil {
+		return err
+	}
+	return webhook.Enqueue(ctx, tx, t.TenantID, t.ID, eventType, event)
+}
+
+// recordStep appends to the saga's step history
+func recordStep(ctx context.Context, tx pgx.Tx, txID, from, to, detail string) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO transaction_saga_steps (tx_id, from_state, to_state, detail, created_at)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5)`,
+		txID, from, to, detail, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record saga step: %w", err)
+	}
+	return nil
+}
+
+// recordError keeps the last step error visible to operators while the saga waits for recovery
+func recordError(ctx context.Context, txID, token string, stepErr error) {
+	_, err := db.Pool.Exec(ctx,
+		"UPDATE transaction_sagas SET last_error = $1, updated_at = $2 WHERE tx_id = $3 AND lease_owner = $4",
+		stepErr.Error(), time.Now(), txID, token)
+	if err != nil {
+		log.Printf("Error recording saga error for %s: %v", txID, err)
+	}
+}
+
+func loadTransaction(ctx context.Context, txID string) (models.Transaction, error) {
+	var t models.Transaction
+	var providerTxID, productCode, customerNo *string
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, tenant_id, partner_id, amount, fee, total, status, provider, provider_tx_id, product_code, customer_no, created_at, updated_at
+		 FROM transactions WHERE id = $1`,
+		txID).Scan(&t.ID, &t.TenantID, &t.PartnerID, &t.Amount, &t.Fee, &t.Total, &t.Status, &t.Provider,
+		&providerTxID, &productCode, &customerNo, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, fmt.Errorf("failed to load transaction: %w", err)
+	}
+	if providerTxID != nil {
+		t.ProviderTxID = *providerTxID
+	}
+	if productCode != nil {
+		t.ProductCode = *productCode
+	}
+	if customerNo != nil {
+		t.CustomerNo = *customerNo
+	}
+	return t, nil
+}
+
+func loadSaga(ctx context.Context, txID string) (models.TransactionSaga, error) {
+	var s models.TransactionSaga
+	err := db.Pool.QueryRow(ctx,
+		`SELECT tx_id, state, attempts, last_error, locked_until, finished_at, created_at, updated_at
+		 FROM transaction_sagas WHERE tx_id = $1`,
+		txID).Scan(&s.TxID, &s.State, &s.Attempts, &s.LastError, &s.LockedUntil, &s.FinishedAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, fmt.Errorf("failed to load saga: %w", err)
+	}
+	return s, nil
+}
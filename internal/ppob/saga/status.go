@@ -0,0 +1,219 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotUnsettled is returned by Resolve for a transaction that is not suspect or in manual review
+var ErrNotUnsettled = errors.New("transaction is not suspect or awaiting manual review")
+
+// CheckSuspects asks providers how up to limit suspect payments ended, once their next check
+// is due, and settles those with an answer. It returns how many it settled.
+func CheckSuspects(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	rows, err := db.Pool.Query(ctx,
+		`SELECT tx_id FROM transaction_sagas
+		 WHERE state = $1 AND finished_at IS NULL AND next_status_check_at <= $2
+		   AND (locked_until IS NULL OR locked_until < $2)
+		 ORDER BY next_status_check_at LIMIT $3`,
+		models.SagaStateSuspect, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query suspect sagas: %w", err)
+	}
+
+	var txIDs []string
+	for rows.Next() {
+		var txID string
+		if err := rows.Scan(&txID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan suspect saga: %w", err)
+		}
+		txIDs = append(txIDs, txID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read suspect sagas: %w", err)
+	}
+
+	settled := 0
+	for _, txID := range txIDs {
+		ok, err := checkSuspect(ctx, txID)
+		if err != nil {
+			log.Printf("Error checking suspect transaction %s: %v", txID, err)
+			continue
+		}
+		if ok {
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// checkSuspect runs one status check. Only an explicit success or failed status settles the
+// payment: errors, including refusals of the check itself, never prove the biller lacks it.
+func checkSuspect(ctx context.Context, txID string) (bool, error) {
+	token, checks, ok, err := claimSuspect(ctx, txID)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	t, err := loadTransaction(ctx, txID)
+	if err != nil {
+		return false, err
+	}
+
+	status, err := checkStatus(ctx, t)
+	switch {
+	case err == nil && status.Status == connector.StatusSuccess:
+		t.Status = models.TxStatusSuccess
+		if status.ProviderRefNo != "" {
+			t.ProviderTxID = status.ProviderRefNo
+		}
+		t.Fulfillment = status.Fulfillment
+		_, err = advance(ctx, txID, token, models.SagaStateSuspect, models.SagaStateSuccess,
+			fmt.Sprintf("status check %d: provider paid %s", checks, t.ProviderTxID), &t)
+	case err == nil && status.Status == connector.StatusFailed:
+		_, err = fail(ctx, &t, token, models.SagaStateSuspect,
+			fmt.Errorf("status check %d: provider reports payment failed: %s", checks, status.Message))
+	default:
+		detail := "provider payment still pending"
+		if err != nil {
+			detail = err.Error()
+		} else if status.Message != "" {
+			detail += ": " + status.Message
+		}
+		if checks >= MaxStatusChecks {
+			_, err = advance(ctx, txID, token, models.SagaStateSuspect, models.SagaStateManualReview,
+				fmt.Sprintf("no outcome after %d status checks: %s", checks, detail), nil)
+			if err == nil {
+				log.Printf("Transaction %s escalated to manual review after %d status checks", txID, checks)
+			}
+			return false, err
+		}
+		return false, reschedule(ctx, txID, token, checks, detail)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Capture or release the credit; if that fails the recovery worker finishes it
+	res, err := Run(ctx, txID, token)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Settled suspect transaction %s as %s", txID, res.Transaction.Status)
+	return true, nil
+}
+
+// Resolve settles a suspect or manual-review transaction by hand, as success or failed,
+// then captures or releases its credit
+func Resolve(ctx context.Context, txID, status, providerTxID, note string) (Result, error) {
+	var res Result
+	if status != models.TxStatusSuccess && status != models.TxStatusFailed {
+		return res, fmt.Errorf("cannot resolve a transaction as %q", status)
+	}
+
+	now := time.Now()
+	token := uuid.New().String()
+	var from string
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE transaction_sagas SET lease_owner = $1, locked_until = $2, updated_at = $3
+		 WHERE tx_id = $4 AND state IN ($5, $6) AND finished_at IS NULL AND (locked_until IS NULL OR locked_until < $3)
+		 RETURNING state`,
+		token, now.Add(Lease), now, txID, models.SagaStateSuspect, models.SagaStateManualReview).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, ErrNotUnsettled
+	}
+	if err != nil {
+		return res, fmt.Errorf("failed to claim saga: %w", err)
+	}
+
+	t, err := loadTransaction(ctx, txID)
+	if err != nil {
+		return res, err
+	}
+
+	detail := "resolved manually"
+	if note != "" {
+		detail += ": " + note
+	}
+	if status == models.TxStatusSuccess {
+		t.Status = models.TxStatusSuccess
+		if providerTxID != "" {
+			t.ProviderTxID = providerTxID
+		}
+		_, err = advance(ctx, txID, token, from, models.SagaStateSuccess, detail, &t)
+	} else {
+		_, err = fail(ctx, &t, token, from, errors.New(detail))
+	}
+	if err != nil {
+		return res, err
+	}
+	return Run(ctx, txID, token)
+}
+
+// claimSuspect takes a lease on a suspect saga whose check is due, counting the check
+func claimSuspect(ctx context.Context, txID string) (string, int, bool, error) {
+	now := time.Now()
+	token := uuid.New().String()
+	var checks int
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE transaction_sagas
+		 SET lease_owner = $1, locked_until = $2, status_checks = status_checks + 1, updated_at = $3
+		 WHERE tx_id = $4 AND state = $5 AND finished_at IS NULL AND next_status_check_at <= $3
+		   AND (locked_until IS NULL OR locked_until < $3)
+		 RETURNING status_checks`,
+		token, now.Add(Lease), now, txID, models.SagaStateSuspect).Scan(&checks)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, false, nil
+	}
+	if err != nil {
+		return "", 0, false, fmt.Errorf("failed to claim suspect saga: %w", err)
+	}
+	return token, checks, true, nil
+}
+
+// reschedule releases the lease and schedules the next status check with exponential backoff
+func reschedule(ctx context.Context, txID, token string, checks int, detail string) error {
+	now := time.Now()
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE transaction_sagas
+		 SET lease_owner = NULL, locked_until = NULL, next_status_check_at = $1, last_error = $2, updated_at = $3
+		 WHERE tx_id = $4 AND lease_owner = $5`,
+		now.Add(statusCheckBackoff(checks)), detail, now, txID, token)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule status check: %w", err)
+	}
+	return nil
+}
+
+// statusCheckBackoff returns the wait after check n: StatusCheckDelay * 2^n capped at StatusCheckMaxDelay
+func statusCheckBackoff(n int) time.Duration {
+	delay := StatusCheckDelay << n
+	if n > 30 || delay <= 0 || delay > StatusCheckMaxDelay {
+		return StatusCheckMaxDelay
+	}
+	return delay
+}
+
+// checkStatus asks the transaction's provider about its payment by the same ref_no it was paid with
+func checkStatus(ctx context.Context, t models.Transaction) (connector.StatusResponse, error) {
+	provider, err := LookupProvider(ctx, t.TenantID, t.Provider)
+	if err != nil {
+		return connector.StatusResponse{}, fmt.Errorf("%w: failed to resolve provider: %v", connector.ErrUnavailable, err)
+	}
+	return provider.CheckStatus(ctx, connector.StatusRequest{
+		RefNo:         t.ID,
+		ProviderRefNo: t.ProviderTxID,
+	})
+}
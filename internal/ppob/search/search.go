@@ -0,0 +1,182 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+// Page sizes of a listing
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidCursor is returned for a cursor this package did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filter narrows a tenant's transactions; zero fields match any
+type Filter struct {
+	TenantID    string
+	PartnerID   string
+	Statuses    []string
+	ProductCode string
+	Provider    string
+	CustomerNo  string
+	// From is inclusive and To exclusive
+	From      *time.Time
+	To        *time.Time
+	MinAmount *int64
+	MaxAmount *int64
+}
+
+// Cursor is the position after the last transaction of a page. Transactions are listed
+// newest first by (created_at, id), so rows created while paging never shift a page.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Totals sums every transaction matching a filter, across all pages
+type Totals struct {
+	Count  int64 `json:"count"`
+	Amount int64 `json:"amount"`
+	Fee    int64 `json:"fee"`
+	Total  int64 `json:"total"`
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// ParseCursor reads a cursor returned by Encode
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: t, ID: id}, nil
+}
+
+// List returns up to limit transactions matching f, newest first, starting after the
+// cursor when one is given. The returned cursor is nil on the last page.
+func List(ctx context.Context, f Filter, after *Cursor, limit int) ([]models.Transaction, *Cursor, error) {
+	if limit <= 0 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+	where, args := f.where()
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	// One extra row tells whether another page follows
+	args = append(args, limit+1)
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, tenant_id, partner_id, amount, fee, total, COALESCE(status, ''), COALESCE(provider, ''),
+		        COALESCE(product_code, ''), COALESCE(customer_no, ''), COALESCE(provider_tx_id, ''),
+		        COALESCE(cancel_reason, ''), created_at, updated_at
+		 FROM transactions
+		 WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $`+fmt.Sprint(len(args)),
+		args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	txs := []models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		err := rows.Scan(&t.ID, &t.TenantID, &t.PartnerID, &t.Amount, &t.Fee, &t.Total, &t.Status, &t.Provider,
+			&t.ProductCode, &t.CustomerNo, &t.ProviderTxID, &t.CancelReason, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		txs = append(txs, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	if len(txs) <= limit {
+		return txs, nil, nil
+	}
+	txs = txs[:limit]
+	last := txs[limit-1]
+	return txs, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// Sum returns the totals of every transaction matching f
+func Sum(ctx context.Context, f Filter) (Totals, error) {
+	where, args := f.where()
+	var t Totals
+	err := db.Pool.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(amount), 0), COALESCE(SUM(fee), 0), COALESCE(SUM(total), 0)
+		 FROM transactions WHERE `+strings.Join(where, " AND "),
+		args...).Scan(&t.Count, &t.Amount, &t.Fee, &t.Total)
+	if err != nil {
+		return t, fmt.Errorf("failed to sum transactions: %w", err)
+	}
+	return t, nil
+}
+
+// where builds the conditions of f. Only the filters given become conditions, with no
+// catch-all "$n IS NULL OR" terms, so that the planner can pick the tenant index matching them.
+func (f Filter) where() ([]string, []any) {
+	where := []string{"tenant_id = $1"}
+	args := []any{f.TenantID}
+	add := func(cond string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.PartnerID != "" {
+		add("partner_id = $%d", f.PartnerID)
+	}
+	switch len(f.Statuses) {
+	case 0:
+	case 1:
+		add("status = $%d", f.Statuses[0])
+	default:
+		add("status = ANY($%d)", f.Statuses)
+	}
+	if f.ProductCode != "" {
+		add("product_code = $%d", f.ProductCode)
+	}
+	if f.Provider != "" {
+		add("provider = $%d", f.Provider)
+	}
+	if f.CustomerNo != "" {
+		add("customer_no = $%d", f.CustomerNo)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.MinAmount != nil {
+		add("amount >= $%d", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("amount <= $%d", *f.MaxAmount)
+	}
+	return where, args
+}
@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+	"github.com/aziz46/core-e-voucher-services/pkg/secret"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Headers sent with every delivery. Receivers verify
+// X-Webhook-Signature = hex(HMAC-SHA256(secret, TIMESTAMP + "." + BODY)).
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Delivery settings, overridable from configuration at startup
+var (
+	// Box decrypts tenant webhook secrets
+	Box *secret.Box
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts = 8
+	// BaseDelay is the wait after the first failed attempt; each further one waits twice as long, up to MaxDelay
+	BaseDelay = 30 * time.Second
+	MaxDelay  = time.Hour
+	// Lease is how long a sender owns a delivery; it must exceed the HTTP timeout
+	Lease = time.Minute
+	// Client posts deliveries
+	Client = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Redelivery errors
+var (
+	// ErrDeliveryNotFound is returned for a delivery the tenant does not have
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrDeliveryInProgress is returned while a sender holds the delivery's lease
+	ErrDeliveryInProgress = errors.New("webhook delivery is being sent, retry later")
+)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Enqueue records a delivery of an event in the caller's transaction if the tenant has an
+// active webhook, so that callbacks are sent if and only if the state change commits
+func Enqueue(ctx context.Context, tx pgx.Tx, tenantID, txID, eventType string, data interface{}) error {
+	now := time.Now()
+	p := Payload{
+		ID:        uuid.New().String(),
+		Event:     eventType,
+		CreatedAt: now,
+		Data:      data,
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO webhook_deliveries (id, tenant_id, tx_id, event_type, payload_json, status, next_attempt_at, created_at, updated_at)
+		 SELECT $1, tenant_id, NULLIF($3, ''), $4, $5, $6, $7, $7, $7 FROM tenant_webhooks
+		 WHERE tenant_id = $2 AND active = true`,
+		p.ID, tenantID, txID, eventType, string(body), models.WebhookDeliveryPending, now)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// DeliverDue sends up to limit pending deliveries whose next attempt is due and returns
+// how many were delivered. Deliveries are claimed with a lease, so several replicas may run it.
+func DeliverDue(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id FROM webhook_deliveries
+		 WHERE status = $1 AND next_attempt_at <= $2 AND (locked_until IS NULL OR locked_until < $2)
+		 ORDER BY next_attempt_at LIMIT $3`,
+		models.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+
+	delivered := 0
+	for _, id := range ids {
+		ok, err := deliver(ctx, id)
+		if err != nil {
+			log.Printf("Error delivering webhook %s: %v", id, err)
+			continue
+		}
+		if ok {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// Redeliver queues a tenant's delivery to be sent again with a fresh set of attempts,
+// whatever its status. A delivery being sent is left to its sender, since queueing it
+// while leased would send it a second time alongside.
+func Redeliver(ctx context.Context, tenantID, deliveryID string) error {
+	now := time.Now()
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+		 WHERE id = $3 AND tenant_id = $4 AND (locked_until IS NULL OR locked_until < $2)`,
+		models.WebhookDeliveryPending, now, deliveryID, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to queue redelivery: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	var exists bool
+	err = db.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1 AND tenant_id = $2)",
+		deliveryID, tenantID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook delivery: %w", err)
+	}
+	if !exists {
+		return ErrDeliveryNotFound
+	}
+	return ErrDeliveryInProgress
+}
+
+// Sign computes the signature of a delivery body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// deliver claims a due delivery and posts it once, recording the attempt
+func deliver(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	var d models.WebhookDelivery
+	err := db.Pool.QueryRow(ctx,
+		`UPDATE webhook_deliveries SET locked_until = $1, attempts = attempts + 1, updated_at = $2
+		 WHERE id = $3 AND status = $4 AND next_attempt_at <= $2 AND (locked_until IS NULL OR locked_until < $2)
+		 RETURNING id, tenant_id, event_type, payload_json, attempts`,
+		now.Add(Lease), now, id, models.WebhookDeliveryPending).Scan(&d.ID, &d.TenantID, &d.EventType, &d.PayloadJSON, &d.Attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	var hook models.TenantWebhook
+	err = db.Pool.QueryRow(ctx,
+		"SELECT url, secret_encrypted, active FROM tenant_webhooks WHERE tenant_id = $1",
+		d.TenantID).Scan(&hook.URL, &hook.SecretEncrypted, &hook.Active)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !hook.Active) {
+		// Nothing to send to; the tenant can redeliver once the webhook is active again
+		return false, settle(ctx, d, models.WebhookDeliveryFailed, nil, "webhook not configured or inactive")
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load tenant webhook: %w", err)
+	}
+	signingSecret, err := Box.Decrypt(hook.SecretEncrypted)
+	if err != nil {
+		return false, settle(ctx, d, models.WebhookDeliveryFailed, nil, "failed to decrypt webhook secret: "+err.Error())
+	}
+
+	start := time.Now()
+	statusCode, sendErr := post(ctx, hook.URL, string(signingSecret), d)
+	recordAttempt(d, hook.URL, statusCode, sendErr, time.Since(start))
+
+	if sendErr == nil {
+		return true, settle(ctx, d, models.WebhookDeliveryDelivered, nil, "")
+	}
+	if d.Attempts >= MaxAttempts {
+		return false, settle(ctx, d, models.WebhookDeliveryFailed, nil, sendErr.Error())
+	}
+	next := time.Now().Add(backoff(d.Attempts))
+	return false, settle(ctx, d, models.WebhookDeliveryPending, &next, sendErr.Error())
+}
+
+// post sends a delivery; any non-2xx answer is an error
+func post(ctx context.Context, url, signingSecret string, d models.WebhookDelivery) (int, error) {
+	body := []byte(d.PayloadJSON)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.ID)
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(signingSecret, timestamp, body))
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, fmt.Errorf("webhook returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode, nil
+}
+
+// settle stores a delivery's outcome and releases its lease
+func settle(ctx context.Context, d models.WebhookDelivery, status string, next *time.Time, lastError string) error {
+	now := time.Now()
+	var deliveredAt *time.Time
+	if status == models.WebhookDeliveryDelivered {
+		deliveredAt = &now
+	}
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = $1, next_attempt_at = $2, last_error = NULLIF($3, ''), delivered_at = COALESCE($4, delivered_at),
+			locked_until = NULL, updated_at = $5
+		 WHERE id = $6`,
+		status, next, lastError, deliveredAt, now, d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// recordAttempt appends to the delivery log. It does not use the caller's context so that
+// attempts cut short by shutdown are still recorded.
+func recordAttempt(d models.WebhookDelivery, url string, statusCode int, sendErr error, duration time.Duration) {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	var errMsg string
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+	_, err := db.Pool.Exec(context.Background(),
+		`INSERT INTO webhook_delivery_attempts (delivery_id, attempt, url, status_code, error, duration_ms, created_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)`,
+		d.ID, d.Attempts, url, code, errMsg, duration.Milliseconds(), time.Now())
+	if err != nil {
+		log.Printf("Error recording webhook attempt for %s: %v", d.ID, err)
+	}
+}
+
+// backoff returns the wait after attempt n: BaseDelay * 2^(n-1) capped at MaxDelay
+func backoff(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	delay := BaseDelay << (n - 1)
+	if n > 30 || delay <= 0 || delay > MaxDelay {
+		return MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	// hex(HMAC-SHA256("whsec_test", "1700000000." + body)), as a receiver computes it
+	const want = "c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		wantMatch bool
+	}{
+		{name: "same input", secret: "whsec_test", timestamp: "1700000000", body: body, wantMatch: true},
+		{name: "other secret", secret: "whsec_other", timestamp: "1700000000", body: body},
+		{name: "other timestamp", secret: "whsec_test", timestamp: "1700000001", body: body},
+		{name: "other body", secret: "whsec_test", timestamp: "1700000000", body: []byte(`{"id":"evt_2"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sign(tt.secret, tt.timestamp, tt.body)
+			if (got == want) != tt.wantMatch {
+				t.Errorf("Sign() = %s, match %v, want match %v", got, got == want, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(base, max time.Duration) { BaseDelay, MaxDelay = base, max }(BaseDelay, MaxDelay)
+	BaseDelay, MaxDelay = 30*time.Second, time.Hour
+
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{n: 0, want: 30 * time.Second},
+		{n: 1, want: 30 * time.Second},
+		{n: 2, want: time.Minute},
+		{n: 3, want: 2 * time.Minute},
+		{n: 7, want: 32 * time.Minute},
+		{n: 8, want: time.Hour},
+		{n: 31, want: time.Hour},
+		{n: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPostSignsDelivery(t *testing.T) {
+	d := models.WebhookDelivery{ID: "dlv_1", EventType: "transaction.success", PayloadJSON: `{"id":"dlv_1"}`}
+
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	code, err := post(context.Background(), server.URL, "whsec_test", d)
+	if err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("post() status = %d, want %d", code, http.StatusOK)
+	}
+	if string(gotBody) != d.PayloadJSON {
+		t.Errorf("body = %s, want %s", gotBody, d.PayloadJSON)
+	}
+	if got.Header.Get(HeaderID) != d.ID || got.Header.Get(HeaderEvent) != d.EventType {
+		t.Errorf("headers = %v", got.Header)
+	}
+	want := Sign("whsec_test", got.Header.Get(HeaderTimestamp), gotBody)
+	if sig := got.Header.Get(HeaderSignature); sig != want {
+		t.Errorf("signature = %s, want %s", sig, want)
+	}
+}
+
+func TestPostRejectsNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	code, err := post(context.Background(), server.URL, "whsec_test", models.WebhookDelivery{ID: "dlv_1", PayloadJSON: "{}"})
+	if err == nil || !strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("post() error = %v, want the receiver's message", err)
+	}
+	if code != http.StatusUnauthorized {
+		t.Errorf("post() status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
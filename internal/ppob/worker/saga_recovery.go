@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+)
+
+// RunSagaRecovery resumes transaction sagas whose runner died or gave up, every interval
+// until ctx is cancelled. Sagas are claimed with a lease, so several replicas may run it.
+func RunSagaRecovery(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		finished, err := saga.Recover(ctx, batchSize)
+		if err != nil {
+			log.Printf("Error recovering sagas: %v", err)
+			continue
+		}
+		if finished > 0 {
+			log.Printf("Recovered %d transaction sagas", finished)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+)
+
+// RunStatusChecks polls providers for suspect transactions whose next check is due, every
+// interval until ctx is cancelled. Checks are claimed with a lease, so several replicas may run it.
+func RunStatusChecks(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		settled, err := saga.CheckSuspects(ctx, batchSize)
+		if err != nil {
+			log.Printf("Error checking suspect transactions: %v", err)
+			continue
+		}
+		if settled > 0 {
+			log.Printf("Settled %d suspect transactions", settled)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/saga"
+)
+
+// TransactionPool drives asynchronous transactions' sagas on a fixed number of workers.
+// Callers Reserve a queue slot before creating the transaction so that an accepted
+// transaction is never dropped for lack of room.
+type TransactionPool struct {
+	slots chan struct{}
+	jobs  chan poolJob
+
+	// queued holds the lease tokens of sagas waiting for a worker, by transaction ID
+	mu     sync.Mutex
+	queued map[string]string
+}
+
+type poolJob struct {
+	txID  string
+	token string
+}
+
+// NewTransactionPool creates a pool whose queue holds up to queueSize transactions,
+// including those being processed
+func NewTransactionPool(queueSize int) *TransactionPool {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &TransactionPool{
+		slots:  make(chan struct{}, queueSize),
+		jobs:   make(chan poolJob, queueSize),
+		queued: make(map[string]string),
+	}
+}
+
+// Run starts workers goroutines that process queued transactions until ctx is cancelled.
+// The leases of queued sagas are renewed while they wait, so the recovery worker does not
+// take them over; at shutdown renewal stops and the recovery worker finishes them once
+// their leases expire.
+func (p *TransactionPool) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					p.process(ctx, job)
+				}
+			}
+		}()
+	}
+	go p.renewQueued(ctx)
+}
+
+// Reserve takes a queue slot, reporting false when the queue is full
+func (p *TransactionPool) Reserve() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release returns a reserved slot that will not be used
+func (p *TransactionPool) Release() {
+	<-p.slots
+}
+
+// Submit queues a saga started with Start under a reserved slot
+func (p *TransactionPool) Submit(txID, token string) {
+	p.mu.Lock()
+	p.queued[txID] = token
+	p.mu.Unlock()
+	p.jobs <- poolJob{txID: txID, token: token}
+}
+
+func (p *TransactionPool) process(ctx context.Context, job poolJob) {
+	defer p.Release()
+
+	p.mu.Lock()
+	delete(p.queued, job.txID)
+	p.mu.Unlock()
+
+	// The lease taken when the saga was queued may have nearly run out while it waited
+	renewed, err := saga.Renew(ctx, job.txID, job.token)
+	if err != nil {
+		log.Printf("Async saga for transaction %s not started: %v", job.txID, err)
+		return
+	}
+	if !renewed {
+		log.Printf("Async saga for transaction %s was taken over while queued", job.txID)
+		return
+	}
+
+	res, err := saga.Run(ctx, job.txID, job.token)
+	if err != nil {
+		log.Printf("Async saga for transaction %s interrupted in state %s: %v", job.txID, res.State, err)
+		return
+	}
+	log.Printf("Async transaction %s finished as %s", job.txID, res.Transaction.Status)
+}
+
+// renewQueued renews the leases of queued sagas well before they expire, until ctx is cancelled
+func (p *TransactionPool) renewQueued(ctx context.Context) {
+	ticker := time.NewTicker(saga.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		queued := make(map[string]string, len(p.queued))
+		for txID, token := range p.queued {
+			queued[txID] = token
+		}
+		p.mu.Unlock()
+
+		for txID, token := range queued {
+			renewed, err := saga.Renew(ctx, txID, token)
+			if err != nil {
+				log.Printf("Error renewing lease of queued saga %s: %v", txID, err)
+				continue
+			}
+			if !renewed {
+				log.Printf("Queued saga %s was taken over before a worker picked it up", txID)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/inventory"
+)
+
+// RunVoucherExpiry marks available voucher codes past their expiry as expired, every
+// interval until ctx is cancelled. Allocation already skips them; this keeps stock counts true.
+func RunVoucherExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := inventory.ExpireCodes(ctx)
+		if err != nil {
+			log.Printf("Error expiring voucher codes: %v", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("Expired %d voucher codes", expired)
+		}
+	}
+}
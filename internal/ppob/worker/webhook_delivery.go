@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/internal/ppob/webhook"
+)
+
+// RunWebhookDelivery sends due webhook deliveries every interval until ctx is cancelled
+func RunWebhookDelivery(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		delivered, err := webhook.DeliverDue(ctx, batchSize)
+		if err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
+			continue
+		}
+		if delivered > 0 {
+			log.Printf("Delivered %d webhooks", delivered)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+-- Migration: 003_tenant_api_key_hash.sql
+-- Description: Store tenant API keys as SHA-256 hashes instead of plaintext
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS api_key_hash VARCHAR(64);
+
+-- Hash existing plaintext keys, then clear them
+UPDATE tenants
+SET api_key_hash = encode(digest(api_key, 'sha256'), 'hex')
+WHERE api_key_hash IS NULL AND api_key IS NOT NULL;
+
+ALTER TABLE tenants ALTER COLUMN api_key DROP NOT NULL;
+UPDATE tenants SET api_key = NULL WHERE api_key IS NOT NULL;
+
+ALTER TABLE tenants ALTER COLUMN api_key_hash SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_api_key_hash ON tenants(api_key_hash);
@@ -0,0 +1,28 @@
+-- Migration: 004_tenant_api_keys.sql
+-- Description: Support multiple rotatable, scoped API keys per tenant
+
+CREATE TABLE IF NOT EXISTS tenant_api_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id VARCHAR(36) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_api_keys_tenant_id ON tenant_api_keys(tenant_id);
+
+-- Carry the existing single key of every tenant over as an unrestricted key
+INSERT INTO tenant_api_keys (id, tenant_id, label, key_prefix, key_hash, scopes, created_at)
+SELECT gen_random_uuid()::text, id, 'primary', '', api_key_hash, ARRAY['*'], NOW()
+FROM tenants
+WHERE api_key_hash IS NOT NULL
+ON CONFLICT (key_hash) DO NOTHING;
+
+DROP INDEX IF EXISTS idx_tenants_api_key_hash;
+ALTER TABLE tenants DROP COLUMN IF EXISTS api_key_hash;
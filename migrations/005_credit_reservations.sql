@@ -0,0 +1,15 @@
+-- Migration: 005_credit_reservations.sql
+-- Description: Track credit reservations per transaction so reserve/restore are idempotent
+
+CREATE TABLE IF NOT EXISTS credit_reservations (
+    tx_id VARCHAR(36) PRIMARY KEY,
+    partner_id VARCHAR(36) NOT NULL,
+    amount BIGINT NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'reserved',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (partner_id) REFERENCES partners(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_reservations_partner_id ON credit_reservations(partner_id);
+CREATE INDEX IF NOT EXISTS idx_credit_reservations_status ON credit_reservations(status);
@@ -0,0 +1,12 @@
+-- Migration: 006_credit_holds.sql
+-- Description: Turn credit reservations into holds with a TTL that are captured or released
+
+ALTER TABLE credit_reservations ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE credit_reservations ADD COLUMN IF NOT EXISTS captured_at TIMESTAMP;
+ALTER TABLE credit_reservations ADD COLUMN IF NOT EXISTS released_at TIMESTAMP;
+ALTER TABLE credit_reservations ADD COLUMN IF NOT EXISTS release_reason VARCHAR(50);
+
+-- Reservations made before holds existed were final debits, so they must not expire
+UPDATE credit_reservations SET status = 'captured', captured_at = updated_at WHERE status = 'reserved';
+
+CREATE INDEX IF NOT EXISTS idx_credit_reservations_expiry ON credit_reservations(expires_at) WHERE status = 'reserved';
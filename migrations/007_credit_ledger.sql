@@ -0,0 +1,78 @@
+-- Migration: 007_credit_ledger.sql
+-- Description: Append-only double-entry ledger behind the credit_limits counters
+--
+-- Accounts per partner:
+--   available - limit that can still be reserved (credit_limits.limit_available)
+--   held      - reserved but not yet captured
+--   used      - captured, owed by the partner until paid or reset
+--   limit     - contra account carrying -limit_total
+-- held + used equals credit_limits.limit_used. Postings of every entry sum to zero.
+
+CREATE TABLE IF NOT EXISTS credit_journal_entries (
+    id VARCHAR(36) PRIMARY KEY,
+    seq BIGSERIAL UNIQUE,
+    partner_id VARCHAR(36) NOT NULL,
+    entry_type VARCHAR(50) NOT NULL,
+    reference VARCHAR(255),
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (partner_id) REFERENCES partners(id)
+);
+
+CREATE TABLE IF NOT EXISTS credit_ledger_postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id VARCHAR(36) NOT NULL,
+    partner_id VARCHAR(36) NOT NULL,
+    account VARCHAR(50) NOT NULL,
+    amount BIGINT NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES credit_journal_entries(id),
+    FOREIGN KEY (partner_id) REFERENCES partners(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_journal_entries_partner_seq ON credit_journal_entries(partner_id, seq);
+CREATE INDEX IF NOT EXISTS idx_credit_journal_entries_reference ON credit_journal_entries(entry_type, reference);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_postings_entry_id ON credit_ledger_postings(entry_id);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_postings_partner_account ON credit_ledger_postings(partner_id, account);
+
+-- The ledger is append-only
+CREATE OR REPLACE FUNCTION credit_ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'credit ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_credit_journal_entries_append_only ON credit_journal_entries;
+CREATE TRIGGER trg_credit_journal_entries_append_only
+    BEFORE UPDATE OR DELETE ON credit_journal_entries
+    FOR EACH ROW EXECUTE FUNCTION credit_ledger_append_only();
+
+DROP TRIGGER IF EXISTS trg_credit_ledger_postings_append_only ON credit_ledger_postings;
+CREATE TRIGGER trg_credit_ledger_postings_append_only
+    BEFORE UPDATE OR DELETE ON credit_ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION credit_ledger_append_only();
+
+-- Opening balances from the current counters
+INSERT INTO credit_journal_entries (id, partner_id, entry_type, description, created_at)
+SELECT gen_random_uuid()::text, l.partner_id, 'opening', 'Opening balance from credit_limits', NOW()
+FROM credit_limits l
+WHERE NOT EXISTS (
+    SELECT 1 FROM credit_journal_entries e WHERE e.partner_id = l.partner_id AND e.entry_type = 'opening'
+);
+
+INSERT INTO credit_ledger_postings (entry_id, partner_id, account, amount)
+SELECT e.id, l.partner_id, p.account, p.amount
+FROM credit_journal_entries e
+JOIN credit_limits l ON l.partner_id = e.partner_id
+CROSS JOIN LATERAL (
+    SELECT COALESCE(SUM(r.amount), 0) AS held
+    FROM credit_reservations r
+    WHERE r.partner_id = l.partner_id AND r.status = 'reserved'
+) h
+CROSS JOIN LATERAL (VALUES
+    ('available', l.limit_available),
+    ('held', h.held),
+    ('used', l.limit_used - h.held),
+    ('limit', -(l.limit_available + l.limit_used))
+) AS p(account, amount)
+WHERE e.entry_type = 'opening'
+  AND NOT EXISTS (SELECT 1 FROM credit_ledger_postings x WHERE x.entry_id = e.id);
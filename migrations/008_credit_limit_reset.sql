@@ -0,0 +1,15 @@
+-- Migration: 008_credit_limit_reset.sql
+-- Description: Track scheduled credit limit resets per reset_period
+
+UPDATE credit_limits SET reset_period = 'daily' WHERE reset_period IS NULL;
+ALTER TABLE credit_limits ALTER COLUMN reset_period SET NOT NULL;
+ALTER TABLE credit_limits DROP CONSTRAINT IF EXISTS chk_credit_limits_reset_period;
+ALTER TABLE credit_limits ADD CONSTRAINT chk_credit_limits_reset_period CHECK (reset_period IN ('daily', 'weekly', 'monthly'));
+
+-- Keep usage still owed on unpaid invoices when the period resets
+ALTER TABLE credit_limits ADD COLUMN IF NOT EXISTS carry_over_unpaid BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE credit_limits ADD COLUMN IF NOT EXISTS last_reset_at TIMESTAMP;
+-- NULL until the scheduler first sees the partner and schedules its next period boundary
+ALTER TABLE credit_limits ADD COLUMN IF NOT EXISTS next_reset_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_credit_limits_next_reset_at ON credit_limits(next_reset_at);
@@ -0,0 +1,23 @@
+-- Migration: 009_credit_limit_changes.sql
+-- Description: Maker-checker proposals for credit limit changes
+
+CREATE TABLE IF NOT EXISTS credit_limit_changes (
+    id VARCHAR(36) PRIMARY KEY,
+    partner_id VARCHAR(36) NOT NULL,
+    change_type VARCHAR(50) NOT NULL CHECK (change_type IN ('increase', 'decrease', 'temporary_increase')),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'reverted')),
+    proposed_by VARCHAR(100) NOT NULL,
+    reviewed_by VARCHAR(100),
+    reviewed_at TIMESTAMP,
+    -- Only set for temporary increases, which are reverted once they expire
+    expires_at TIMESTAMP,
+    reverted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (partner_id) REFERENCES credit_limits(partner_id),
+    CHECK ((change_type = 'temporary_increase') = (expires_at IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_credit_limit_changes_partner_id ON credit_limit_changes(partner_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_credit_limit_changes_expiry ON credit_limit_changes(expires_at) WHERE status = 'approved' AND change_type = 'temporary_increase';
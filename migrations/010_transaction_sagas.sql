@@ -0,0 +1,35 @@
+-- Migration: 010_transaction_sagas.sql
+-- Description: Persist the transaction flow as a resumable saga instead of one long DB transaction
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS product_code VARCHAR(100);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS customer_no VARCHAR(100);
+
+-- One saga per transaction: pending -> credit_reserved -> provider_pending -> success|failed -> compensated
+CREATE TABLE IF NOT EXISTS transaction_sagas (
+    tx_id VARCHAR(36) PRIMARY KEY,
+    state VARCHAR(50) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    -- Whoever holds an unexpired lease drives the saga; the recovery worker takes over stale ones
+    lease_owner VARCHAR(36),
+    locked_until TIMESTAMP,
+    -- Set once the saga and all of its side effects (capture or release) are done
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tx_id) REFERENCES transactions(id)
+);
+
+-- Durable history of every step and compensation
+CREATE TABLE IF NOT EXISTS transaction_saga_steps (
+    id BIGSERIAL PRIMARY KEY,
+    tx_id VARCHAR(36) NOT NULL,
+    from_state VARCHAR(50),
+    to_state VARCHAR(50) NOT NULL,
+    detail TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tx_id) REFERENCES transaction_sagas(tx_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_sagas_unfinished ON transaction_sagas(locked_until) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_transaction_saga_steps_tx_id ON transaction_saga_steps(tx_id, id);
@@ -0,0 +1,28 @@
+-- Migration: 011_outbox.sql
+-- Description: Transactional outbox for cross-service events and per-consumer deduplication
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id VARCHAR(36) PRIMARY KEY,
+    seq BIGSERIAL UNIQUE,
+    aggregate_type VARCHAR(100) NOT NULL,
+    aggregate_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload_json TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    published_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished ON outbox_events(seq) WHERE published_at IS NULL;
+
+-- Events a consumer has already handled; written in the same transaction as the handling
+CREATE TABLE IF NOT EXISTS processed_events (
+    consumer VARCHAR(100) NOT NULL,
+    event_id VARCHAR(36) NOT NULL,
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (consumer, event_id)
+);
+
+-- At most one receivable per transaction, so replayed events cannot bill twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_receivables_tx_id ON receivables(tx_id);
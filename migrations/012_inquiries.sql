@@ -0,0 +1,26 @@
+-- Migration: 012_inquiries.sql
+-- Description: Persist provider inquiries so postpaid bills are paid at the quoted amount
+
+CREATE TABLE IF NOT EXISTS inquiries (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id VARCHAR(36) NOT NULL,
+    partner_id VARCHAR(36) NOT NULL,
+    product_code VARCHAR(100) NOT NULL,
+    customer_no VARCHAR(100) NOT NULL,
+    customer_name VARCHAR(255),
+    amount BIGINT NOT NULL,
+    admin_fee BIGINT NOT NULL DEFAULT 0,
+    provider VARCHAR(100) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'used')),
+    tx_id VARCHAR(36),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (partner_id) REFERENCES partners(id),
+    FOREIGN KEY (tx_id) REFERENCES transactions(id)
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS inquiry_id VARCHAR(36) REFERENCES inquiries(id);
+
+CREATE INDEX IF NOT EXISTS idx_inquiries_tenant_id ON inquiries(tenant_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_inquiry_id ON transactions(inquiry_id);
@@ -0,0 +1,14 @@
+-- Migration: 013_provider_http_adapter.sql
+-- Description: Select the connector adapter per provider config and configure HTTP billers
+
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS adapter VARCHAR(20) NOT NULL DEFAULT 'mock';
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS timeout_ms INT NOT NULL DEFAULT 10000;
+-- JSON object mapping biller response codes to success, failed or pending
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS status_map_json TEXT;
+
+ALTER TABLE provider_configs DROP CONSTRAINT IF EXISTS provider_configs_adapter_check;
+ALTER TABLE provider_configs ADD CONSTRAINT provider_configs_adapter_check CHECK (adapter IN ('mock', 'http'));
+ALTER TABLE provider_configs DROP CONSTRAINT IF EXISTS provider_configs_timeout_ms_check;
+ALTER TABLE provider_configs ADD CONSTRAINT provider_configs_timeout_ms_check CHECK (timeout_ms > 0);
+
+CREATE INDEX IF NOT EXISTS idx_provider_configs_tenant_active ON provider_configs(tenant_id, active);
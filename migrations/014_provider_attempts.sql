@@ -0,0 +1,18 @@
+-- Migration: 014_provider_attempts.sql
+-- Description: Record every provider call attempt made for a transaction
+
+CREATE TABLE IF NOT EXISTS transaction_provider_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    tx_id VARCHAR(36) NOT NULL,
+    provider VARCHAR(100) NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    attempt INT NOT NULL,
+    status VARCHAR(50),
+    error_class VARCHAR(50),
+    error TEXT,
+    duration_ms BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tx_id) REFERENCES transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_provider_attempts_tx_id ON transaction_provider_attempts(tx_id, id);
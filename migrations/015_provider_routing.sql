@@ -0,0 +1,18 @@
+-- Migration: 015_provider_routing.sql
+-- Description: Route products across a tenant's providers by priority with per-provider circuit breakers
+
+-- Lower priority is tried first; product_codes NULL serves every product
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 100;
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS product_codes TEXT[];
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS breaker_failure_threshold INT NOT NULL DEFAULT 5;
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS breaker_open_timeout_ms INT NOT NULL DEFAULT 30000;
+ALTER TABLE provider_configs ADD COLUMN IF NOT EXISTS breaker_half_open_max INT NOT NULL DEFAULT 1;
+
+ALTER TABLE provider_configs DROP CONSTRAINT IF EXISTS provider_configs_breaker_check;
+ALTER TABLE provider_configs ADD CONSTRAINT provider_configs_breaker_check
+    CHECK (breaker_failure_threshold > 0 AND breaker_open_timeout_ms > 0 AND breaker_half_open_max > 0);
+
+-- Transactions record the provider name, which must identify a single config per tenant
+CREATE UNIQUE INDEX IF NOT EXISTS idx_provider_configs_tenant_name ON provider_configs(tenant_id, provider_name);
+DROP INDEX IF EXISTS idx_provider_configs_tenant_active;
+CREATE INDEX IF NOT EXISTS idx_provider_configs_routing ON provider_configs(tenant_id, active, priority);
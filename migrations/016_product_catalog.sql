@@ -0,0 +1,37 @@
+-- Migration: 016_product_catalog.sql
+-- Description: Product catalog with per-tenant and per-partner selling prices and fees
+
+CREATE TABLE IF NOT EXISTS products (
+    code VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(50) NOT NULL CHECK (category IN ('pulsa', 'data', 'pln_prepaid', 'pln_postpaid', 'bpjs', 'pdam', 'ewallet')),
+    -- Face value of a fixed-denomination product; NULL for bills whose amount comes from inquiry
+    denomination BIGINT CHECK (denomination > 0),
+    -- What the provider charges us per transaction
+    base_cost BIGINT NOT NULL DEFAULT 0 CHECK (base_cost >= 0),
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category, active);
+
+-- A row without partner_id is the tenant's default; a partner row overrides it
+CREATE TABLE IF NOT EXISTS tenant_product_prices (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id VARCHAR(36) NOT NULL,
+    partner_id VARCHAR(36),
+    product_code VARCHAR(100) NOT NULL,
+    -- Price charged for a fixed-denomination product; NULL sells at the denomination
+    selling_price BIGINT CHECK (selling_price > 0),
+    fee BIGINT NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (partner_id) REFERENCES partners(id),
+    FOREIGN KEY (product_code) REFERENCES products(code)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_product_prices_scope
+    ON tenant_product_prices(tenant_id, COALESCE(partner_id, ''), product_code);
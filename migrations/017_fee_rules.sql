@@ -0,0 +1,41 @@
+-- Migration: 017_fee_rules.sql
+-- Description: Fee rules per tenant, partner, product or category, and the fee breakdown stored on transactions
+
+-- The most specific active rule wins: partner before tenant-wide, then product before
+-- category before any product, then lowest priority. Without a rule the catalog fee applies.
+CREATE TABLE IF NOT EXISTS fee_rules (
+    id VARCHAR(36) PRIMARY KEY,
+    tenant_id VARCHAR(36) NOT NULL,
+    partner_id VARCHAR(36),
+    product_code VARCHAR(100),
+    category VARCHAR(50),
+    rule_type VARCHAR(20) NOT NULL CHECK (rule_type IN ('flat', 'percent', 'tiered')),
+    flat_fee BIGINT NOT NULL DEFAULT 0 CHECK (flat_fee >= 0),
+    -- Percentage in basis points: 250 is 2.5%
+    percent_bps INT NOT NULL DEFAULT 0 CHECK (percent_bps >= 0),
+    min_fee BIGINT CHECK (min_fee >= 0),
+    max_fee BIGINT CHECK (max_fee >= 0),
+    -- Tiered rules: JSON array of {"min_volume", "flat_fee", "percent_bps"} chosen by the
+    -- partner's successful transaction volume in the current month
+    tiers_json TEXT,
+    priority INT NOT NULL DEFAULT 100,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (partner_id) REFERENCES partners(id),
+    FOREIGN KEY (product_code) REFERENCES products(code),
+    CHECK (min_fee IS NULL OR max_fee IS NULL OR min_fee <= max_fee)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fee_rules_tenant ON fee_rules(tenant_id, active);
+
+-- Tier volume is summed over a partner's successful transactions
+CREATE INDEX IF NOT EXISTS idx_transactions_partner_volume ON transactions(partner_id, status, created_at);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS provider_cost BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS margin BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee_rule_id VARCHAR(36);
+
+-- A quote keeps the rule its admin fee came from
+ALTER TABLE inquiries ADD COLUMN IF NOT EXISTS fee_rule_id VARCHAR(36);
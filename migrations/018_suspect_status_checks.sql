@@ -0,0 +1,9 @@
+-- Migration: 018_suspect_status_checks.sql
+-- Description: Suspect transactions whose payment outcome is unknown, settled by provider status checks
+
+-- provider_pending -> suspect -> success|failed, or manual_review once status_checks runs out
+ALTER TABLE transaction_sagas ADD COLUMN IF NOT EXISTS status_checks INT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_sagas ADD COLUMN IF NOT EXISTS next_status_check_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_sagas_suspect ON transaction_sagas(next_status_check_at) WHERE state = 'suspect';
+CREATE INDEX IF NOT EXISTS idx_transaction_sagas_manual_review ON transaction_sagas(updated_at) WHERE state = 'manual_review';
@@ -0,0 +1,32 @@
+-- Migration: 020_transaction_cancellation.sql
+-- Description: Reversal window per product, cancellation of paid transactions and invoice adjustments
+
+-- Reversal window: seconds after creation during which a paid transaction may be cancelled; 0 disables cancellation
+ALTER TABLE products ADD COLUMN IF NOT EXISTS cancel_window INT NOT NULL DEFAULT 0 CHECK (cancel_window >= 0);
+
+-- A finished success saga is reopened as success -> cancel_pending -> cancelled, or back to success
+-- when the provider refuses the reversal
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS cancel_reason TEXT;
+
+-- What billing did about a cancelled transaction, at most once per transaction
+CREATE TABLE IF NOT EXISTS invoice_adjustments (
+    id VARCHAR(36) PRIMARY KEY,
+    tx_id VARCHAR(36) NOT NULL UNIQUE,
+    tenant_id VARCHAR(36) NOT NULL,
+    partner_id VARCHAR(36) NOT NULL,
+    -- Negative: the amount taken off what the partner owes
+    amount BIGINT NOT NULL,
+    -- applied: deducted from an unpaid invoice; uninvoiced: not billed yet, nothing to adjust;
+    -- refund_due: the invoice was already paid and the partner is owed the amount
+    status VARCHAR(50) NOT NULL CHECK (status IN ('applied', 'uninvoiced', 'refund_due')),
+    invoice_id VARCHAR(36),
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tx_id) REFERENCES transactions(id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (partner_id) REFERENCES partners(id),
+    FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_adjustments_invoice_id ON invoice_adjustments(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoice_adjustments_refund_due ON invoice_adjustments(partner_id) WHERE status = 'refund_due';
@@ -0,0 +1,55 @@
+-- Migration: 021_voucher_inventory.sql
+-- Description: Pre-purchased e-voucher codes, imported in batches and allocated to transactions
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_category_check;
+ALTER TABLE products ADD CONSTRAINT products_category_check
+    CHECK (category IN ('pulsa', 'data', 'pln_prepaid', 'pln_postpaid', 'bpjs', 'pdam', 'ewallet', 'game_voucher', 'gift_card'));
+
+-- Available codes at or below this count raise an inventory.low_stock event; 0 disables the alert
+ALTER TABLE products ADD COLUMN IF NOT EXISTS low_stock_threshold INT NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0);
+-- Set when the alert is raised, so it is sent once per crossing; cleared by an import that restocks the product
+ALTER TABLE products ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMP;
+
+-- Stock is served by provider configs with the inventory adapter
+ALTER TABLE provider_configs DROP CONSTRAINT IF EXISTS provider_configs_adapter_check;
+ALTER TABLE provider_configs ADD CONSTRAINT provider_configs_adapter_check CHECK (adapter IN ('mock', 'http', 'inventory'));
+
+CREATE TABLE IF NOT EXISTS voucher_batches (
+    id VARCHAR(36) PRIMARY KEY,
+    product_code VARCHAR(100) NOT NULL,
+    supplier_ref VARCHAR(255),
+    -- Codes stored, and codes skipped because the product already had them
+    code_count INT NOT NULL DEFAULT 0,
+    duplicate_count INT NOT NULL DEFAULT 0,
+    imported_by VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_code) REFERENCES products(code)
+);
+
+-- available -> allocated (to one transaction) or expired. The id orders codes first in, first out.
+CREATE TABLE IF NOT EXISTS voucher_codes (
+    id BIGSERIAL PRIMARY KEY,
+    batch_id VARCHAR(36) NOT NULL,
+    product_code VARCHAR(100) NOT NULL,
+    code_encrypted TEXT NOT NULL,
+    -- Keyed HMAC of the code, to reject duplicates without decrypting
+    code_hash VARCHAR(64) NOT NULL,
+    serial_no VARCHAR(100),
+    expires_at TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'available' CHECK (status IN ('available', 'allocated', 'expired')),
+    tx_id VARCHAR(36) UNIQUE,
+    tenant_id VARCHAR(36),
+    allocated_at TIMESTAMP,
+    -- Set when the code is returned to the tenant, which happens once
+    revealed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (batch_id) REFERENCES voucher_batches(id),
+    FOREIGN KEY (product_code) REFERENCES products(code),
+    FOREIGN KEY (tx_id) REFERENCES transactions(id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_voucher_codes_product_hash ON voucher_codes(product_code, code_hash);
+CREATE INDEX IF NOT EXISTS idx_voucher_codes_available ON voucher_codes(product_code, id) WHERE status = 'available';
+CREATE INDEX IF NOT EXISTS idx_voucher_codes_expiry ON voucher_codes(expires_at) WHERE status = 'available';
+CREATE INDEX IF NOT EXISTS idx_voucher_batches_product ON voucher_batches(product_code, created_at);
@@ -0,0 +1,6 @@
+-- Migration: 022_transaction_fulfillment.sql
+-- Description: What a paid transaction delivered to the customer (PLN token, serial number, kWh)
+
+-- Plain fields as JSON; the sensitive ones (the token) are kept apart, encrypted with PPOB_ENCRYPTION_KEY
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fulfillment_json TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fulfillment_encrypted TEXT;
@@ -0,0 +1,25 @@
+-- Migration: 023_receipts.sql
+-- Description: Tenant receipt branding and the receipts rendered for successful transactions
+
+-- Shown on every receipt of the tenant; without a row the tenant name is used
+CREATE TABLE IF NOT EXISTS tenant_branding (
+    tenant_id VARCHAR(36) PRIMARY KEY,
+    display_name VARCHAR(100) NOT NULL,
+    address VARCHAR(255),
+    phone VARCHAR(50),
+    footer VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- Object storage keys of a transaction's receipt, in PDF and thermal-printer text
+CREATE TABLE IF NOT EXISTS receipts (
+    tx_id VARCHAR(36) PRIMARY KEY,
+    tenant_id VARCHAR(36) NOT NULL,
+    pdf_key VARCHAR(255) NOT NULL,
+    text_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tx_id) REFERENCES transactions(id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
@@ -0,0 +1,16 @@
+-- Migration: 024_transaction_search.sql
+-- Description: Indexes for listing a tenant's transactions newest first with filters
+
+-- Every listing is scoped to a tenant and paged by (created_at, id), so each index leads
+-- with tenant_id and ends with the page key; filters without an index of their own
+-- (amount range) are applied while walking the tenant index.
+-- On a large live table, create these with CREATE INDEX CONCURRENTLY outside a transaction.
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_created ON transactions(tenant_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_partner_created ON transactions(tenant_id, partner_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_status_created ON transactions(tenant_id, status, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_product_created ON transactions(tenant_id, product_code, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_provider_created ON transactions(tenant_id, provider, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_customer_created ON transactions(tenant_id, customer_no, created_at, id);
+
+-- Superseded by idx_transactions_tenant_created, which has the same leading column
+DROP INDEX IF EXISTS idx_transactions_tenant_id;
@@ -0,0 +1,11 @@
+-- Migration: 025_idempotency_keys.sql
+-- Description: Idempotency keys unique per tenant, with the hash of the request each key was used with
+
+-- Keys were unique across tenants, so one tenant's key could collide with another's
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_idempotency_key_key;
+DROP INDEX IF EXISTS idx_transactions_idempotency_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_tenant_idempotency_key ON transactions(tenant_id, idempotency_key);
+
+-- SHA-256 of the request that created the transaction, to reject a key reused for another
+-- request; NULL for transactions created before it was recorded
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS request_hash VARCHAR(64);
@@ -0,0 +1,9 @@
+-- Migration: 026_outbox_leases.sql
+-- Description: Outbox events are claimed with a lease, per aggregate type, instead of a row lock held while publishing
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS lock_owner VARCHAR(36);
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+-- Each service relays only the aggregate types it writes
+DROP INDEX IF EXISTS idx_outbox_events_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished ON outbox_events(aggregate_type, seq) WHERE published_at IS NULL;
@@ -0,0 +1,63 @@
+-- Migration: 027_seed_catalog.sql
+-- Description: Insert catalog and receipt branding seed data for development and testing
+
+-- Insert test products
+INSERT INTO products (code, name, category, denomination, base_cost) VALUES
+    ('PULSA_TSEL_10', 'Pulsa Telkomsel 10.000', 'pulsa', 10000, 9850),
+    ('PULSA_TSEL_50', 'Pulsa Telkomsel 50.000', 'pulsa', 50000, 49500),
+    ('DATA_TSEL_5GB', 'Paket Data Telkomsel 5GB', 'data', 65000, 63000),
+    ('PLN_PREPAID', 'Token PLN 50.000', 'pln_prepaid', 50000, 50000),
+    ('PLN_POSTPAID', 'Tagihan PLN Pascabayar', 'pln_postpaid', NULL, 1500),
+    ('BPJS_KES', 'BPJS Kesehatan', 'bpjs', NULL, 1500),
+    ('PDAM', 'Tagihan PDAM', 'pdam', NULL, 1500),
+    ('GOPAY_TOPUP', 'Top Up GoPay', 'ewallet', NULL, 500)
+ON CONFLICT DO NOTHING;
+
+-- Insert test tenant prices
+INSERT INTO tenant_product_prices (id, tenant_id, product_code, selling_price, fee, created_at, updated_at)
+SELECT gen_random_uuid()::text, t.id, p.code, NULL, p.fee, NOW(), NOW()
+FROM tenants t
+CROSS JOIN (VALUES
+    ('PULSA_TSEL_10', 500),
+    ('PULSA_TSEL_50', 1000),
+    ('DATA_TSEL_5GB', 1000),
+    ('PLN_PREPAID', 2500),
+    ('PLN_POSTPAID', 2500),
+    ('BPJS_KES', 2500),
+    ('PDAM', 2500),
+    ('GOPAY_TOPUP', 1000)
+) AS p(code, fee)
+WHERE t.id = 'tenant_001'
+ON CONFLICT DO NOTHING;
+
+-- Test prepaid top-ups can be reversed within 10 minutes
+UPDATE products SET cancel_window = 600
+WHERE code IN ('PULSA_TSEL_10', 'PULSA_TSEL_50', 'DATA_TSEL_5GB', 'GOPAY_TOPUP') AND cancel_window = 0;
+
+-- Insert test voucher products
+INSERT INTO products (code, name, category, denomination, base_cost, low_stock_threshold) VALUES
+    ('GAME_ML_86', 'Mobile Legends 86 Diamonds', 'game_voucher', 20000, 19000, 10),
+    ('GIFT_NETFLIX_1M', 'Netflix Gift Card 1 Bulan', 'gift_card', 186000, 180000, 5)
+ON CONFLICT DO NOTHING;
+
+-- Insert test tenant voucher prices
+INSERT INTO tenant_product_prices (id, tenant_id, product_code, selling_price, fee, created_at, updated_at)
+SELECT gen_random_uuid()::text, t.id, p.code, NULL, p.fee, NOW(), NOW()
+FROM tenants t
+CROSS JOIN (VALUES
+    ('GAME_ML_86', 1000),
+    ('GIFT_NETFLIX_1M', 2500)
+) AS p(code, fee)
+WHERE t.id = 'tenant_001'
+ON CONFLICT DO NOTHING;
+
+-- Voucher products of the test tenant are served from stock ahead of the mock biller
+INSERT INTO provider_configs (id, tenant_id, provider_name, adapter, priority, product_codes, active, created_at)
+VALUES ('provider_config_inventory', 'tenant_001', 'voucher_inventory', 'inventory', 0,
+        ARRAY['GAME_ML_86', 'GIFT_NETFLIX_1M'], true, NOW())
+ON CONFLICT DO NOTHING;
+
+-- Insert test tenant receipt branding
+INSERT INTO tenant_branding (tenant_id, display_name, address, phone, footer, created_at, updated_at)
+VALUES ('tenant_001', 'Mitra Indonesia', 'Jl. Sudirman No. 1, Jakarta', '021-5550100', 'Terima kasih. Simpan struk ini sebagai bukti pembayaran yang sah.', NOW(), NOW())
+ON CONFLICT DO NOTHING;
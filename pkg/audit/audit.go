@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Execer is satisfied by both the pool and a transaction, so an audit entry
+// can be written atomically with the change it describes
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Record writes an entry to audit_logs with payload encoded as JSON
+func Record(ctx context.Context, db Execer, resourceType, resourceID, action string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit payload: %w", err)
+	}
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO audit_logs (id, resource_type, resource_id, action, payload_json, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.New().String(), resourceType, resourceID, action, string(payloadJSON), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the biller while its breaker is open.
+// It wraps ErrUnavailable because nothing was sent.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Breaker states
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerConfig configures when a breaker opens and how it recovers
+type BreakerConfig struct {
+	// FailureThreshold consecutive transient or unknown-outcome failures open the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting probes through
+	OpenTimeout time.Duration
+	// HalfOpenMax is how many probe calls may be in flight while half-open
+	HalfOpenMax int
+}
+
+// BreakerSnapshot is a point-in-time view of a breaker
+type BreakerSnapshot struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt *time.Time   `json:"opened_at"`
+}
+
+// Breaker is a closed/open/half-open circuit breaker. Business failures do not count
+// against it: a biller that refuses a payment is still healthy.
+type Breaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+	now      func() time.Time
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{
+		cfg:   normalizeBreakerConfig(cfg),
+		state: BreakerClosed,
+		now:   time.Now,
+	}
+}
+
+// SetConfig replaces the thresholds, keeping the current state
+func (b *Breaker) SetConfig(cfg BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = normalizeBreakerConfig(cfg)
+}
+
+// Available reports whether a call would currently be let through, without taking a probe slot
+func (b *Breaker) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state == BreakerClosed || (b.state == BreakerHalfOpen && b.probes < b.cfg.HalfOpenMax)
+}
+
+// Allow reserves a call, returning ErrCircuitOpen if the breaker refuses it.
+// Every allowed call must be followed by Record.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerHalfOpen:
+		if b.probes < b.cfg.HalfOpenMax {
+			b.probes++
+			return nil
+		}
+	}
+	return ErrCircuitOpen
+}
+
+// Record reports the outcome of an allowed call
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	class := Classify(err)
+	failed := class == ClassTransient || class == ClassUnknownOutcome
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		if failed {
+			b.trip()
+			return
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.trip()
+		}
+	}
+}
+
+// Snapshot returns the breaker's current state
+func (b *Breaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+
+	s := BreakerSnapshot{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+// advance moves an open breaker to half-open once its timeout has passed. Callers hold mu.
+func (b *Breaker) advance() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+}
+
+// trip opens the breaker. Callers hold mu.
+func (b *Breaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.probes = 0
+}
+
+func normalizeBreakerConfig(cfg BreakerConfig) BreakerConfig {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenMax < 1 {
+		cfg.HalfOpenMax = 1
+	}
+	return cfg
+}
+
+// Guarded decorates a provider with a circuit breaker
+type Guarded struct {
+	provider Provider
+	breaker  *Breaker
+}
+
+// NewGuarded wraps provider with breaker
+func NewGuarded(provider Provider, breaker *Breaker) *Guarded {
+	return &Guarded{provider: provider, breaker: breaker}
+}
+
+// Name returns the wrapped provider's name
+func (g *Guarded) Name() string {
+	return g.provider.Name()
+}
+
+// Inquiry calls the wrapped provider if the breaker allows it
+func (g *Guarded) Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error) {
+	if err := g.breaker.Allow(); err != nil {
+		return InquiryResponse{}, fmt.Errorf("%w: %s", err, g.Name())
+	}
+	resp, err := g.provider.Inquiry(ctx, request)
+	g.breaker.Record(err)
+	return resp, err
+}
+
+// Pay calls the wrapped provider if the breaker allows it
+func (g *Guarded) Pay(ctx context.Context, request PayRequest) (PayResponse, error) {
+	if err := g.breaker.Allow(); err != nil {
+		return PayResponse{RefNo: request.RefNo}, fmt.Errorf("%w: %s", err, g.Name())
+	}
+	resp, err := g.provider.Pay(ctx, request)
+	g.breaker.Record(err)
+	return resp, err
+}
+
+// Cancel calls the wrapped provider if the breaker allows it
+func (g *Guarded) Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error) {
+	if err := g.breaker.Allow(); err != nil {
+		return CancelResponse{RefNo: request.RefNo}, fmt.Errorf("%w: %s", err, g.Name())
+	}
+	resp, err := g.provider.Cancel(ctx, request)
+	g.breaker.Record(err)
+	return resp, err
+}
+
+// CheckStatus calls the wrapped provider if the breaker allows it
+func (g *Guarded) CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error) {
+	if err := g.breaker.Allow(); err != nil {
+		return StatusResponse{RefNo: request.RefNo}, fmt.Errorf("%w: %s", err, g.Name())
+	}
+	resp, err := g.provider.CheckStatus(ctx, request)
+	g.breaker.Record(err)
+	return resp, err
+}
@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker whose clock is advanced by moving *now
+func newTestBreaker(cfg BreakerConfig) (*Breaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(cfg)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// call runs one call through b that ends with err
+func call(b *Breaker, err error) error {
+	if allowErr := b.Allow(); allowErr != nil {
+		return allowErr
+	}
+	b.Record(err)
+	return nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		wantOpen bool
+	}{
+		{
+			name:     "transient failures",
+			errs:     []error{ErrUnavailable, ErrUnavailable, ErrUnavailable},
+			wantOpen: true,
+		},
+		{
+			name:     "unknown outcomes count",
+			errs:     []error{ErrTimeout, ErrUnknownOutcome, errors.New("untyped")},
+			wantOpen: true,
+		},
+		{
+			name: "below threshold",
+			errs: []error{ErrUnavailable, ErrUnavailable},
+		},
+		{
+			name: "business failures do not count",
+			errs: []error{ErrRejected, ErrRejected, ErrRejected, ErrRejected},
+		},
+		{
+			name: "success resets the count",
+			errs: []error{ErrUnavailable, ErrUnavailable, nil, ErrUnavailable, ErrUnavailable},
+		},
+		{
+			name: "business failure resets the count",
+			errs: []error{ErrUnavailable, ErrUnavailable, ErrRejected, ErrUnavailable, ErrUnavailable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenMax: 1})
+			for i, err := range tt.errs {
+				if allowErr := call(b, err); allowErr != nil {
+					t.Fatalf("call %d refused: %v", i+1, allowErr)
+				}
+			}
+			gotOpen := b.Snapshot().State == BreakerOpen
+			if gotOpen != tt.wantOpen {
+				t.Errorf("open = %v, want %v (%+v)", gotOpen, tt.wantOpen, b.Snapshot())
+			}
+			if err := b.Allow(); tt.wantOpen && !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("Allow() on open breaker = %v, want %v", err, ErrCircuitOpen)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probeErr  error
+		wantState BreakerState
+	}{
+		{name: "probe succeeds", probeErr: nil, wantState: BreakerClosed},
+		{name: "probe rejected by biller", probeErr: ErrRejected, wantState: BreakerClosed},
+		{name: "probe fails", probeErr: ErrUnavailable, wantState: BreakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, now := newTestBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenMax: 1})
+			call(b, ErrUnavailable)
+
+			*now = now.Add(59 * time.Second)
+			if b.Available() {
+				t.Fatal("breaker available before its open timeout")
+			}
+
+			*now = now.Add(time.Second)
+			if s := b.Snapshot(); s.State != BreakerHalfOpen {
+				t.Fatalf("state after timeout = %s, want %s", s.State, BreakerHalfOpen)
+			}
+			if err := b.Allow(); err != nil {
+				t.Fatalf("probe refused: %v", err)
+			}
+			// Only HalfOpenMax probes are in flight at once
+			if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("second probe Allow() = %v, want %v", err, ErrCircuitOpen)
+			}
+			if b.Available() {
+				t.Error("breaker available with every probe slot taken")
+			}
+
+			b.Record(tt.probeErr)
+			if s := b.Snapshot(); s.State != tt.wantState {
+				t.Errorf("state after probe = %s, want %s", s.State, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerNormalizesConfig(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{OpenTimeout: time.Minute})
+	call(b, ErrUnavailable)
+	if s := b.Snapshot(); s.State != BreakerOpen {
+		t.Errorf("state = %s, want %s with a threshold of at least 1", s.State, BreakerOpen)
+	}
+}
+
+func TestGuardedDoesNotCallWhileOpen(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	p := &scripted{errs: []error{ErrUnavailable}}
+	g := NewGuarded(p, b)
+
+	if _, err := g.Pay(context.Background(), payRequest); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first Pay() error = %v, want %v", err, ErrUnavailable)
+	}
+	resp, err := g.Pay(context.Background(), payRequest)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Pay() on open breaker error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if resp.RefNo != payRequest.RefNo {
+		t.Errorf("Pay() ref no = %q, want %q", resp.RefNo, payRequest.RefNo)
+	}
+	if p.calls != 1 {
+		t.Errorf("provider called %d times, want 1", p.calls)
+	}
+	// Nothing was sent, so the refusal is safe to fail on
+	if got := Classify(fmt.Errorf("pay: %w", err)); got != ClassTransient {
+		t.Errorf("Classify(ErrCircuitOpen) = %q, want %q", got, ClassTransient)
+	}
+}
@@ -0,0 +1,290 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying the request signature sent to billers
+const (
+	HeaderAPIKey    = "X-Api-Key"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// Provider errors, see Classify for how each is retried
+var (
+	// ErrUnavailable means the request never reached the biller or was refused before processing
+	ErrUnavailable = errors.New("provider unavailable")
+	// ErrRejected is a business failure reported by the biller
+	ErrRejected = errors.New("provider rejected request")
+	// ErrTimeout means no answer arrived in time; the biller may still process the request
+	ErrTimeout = errors.New("provider request timed out")
+	// ErrUnknownOutcome means the exchange broke off after the request may have been processed
+	ErrUnknownOutcome = errors.New("provider outcome unknown")
+)
+
+// DefaultStatusMap maps common biller response codes to our statuses
+var DefaultStatusMap = map[string]string{
+	"00": StatusSuccess,
+	"68": StatusPending,
+}
+
+// HTTPConfig configures an HTTP provider, usually loaded from provider_configs
+type HTTPConfig struct {
+	Name     string
+	Endpoint string
+	APIKey   string
+	// Secret signs each request; requests are unsigned when empty
+	Secret  string
+	Timeout time.Duration
+	// StatusMap maps biller response codes to success, failed or pending.
+	// DefaultStatusMap is used when nil.
+	StatusMap map[string]string
+}
+
+// HTTPProvider calls a biller's JSON API. Each operation is a POST of the request
+// struct to endpoint + /inquiry, /pay, /cancel or /status. When a secret is set the request
+// carries X-Timestamp and X-Signature = hex(HMAC-SHA256(secret, "METHOD\nPATH\nTIMESTAMP\nBODY")).
+type HTTPProvider struct {
+	cfg  HTTPConfig
+	http *http.Client
+}
+
+// billerResponse is the response body of every biller operation
+type billerResponse struct {
+	RC            string `json:"rc"`
+	Message       string `json:"message"`
+	CustomerNo    string `json:"customer_no"`
+	CustomerName  string `json:"customer_name"`
+	Amount        int64  `json:"amount"`
+	AdminFee      int64  `json:"admin_fee"`
+	RefNo         string `json:"ref_no"`
+	ProviderRefNo string `json:"provider_ref_no"`
+	// Fulfillment fields of pay and status responses
+	Token    string `json:"token"`
+	SerialNo string `json:"serial_no"`
+	KWh      string `json:"kwh"`
+	Tariff   string `json:"tariff"`
+}
+
+// fulfillment returns what a paid response delivered, or nil when it carries nothing
+func (br billerResponse) fulfillment() *Fulfillment {
+	if br.Token == "" && br.SerialNo == "" && br.KWh == "" {
+		return nil
+	}
+	return &Fulfillment{
+		Token:        br.Token,
+		SerialNo:     br.SerialNo,
+		KWh:          br.KWh,
+		CustomerName: br.CustomerName,
+		Tariff:       br.Tariff,
+	}
+}
+
+// NewHTTPProvider creates an HTTP provider
+func NewHTTPProvider(cfg HTTPConfig) *HTTPProvider {
+	if cfg.StatusMap == nil {
+		cfg.StatusMap = DefaultStatusMap
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &HTTPProvider{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Name returns the configured provider name
+func (p *HTTPProvider) Name() string {
+	return p.cfg.Name
+}
+
+// Inquiry asks the biller for a customer's bill
+func (p *HTTPProvider) Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error) {
+	br, err := p.post(ctx, "/inquiry", request)
+	if err != nil {
+		return InquiryResponse{}, err
+	}
+	status := p.status(br.RC, StatusFailed)
+	return InquiryResponse{
+		CustomerNo:   br.CustomerNo,
+		CustomerName: br.CustomerName,
+		Amount:       br.Amount,
+		AdminFee:     br.AdminFee,
+		Status:       status,
+	}, nil
+}
+
+// Pay sends a payment. An unmapped response code is reported as pending because
+// the biller may still have taken the payment.
+func (p *HTTPProvider) Pay(ctx context.Context, request PayRequest) (PayResponse, error) {
+	br, err := p.post(ctx, "/pay", request)
+	if err != nil {
+		return PayResponse{RefNo: request.RefNo}, err
+	}
+	resp := PayResponse{
+		RefNo:         request.RefNo,
+		ProviderRefNo: br.ProviderRefNo,
+		Status:        p.status(br.RC, StatusPending),
+		Message:       br.Message,
+	}
+	if resp.Status == StatusSuccess {
+		resp.Fulfillment = br.fulfillment()
+	}
+	if resp.Status == StatusFailed {
+		return resp, fmt.Errorf("%w: rc %s: %s", ErrRejected, br.RC, br.Message)
+	}
+	return resp, nil
+}
+
+// Cancel asks the biller to reverse a payment
+func (p *HTTPProvider) Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error) {
+	br, err := p.post(ctx, "/cancel", request)
+	if err != nil {
+		return CancelResponse{RefNo: request.RefNo}, err
+	}
+	resp := CancelResponse{
+		RefNo:   request.RefNo,
+		Status:  p.status(br.RC, StatusFailed),
+		Message: br.Message,
+	}
+	if resp.Status == StatusFailed {
+		return resp, fmt.Errorf("%w: rc %s: %s", ErrRejected, br.RC, br.Message)
+	}
+	return resp, nil
+}
+
+// CheckStatus asks the biller how a payment ended. An unmapped response code is reported
+// as pending, and a failed one is a status rather than an error: the biller answered.
+func (p *HTTPProvider) CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error) {
+	br, err := p.post(ctx, "/status", request)
+	if err != nil {
+		return StatusResponse{RefNo: request.RefNo}, err
+	}
+	providerRefNo := br.ProviderRefNo
+	if providerRefNo == "" {
+		providerRefNo = request.ProviderRefNo
+	}
+	resp := StatusResponse{
+		RefNo:         request.RefNo,
+		ProviderRefNo: providerRefNo,
+		Status:        p.status(br.RC, StatusPending),
+		Message:       br.Message,
+	}
+	if resp.Status == StatusSuccess {
+		resp.Fulfillment = br.fulfillment()
+	}
+	return resp, nil
+}
+
+// status maps a response code, falling back to unmapped for codes the config does not know
+func (p *HTTPProvider) status(rc, unmapped string) string {
+	if status, ok := p.cfg.StatusMap[rc]; ok {
+		return status
+	}
+	return unmapped
+}
+
+func (p *HTTPProvider) post(ctx context.Context, path string, payload interface{}) (billerResponse, error) {
+	var br billerResponse
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return br, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return br, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.APIKey != "" {
+		req.Header.Set(HeaderAPIKey, p.cfg.APIKey)
+	}
+	if p.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Signature(p.cfg.Secret, req.Method, req.URL.Path, timestamp, body))
+	}
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		switch {
+		case isDialError(err):
+			return br, fmt.Errorf("%w: %s %s: %v", ErrUnavailable, p.cfg.Name, path, err)
+		case isTimeout(err):
+			return br, fmt.Errorf("%w: %s %s: %v", ErrTimeout, p.cfg.Name, path, err)
+		default:
+			return br, fmt.Errorf("%w: %s %s: %v", ErrUnknownOutcome, p.cfg.Name, path, err)
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return br, fmt.Errorf("%w: %s %s returned %d: %s", statusCause(path, resp.StatusCode), p.cfg.Name, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&br); err != nil {
+		if isTimeout(err) {
+			return br, fmt.Errorf("%w: %s %s: %v", ErrTimeout, p.cfg.Name, path, err)
+		}
+		return br, fmt.Errorf("%w: failed to decode %s %s response: %v", ErrUnknownOutcome, p.cfg.Name, path, err)
+	}
+	return br, nil
+}
+
+// statusCause classifies a non-2xx response. 5xx and 429 are retried as the README requires and
+// other 4xx mean our request was refused. A payment is different: a gateway may answer 500, 502
+// or 504 after the biller took it, so only 503 and 429, which refuse the request before it is
+// processed, are safe to retry; any other 5xx leaves its outcome to a status check.
+func statusCause(path string, code int) error {
+	switch {
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case code >= 500 && path == "/pay":
+		return ErrUnknownOutcome
+	case code >= 500:
+		return ErrUnavailable
+	default:
+		return ErrRejected
+	}
+}
+
+// Signature computes the request signature billers verify
+func Signature(secret, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isDialError reports whether err happened while connecting, before anything was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTimeout reports whether err is a client, context or network timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,221 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// biller stands in for a biller answering every request with handler
+func biller(t *testing.T, handler http.HandlerFunc) *HTTPProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewHTTPProvider(HTTPConfig{
+		Name:     "test_biller",
+		Endpoint: srv.URL,
+		APIKey:   "key",
+		Secret:   "secret",
+		Timeout:  100 * time.Millisecond,
+		StatusMap: map[string]string{
+			"00": StatusSuccess,
+			"68": StatusPending,
+			"14": StatusFailed,
+		},
+	})
+}
+
+// respond answers with a fixed JSON body
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+var payRequest = PayRequest{ProductCode: "PLN_PREPAID_20", CustomerNo: "123456789", Amount: 20000, RefNo: "tx-1"}
+
+func TestPaySignsRequest(t *testing.T) {
+	p := biller(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/pay" {
+			t.Errorf("path = %s, want /pay", r.URL.Path)
+		}
+		if got := r.Header.Get(HeaderAPIKey); got != "key" {
+			t.Errorf("%s = %q, want key", HeaderAPIKey, got)
+		}
+		want := Signature("secret", r.Method, r.URL.Path, r.Header.Get(HeaderTimestamp), body)
+		if got := r.Header.Get(HeaderSignature); got != want {
+			t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+		}
+		respond(http.StatusOK, `{"rc":"00","provider_ref_no":"B-1","token":"1234-5678","kwh":"13.8"}`)(w, r)
+	})
+
+	resp, err := p.Pay(context.Background(), payRequest)
+	if err != nil {
+		t.Fatalf("Pay() error = %v", err)
+	}
+	if resp.Status != StatusSuccess || resp.ProviderRefNo != "B-1" {
+		t.Errorf("Pay() = %+v, want success with provider ref B-1", resp)
+	}
+	if resp.Fulfillment == nil || resp.Fulfillment.Token != "1234-5678" {
+		t.Errorf("Pay() fulfillment = %+v, want token 1234-5678", resp.Fulfillment)
+	}
+}
+
+func TestPayStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus string
+		wantErr    error
+		wantClass  ErrorClass
+	}{
+		{
+			name:       "success",
+			handler:    respond(http.StatusOK, `{"rc":"00"}`),
+			wantStatus: StatusSuccess,
+		},
+		{
+			name:       "pending",
+			handler:    respond(http.StatusOK, `{"rc":"68"}`),
+			wantStatus: StatusPending,
+		},
+		{
+			name:       "unmapped code is pending",
+			handler:    respond(http.StatusOK, `{"rc":"99"}`),
+			wantStatus: StatusPending,
+		},
+		{
+			name:       "rejected",
+			handler:    respond(http.StatusOK, `{"rc":"14","message":"unknown customer"}`),
+			wantStatus: StatusFailed,
+			wantErr:    ErrRejected,
+			wantClass:  ClassBusiness,
+		},
+		{
+			name:      "internal server error",
+			handler:   respond(http.StatusInternalServerError, `oops`),
+			wantErr:   ErrUnknownOutcome,
+			wantClass: ClassUnknownOutcome,
+		},
+		{
+			name:      "bad gateway",
+			handler:   respond(http.StatusBadGateway, `upstream down`),
+			wantErr:   ErrUnknownOutcome,
+			wantClass: ClassUnknownOutcome,
+		},
+		{
+			name:      "gateway timeout",
+			handler:   respond(http.StatusGatewayTimeout, ``),
+			wantErr:   ErrUnknownOutcome,
+			wantClass: ClassUnknownOutcome,
+		},
+		{
+			name:      "service unavailable",
+			handler:   respond(http.StatusServiceUnavailable, `maintenance`),
+			wantErr:   ErrUnavailable,
+			wantClass: ClassTransient,
+		},
+		{
+			name:      "throttled",
+			handler:   respond(http.StatusTooManyRequests, ``),
+			wantErr:   ErrUnavailable,
+			wantClass: ClassTransient,
+		},
+		{
+			name:      "bad request",
+			handler:   respond(http.StatusBadRequest, `invalid product`),
+			wantErr:   ErrRejected,
+			wantClass: ClassBusiness,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// Answer only after the client gave up, as a slow biller would
+				time.Sleep(300 * time.Millisecond)
+				respond(http.StatusOK, `{"rc":"00"}`)(w, r)
+			},
+			wantErr:   ErrTimeout,
+			wantClass: ClassUnknownOutcome,
+		},
+		{
+			name: "connection dropped",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("Hijack() error = %v", err)
+					return
+				}
+				conn.Close()
+			},
+			wantErr:   ErrUnknownOutcome,
+			wantClass: ClassUnknownOutcome,
+		},
+		{
+			name:      "malformed response",
+			handler:   respond(http.StatusOK, `{"rc":`),
+			wantErr:   ErrUnknownOutcome,
+			wantClass: ClassUnknownOutcome,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := biller(t, tt.handler)
+			resp, err := p.Pay(context.Background(), payRequest)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Pay() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := Classify(err); got != tt.wantClass {
+				t.Errorf("Classify() = %q, want %q", got, tt.wantClass)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Pay() status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if resp.RefNo != payRequest.RefNo {
+				t.Errorf("Pay() ref no = %q, want %q", resp.RefNo, payRequest.RefNo)
+			}
+		})
+	}
+}
+
+func TestPayUnreachable(t *testing.T) {
+	srv := httptest.NewServer(respond(http.StatusOK, `{"rc":"00"}`))
+	srv.Close()
+	p := NewHTTPProvider(HTTPConfig{Name: "test_biller", Endpoint: srv.URL, Timeout: 100 * time.Millisecond})
+
+	_, err := p.Pay(context.Background(), payRequest)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Pay() error = %v, want %v", err, ErrUnavailable)
+	}
+	if got := Classify(err); got != ClassTransient {
+		t.Errorf("Classify() = %q, want %q", got, ClassTransient)
+	}
+}
+
+func TestInquiryServerErrorIsTransient(t *testing.T) {
+	p := biller(t, respond(http.StatusBadGateway, `upstream down`))
+
+	_, err := p.Inquiry(context.Background(), InquiryRequest{ProductCode: "PLN_POSTPAID", CustomerNo: "123456789"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Inquiry() error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestCheckStatusReportsFailureWithoutError(t *testing.T) {
+	p := biller(t, respond(http.StatusOK, `{"rc":"14","message":"payment reversed"}`))
+
+	resp, err := p.CheckStatus(context.Background(), StatusRequest{RefNo: "tx-1", ProviderRefNo: "B-1"})
+	if err != nil {
+		t.Fatalf("CheckStatus() error = %v", err)
+	}
+	if resp.Status != StatusFailed || resp.ProviderRefNo != "B-1" {
+		t.Errorf("CheckStatus() = %+v, want failed with provider ref B-1", resp)
+	}
+}
@@ -4,15 +4,29 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"strings"
+	"time"
 )
 
 // Provider defines the interface for provider connectors
 type Provider interface {
+	// Name identifies the provider on transactions and inquiries
+	Name() string
 	Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error)
 	Pay(ctx context.Context, request PayRequest) (PayResponse, error)
 	Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error)
+	// CheckStatus asks the biller how a payment sent with RefNo ended
+	CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error)
 }
 
+// Provider statuses reported on responses
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	// StatusPending means the biller accepted the request but has not settled it yet
+	StatusPending = "pending"
+)
+
 // InquiryRequest is the request for inquiry
 type InquiryRequest struct {
 	ProductCode string `json:"product_code"`
@@ -42,6 +56,20 @@ type PayResponse struct {
 	ProviderRefNo string `json:"provider_ref_no"`
 	Status        string `json:"status"`
 	Message       string `json:"message"`
+	// Fulfillment is what the biller delivered for a successful payment, if anything
+	Fulfillment *Fulfillment `json:"fulfillment,omitempty"`
+}
+
+// Fulfillment is what a paid product delivers to the customer, such as a PLN prepaid token
+// with its kWh, or a voucher serial number. Token is a credential: whoever holds it can
+// redeem it, so it is the part stored encrypted.
+type Fulfillment struct {
+	Token        string     `json:"token,omitempty"`
+	SerialNo     string     `json:"serial_no,omitempty"`
+	KWh          string     `json:"kwh,omitempty"`
+	CustomerName string     `json:"customer_name,omitempty"`
+	Tariff       string     `json:"tariff,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
 }
 
 // CancelRequest is the request for cancellation
@@ -57,22 +85,51 @@ type CancelResponse struct {
 	Message string `json:"message"`
 }
 
+// StatusRequest asks for the outcome of an earlier payment
+type StatusRequest struct {
+	RefNo         string `json:"ref_no"`
+	ProviderRefNo string `json:"provider_ref_no"`
+}
+
+// StatusResponse is the biller's view of an earlier payment
+type StatusResponse struct {
+	RefNo         string `json:"ref_no"`
+	ProviderRefNo string `json:"provider_ref_no"`
+	Status        string `json:"status"`
+	Message       string `json:"message"`
+	// Fulfillment is set when the biller reports what a successful payment delivered
+	Fulfillment *Fulfillment `json:"fulfillment,omitempty"`
+}
+
 // MockProvider is a mock provider for testing and local development
 type MockProvider struct {
+	name        string
 	failureRate int // 0-100
 }
 
-// NewMockProvider creates a new mock provider
+// NewMockProvider creates a new mock provider named as in the seed data
 func NewMockProvider(failureRate int) *MockProvider {
 	return &MockProvider{
+		name:        "mock_provider",
 		failureRate: failureRate,
 	}
 }
 
+// WithName renames the mock, e.g. after the provider config it stands in for
+func (m *MockProvider) WithName(name string) *MockProvider {
+	m.name = name
+	return m
+}
+
+// Name returns the provider name
+func (m *MockProvider) Name() string {
+	return m.name
+}
+
 // Inquiry simulates an inquiry call
 func (m *MockProvider) Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error) {
 	if request.CustomerNo == "" {
-		return InquiryResponse{}, fmt.Errorf("invalid customer number")
+		return InquiryResponse{}, fmt.Errorf("%w: invalid customer number", ErrRejected)
 	}
 
 	return InquiryResponse{
@@ -80,42 +137,84 @@ func (m *MockProvider) Inquiry(ctx context.Context, request InquiryRequest) (Inq
 		CustomerName: fmt.Sprintf("Customer %s", request.CustomerNo),
 		Amount:       50000,
 		AdminFee:     2500,
-		Status:       "success",
+		Status:       StatusSuccess,
 	}, nil
 }
 
 // Pay simulates a payment call
 func (m *MockProvider) Pay(ctx context.Context, request PayRequest) (PayResponse, error) {
 	if request.CustomerNo == "" {
-		return PayResponse{}, fmt.Errorf("invalid customer number")
+		return PayResponse{}, fmt.Errorf("%w: invalid customer number", ErrRejected)
 	}
 
 	// Simulate random failure based on failureRate
 	if rand.Intn(100) < m.failureRate {
 		return PayResponse{
 			RefNo:   request.RefNo,
-			Status:  "failed",
+			Status:  StatusFailed,
 			Message: "Provider temporarily unavailable",
-		}, fmt.Errorf("provider payment failed")
+		}, fmt.Errorf("%w: provider payment failed", ErrUnavailable)
 	}
 
+	providerRefNo := fmt.Sprintf("MOCK-%d", rand.Int63())
 	return PayResponse{
 		RefNo:         request.RefNo,
-		ProviderRefNo: fmt.Sprintf("MOCK-%d", rand.Int63()),
-		Status:        "success",
+		ProviderRefNo: providerRefNo,
+		Status:        StatusSuccess,
 		Message:       "Payment successful",
+		Fulfillment:   mockFulfillment(request, providerRefNo),
 	}, nil
 }
 
+// mockFulfillment makes up a PLN prepaid token for PLN_* prepaid products and a serial
+// number for everything else
+func mockFulfillment(request PayRequest, providerRefNo string) *Fulfillment {
+	f := &Fulfillment{
+		SerialNo:     providerRefNo,
+		CustomerName: fmt.Sprintf("Customer %s", request.CustomerNo),
+	}
+	if strings.HasPrefix(request.ProductCode, "PLN_PREPAID") {
+		var token strings.Builder
+		for i := 0; i < 20; i++ {
+			if i > 0 && i%4 == 0 {
+				token.WriteByte('-')
+			}
+			token.WriteByte(byte('0' + rand.Intn(10)))
+		}
+		f.Token = token.String()
+		f.KWh = fmt.Sprintf("%.1f", float64(request.Amount)/1444.7)
+		f.Tariff = "R1/1300VA"
+	}
+	return f
+}
+
 // Cancel simulates a cancellation call
 func (m *MockProvider) Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error) {
 	if request.RefNo == "" {
-		return CancelResponse{}, fmt.Errorf("invalid reference number")
+		return CancelResponse{}, fmt.Errorf("%w: invalid reference number", ErrRejected)
 	}
 
 	return CancelResponse{
 		RefNo:   request.RefNo,
-		Status:  "success",
+		Status:  StatusSuccess,
 		Message: "Cancellation successful",
 	}, nil
 }
+
+// CheckStatus simulates a status check; the mock settles every payment it is asked about
+func (m *MockProvider) CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error) {
+	if request.RefNo == "" {
+		return StatusResponse{}, fmt.Errorf("%w: invalid reference number", ErrRejected)
+	}
+
+	providerRefNo := request.ProviderRefNo
+	if providerRefNo == "" {
+		providerRefNo = fmt.Sprintf("MOCK-%d", rand.Int63())
+	}
+	return StatusResponse{
+		RefNo:         request.RefNo,
+		ProviderRefNo: providerRefNo,
+		Status:        StatusSuccess,
+		Message:       "Payment successful",
+	}, nil
+}
@@ -0,0 +1,187 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrorClass says whether a failed provider call may be retried
+type ErrorClass string
+
+// Error classes
+const (
+	// ClassTransient means the biller did not process the request, so it is safe to send again
+	ClassTransient ErrorClass = "transient"
+	// ClassBusiness means the biller refused the request; sending it again gives the same answer
+	ClassBusiness ErrorClass = "business"
+	// ClassUnknownOutcome means the biller may or may not have processed the request
+	ClassUnknownOutcome ErrorClass = "unknown_outcome"
+)
+
+// Classify maps a provider error to its class. Errors that are not typed are treated as
+// an unknown outcome, the only class that never leads to a payment being retried or refunded.
+func Classify(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrRejected):
+		return ClassBusiness
+	case errors.Is(err, ErrUnavailable):
+		return ClassTransient
+	default:
+		return ClassUnknownOutcome
+	}
+}
+
+// RetryPolicy configures retries with exponential backoff and jitter
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy retries up to three attempts in total
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// Attempt describes one call made by a Retrying provider
+type Attempt struct {
+	Provider  string
+	Operation string
+	// RefNo is our transaction reference, empty for inquiries
+	RefNo    string
+	Number   int
+	Status   string
+	Class    ErrorClass
+	Err      error
+	Duration time.Duration
+}
+
+// Retrying decorates a provider with retries. Pay and Cancel are only retried on transient
+// errors; read-only inquiries are also retried when the outcome is unknown.
+type Retrying struct {
+	provider Provider
+	policy   RetryPolicy
+	observe  func(ctx context.Context, a Attempt)
+}
+
+// NewRetrying wraps provider. observe, if not nil, is called after every attempt.
+func NewRetrying(provider Provider, policy RetryPolicy, observe func(ctx context.Context, a Attempt)) *Retrying {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &Retrying{
+		provider: provider,
+		policy:   policy,
+		observe:  observe,
+	}
+}
+
+// Name returns the wrapped provider's name
+func (r *Retrying) Name() string {
+	return r.provider.Name()
+}
+
+// Inquiry calls the wrapped provider, retrying transient and unknown-outcome errors
+func (r *Retrying) Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error) {
+	var resp InquiryResponse
+	err := r.do(ctx, "inquiry", "", true, func() (string, error) {
+		var err error
+		resp, err = r.provider.Inquiry(ctx, request)
+		return resp.Status, err
+	})
+	return resp, err
+}
+
+// Pay calls the wrapped provider, retrying transient errors with the same ref_no
+func (r *Retrying) Pay(ctx context.Context, request PayRequest) (PayResponse, error) {
+	var resp PayResponse
+	err := r.do(ctx, "pay", request.RefNo, false, func() (string, error) {
+		var err error
+		resp, err = r.provider.Pay(ctx, request)
+		return resp.Status, err
+	})
+	return resp, err
+}
+
+// Cancel calls the wrapped provider, retrying transient errors
+func (r *Retrying) Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error) {
+	var resp CancelResponse
+	err := r.do(ctx, "cancel", request.RefNo, false, func() (string, error) {
+		var err error
+		resp, err = r.provider.Cancel(ctx, request)
+		return resp.Status, err
+	})
+	return resp, err
+}
+
+// CheckStatus calls the wrapped provider, retrying transient and unknown-outcome errors
+func (r *Retrying) CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error) {
+	var resp StatusResponse
+	err := r.do(ctx, "status", request.RefNo, true, func() (string, error) {
+		var err error
+		resp, err = r.provider.CheckStatus(ctx, request)
+		return resp.Status, err
+	})
+	return resp, err
+}
+
+func (r *Retrying) do(ctx context.Context, operation, refNo string, readOnly bool, call func() (string, error)) error {
+	var err error
+	for n := 1; ; n++ {
+		start := time.Now()
+		var status string
+		status, err = call()
+
+		class := Classify(err)
+		if r.observe != nil {
+			r.observe(ctx, Attempt{
+				Provider:  r.provider.Name(),
+				Operation: operation,
+				RefNo:     refNo,
+				Number:    n,
+				Status:    status,
+				Class:     class,
+				Err:       err,
+				Duration:  time.Since(start),
+			})
+		}
+
+		// An open breaker stays open for longer than the backoff, so retrying it only adds delay
+		retryable := (class == ClassTransient && !errors.Is(err, ErrCircuitOpen)) ||
+			(readOnly && class == ClassUnknownOutcome)
+		if err == nil || !retryable || n >= r.policy.MaxAttempts {
+			return err
+		}
+
+		// Give up rather than start an attempt the caller's deadline would cut short
+		delay := r.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay after attempt n: base * 2^(n-1) capped at MaxDelay, plus up to 50% jitter
+func (r *Retrying) backoff(n int) time.Duration {
+	delay := r.policy.BaseDelay << (n - 1)
+	if r.policy.MaxDelay > 0 && (delay > r.policy.MaxDelay || delay <= 0) {
+		delay = r.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
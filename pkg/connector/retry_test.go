@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// scripted is a provider whose calls fail with errs in turn and succeed once they run out
+type scripted struct {
+	errs  []error
+	calls int
+}
+
+func (s *scripted) next() error {
+	s.calls++
+	if s.calls > len(s.errs) {
+		return nil
+	}
+	return s.errs[s.calls-1]
+}
+
+func (s *scripted) Name() string { return "scripted" }
+
+func (s *scripted) Inquiry(ctx context.Context, request InquiryRequest) (InquiryResponse, error) {
+	if err := s.next(); err != nil {
+		return InquiryResponse{}, err
+	}
+	return InquiryResponse{Status: StatusSuccess}, nil
+}
+
+func (s *scripted) Pay(ctx context.Context, request PayRequest) (PayResponse, error) {
+	if err := s.next(); err != nil {
+		return PayResponse{RefNo: request.RefNo}, err
+	}
+	return PayResponse{RefNo: request.RefNo, Status: StatusSuccess}, nil
+}
+
+func (s *scripted) Cancel(ctx context.Context, request CancelRequest) (CancelResponse, error) {
+	if err := s.next(); err != nil {
+		return CancelResponse{RefNo: request.RefNo}, err
+	}
+	return CancelResponse{RefNo: request.RefNo, Status: StatusSuccess}, nil
+}
+
+func (s *scripted) CheckStatus(ctx context.Context, request StatusRequest) (StatusResponse, error) {
+	if err := s.next(); err != nil {
+		return StatusResponse{RefNo: request.RefNo}, err
+	}
+	return StatusResponse{RefNo: request.RefNo, Status: StatusSuccess}, nil
+}
+
+var noDelay = RetryPolicy{MaxAttempts: 3}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{err: nil, want: ""},
+		{err: ErrRejected, want: ClassBusiness},
+		{err: fmt.Errorf("pay: %w", ErrRejected), want: ClassBusiness},
+		{err: ErrUnavailable, want: ClassTransient},
+		{err: ErrCircuitOpen, want: ClassTransient},
+		{err: ErrTimeout, want: ClassUnknownOutcome},
+		{err: ErrUnknownOutcome, want: ClassUnknownOutcome},
+		{err: errors.New("untyped"), want: ClassUnknownOutcome},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryingPay(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "transient then success", errs: []error{ErrUnavailable, ErrUnavailable}, wantCalls: 3},
+		{name: "transient until exhausted", errs: []error{ErrUnavailable, ErrUnavailable, ErrUnavailable, ErrUnavailable}, wantErr: ErrUnavailable, wantCalls: 3},
+		{name: "business is not retried", errs: []error{ErrRejected}, wantErr: ErrRejected, wantCalls: 1},
+		{name: "unknown outcome is not retried", errs: []error{ErrTimeout}, wantErr: ErrTimeout, wantCalls: 1},
+		{name: "open breaker is not retried", errs: []error{ErrCircuitOpen}, wantErr: ErrCircuitOpen, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &scripted{errs: tt.errs}
+			var attempts []Attempt
+			r := NewRetrying(p, noDelay, func(ctx context.Context, a Attempt) {
+				attempts = append(attempts, a)
+			})
+
+			_, err := r.Pay(context.Background(), payRequest)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Pay() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", p.calls, tt.wantCalls)
+			}
+			if len(attempts) != tt.wantCalls {
+				t.Fatalf("observed %d attempts, want %d", len(attempts), tt.wantCalls)
+			}
+			for i, a := range attempts {
+				if a.Number != i+1 || a.Operation != "pay" || a.RefNo != payRequest.RefNo {
+					t.Errorf("attempt %d = %+v", i+1, a)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryingReadsRetryUnknownOutcome(t *testing.T) {
+	p := &scripted{errs: []error{ErrTimeout, ErrUnknownOutcome}}
+	r := NewRetrying(p, noDelay, nil)
+
+	if _, err := r.CheckStatus(context.Background(), StatusRequest{RefNo: "tx-1"}); err != nil {
+		t.Fatalf("CheckStatus() error = %v", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("calls = %d, want 3", p.calls)
+	}
+}
+
+func TestRetryingStopsBeforeDeadline(t *testing.T) {
+	p := &scripted{errs: []error{ErrUnavailable, ErrUnavailable}}
+	r := NewRetrying(p, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.Pay(ctx, payRequest); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Pay() error = %v, want %v", err, ErrUnavailable)
+	}
+	if p.calls != 1 {
+		t.Errorf("calls = %d, want 1: the backoff outlasts the deadline", p.calls)
+	}
+}
+
+func TestRetryingBackoff(t *testing.T) {
+	r := NewRetrying(&scripted{}, RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}, nil)
+
+	tests := []struct {
+		n    int
+		base time.Duration
+	}{
+		{n: 1, base: 100 * time.Millisecond},
+		{n: 2, base: 200 * time.Millisecond},
+		{n: 3, base: 300 * time.Millisecond},
+		{n: 10, base: 300 * time.Millisecond},
+		{n: 70, base: 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := r.backoff(tt.n)
+			if got < tt.base || got > tt.base+tt.base/2 {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.n, got, tt.base, tt.base+tt.base/2)
+			}
+		}
+	}
+}
+
+func TestGuardedInsideRetryingCountsEachAttempt(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute})
+	p := &scripted{errs: []error{ErrUnavailable, ErrUnavailable, ErrUnavailable}}
+	r := NewRetrying(NewGuarded(p, b), noDelay, nil)
+
+	if _, err := r.Pay(context.Background(), payRequest); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Pay() error = %v, want %v", err, ErrUnavailable)
+	}
+	if s := b.Snapshot(); s.State != BreakerOpen {
+		t.Errorf("state after 3 failed attempts = %s, want %s", s.State, BreakerOpen)
+	}
+}
@@ -0,0 +1,103 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event types published between services
+const (
+	TransactionSucceeded = "transaction.succeeded"
+	TransactionFailed    = "transaction.failed"
+	TransactionCancelled = "transaction.cancelled"
+	CreditReserved       = "credit.reserved"
+	CreditCaptured       = "credit.captured"
+	CreditRestored       = "credit.restored"
+	InvoiceIssued        = "invoice.issued"
+	InvoicePaid          = "invoice.paid"
+	InventoryLowStock    = "inventory.low_stock"
+)
+
+// Event is a fact about a state change, published at least once and not necessarily in order.
+// Consumers must deduplicate by ID and tolerate an event of an aggregate overtaking an earlier one.
+type Event struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// TransactionEvent is the payload of transaction events
+type TransactionEvent struct {
+	TxID         string `json:"tx_id"`
+	TenantID     string `json:"tenant_id"`
+	PartnerID    string `json:"partner_id"`
+	ProductCode  string `json:"product_code"`
+	Amount       int64  `json:"amount"`
+	Fee          int64  `json:"fee"`
+	Total        int64  `json:"total"`
+	Status       string `json:"status"`
+	ProviderTxID string `json:"provider_tx_id,omitempty"`
+}
+
+// CreditEvent is the payload of credit events
+type CreditEvent struct {
+	PartnerID string `json:"partner_id"`
+	TxID      string `json:"tx_id"`
+	Amount    int64  `json:"amount"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// InvoiceEvent is the payload of invoice events
+type InvoiceEvent struct {
+	InvoiceID string `json:"invoice_id"`
+	TenantID  string `json:"tenant_id"`
+	PartnerID string `json:"partner_id"`
+	Amount    int64  `json:"amount"`
+	Status    string `json:"status"`
+}
+
+// InventoryEvent is the payload of inventory events
+type InventoryEvent struct {
+	ProductCode string `json:"product_code"`
+	Available   int    `json:"available"`
+	Threshold   int    `json:"threshold"`
+}
+
+// ErrPermanent marks a handler error that redelivery cannot fix, such as a payload that does
+// not decode. Such events are not retried; the RabbitMQ bus parks them in the consumer's dead queue.
+var ErrPermanent = errors.New("event cannot be handled")
+
+// Permanent wraps err in ErrPermanent
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// Handler processes one event. Returning an error asks for redelivery, unless it wraps ErrPermanent.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus publishes events and delivers them to named consumers.
+// Each consumer receives every event of the types it subscribed to once per delivery,
+// and replicas subscribing under the same consumer name share the work.
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(ctx context.Context, consumer string, eventTypes []string, handler Handler) error
+	Close() error
+}
+
+// Open returns the bus for backend, either "memory" or "rabbitmq"
+func Open(backend, url, exchange string) (Bus, error) {
+	switch backend {
+	case "memory":
+		return NewMemoryBus(), nil
+	case "rabbitmq":
+		return NewRabbitMQBus(url, exchange)
+	default:
+		return nil, fmt.Errorf("unknown event bus backend %q", backend)
+	}
+}
@@ -0,0 +1,154 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// memoryRetries is how often the in-memory bus redelivers an event whose handler failed
+const memoryRetries = 3
+
+// MemoryBus delivers events in-process. It is meant for tests and local runs
+// where all publishers and consumers live in the same process.
+type MemoryBus struct {
+	mu   sync.RWMutex
+	subs []*memorySubscription
+	// closed is closed by Close to stop every subscription
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type memorySubscription struct {
+	consumer string
+	types    map[string]bool
+	handler  Handler
+	events   chan Event
+	// done is closed once the subscription has stopped delivering
+	done chan struct{}
+}
+
+// NewMemoryBus creates an in-memory bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{closed: make(chan struct{})}
+}
+
+// Publish queues the event for every matching subscription. The subscriptions are copied
+// first, so a subscriber whose queue is full holds up only this call and not Subscribe.
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	if isClosed(b.closed) {
+		return nil
+	}
+
+	b.mu.RLock()
+	var subs []*memorySubscription
+	for _, sub := range b.subs {
+		if sub.types[event.Type] {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+			// Stopped since it was copied; nothing will read the event
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe starts delivering matching events to handler until ctx is cancelled or the bus is closed
+func (b *MemoryBus) Subscribe(ctx context.Context, consumer string, eventTypes []string, handler Handler) error {
+	sub := &memorySubscription{
+		consumer: consumer,
+		types:    make(map[string]bool),
+		handler:  handler,
+		events:   make(chan Event, 256),
+		done:     make(chan struct{}),
+	}
+	for _, t := range eventTypes {
+		sub.types[t] = true
+	}
+
+	b.mu.Lock()
+	if isClosed(b.closed) {
+		b.mu.Unlock()
+		return nil
+	}
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.remove(sub)
+		sub.run(ctx, b.closed)
+	}()
+	return nil
+}
+
+// Close stops delivery to all subscriptions
+func (b *MemoryBus) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
+
+// remove drops a stopped subscription so that Publish no longer queues events for it
+func (b *MemoryBus) remove(sub *memorySubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	close(sub.done)
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *memorySubscription) run(ctx context.Context, closed <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case event := <-s.events:
+			// select picks among ready cases at random, so stopping is checked again
+			if ctx.Err() != nil || isClosed(closed) {
+				return
+			}
+			s.deliver(ctx, event)
+		}
+	}
+}
+
+func isClosed(closed <-chan struct{}) bool {
+	select {
+	case <-closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *memorySubscription) deliver(ctx context.Context, event Event) {
+	for attempt := 1; attempt <= memoryRetries; attempt++ {
+		err := s.handler(ctx, event)
+		if err == nil {
+			return
+		}
+		log.Printf("Consumer %s failed to handle event %s (attempt %d): %v", s.consumer, event.ID, attempt, err)
+		if errors.Is(err, ErrPermanent) {
+			return
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+}
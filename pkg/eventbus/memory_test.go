@@ -0,0 +1,192 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receive waits for the next event delivered on ch
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+		return Event{}
+	}
+}
+
+// nothing asserts that no event is delivered on ch
+func nothing(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected event %s delivered", e.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func collect(ch chan<- Event) Handler {
+	return func(ctx context.Context, event Event) error {
+		ch <- event
+		return nil
+	}
+}
+
+func TestMemoryBusDeliversSubscribedTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	received := make(chan Event, 10)
+	if err := bus.Subscribe(ctx, "receipts", []string{TransactionSucceeded}, collect(received)); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if err := bus.Publish(ctx, Event{ID: "e1", Type: TransactionFailed}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := bus.Publish(ctx, Event{ID: "e2", Type: TransactionSucceeded}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if e := receive(t, received); e.ID != "e2" {
+		t.Errorf("delivered %s, want e2", e.ID)
+	}
+	nothing(t, received)
+}
+
+func TestMemoryBusDeliversToEverySubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	first := make(chan Event, 1)
+	second := make(chan Event, 1)
+	bus.Subscribe(ctx, "first", []string{TransactionSucceeded}, collect(first))
+	bus.Subscribe(ctx, "second", []string{TransactionSucceeded}, collect(second))
+
+	bus.Publish(ctx, Event{ID: "e1", Type: TransactionSucceeded})
+
+	if e := receive(t, first); e.ID != "e1" {
+		t.Errorf("first got %s, want e1", e.ID)
+	}
+	if e := receive(t, second); e.ID != "e1" {
+		t.Errorf("second got %s, want e1", e.ID)
+	}
+}
+
+func TestMemoryBusRetriesFailedHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	var calls int32
+	done := make(chan Event, 1)
+	bus.Subscribe(ctx, "flaky", []string{TransactionSucceeded}, func(ctx context.Context, event Event) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return errors.New("temporary failure")
+		}
+		done <- event
+		return nil
+	})
+
+	bus.Publish(ctx, Event{ID: "e1", Type: TransactionSucceeded})
+
+	receive(t, done)
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("handler called %d times, want 2", got)
+	}
+}
+
+func TestMemoryBusStopsAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+
+	received := make(chan Event, 1)
+	bus.Subscribe(ctx, "receipts", []string{TransactionSucceeded}, collect(received))
+	bus.Close()
+
+	if err := bus.Publish(ctx, Event{ID: "e1", Type: TransactionSucceeded}); err != nil {
+		t.Fatalf("Publish() after Close error = %v", err)
+	}
+	nothing(t, received)
+}
+
+func TestMemoryBusSkipsStoppedSubscriber(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	subCtx, stop := context.WithCancel(context.Background())
+	bus.Subscribe(subCtx, "stopped", []string{TransactionSucceeded}, collect(make(chan Event, 1)))
+	stop()
+
+	// More events than the subscription's queue holds, which would block on a stopped reader
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 300; i++ {
+		if err := bus.Publish(ctx, Event{ID: "e", Type: TransactionSucceeded}); err != nil {
+			t.Fatalf("Publish() %d error = %v", i+1, err)
+		}
+	}
+}
+
+func TestMemoryBusSubscribeWhilePublishWaits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	// A stalled handler leaves Publish waiting on its full queue
+	stalled := make(chan struct{})
+	defer close(stalled)
+	bus.Subscribe(ctx, "stalled", []string{TransactionSucceeded}, func(ctx context.Context, event Event) error {
+		<-stalled
+		return nil
+	})
+	go func() {
+		for {
+			if err := bus.Publish(ctx, Event{ID: "e", Type: TransactionSucceeded}); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	subscribed := make(chan struct{})
+	go func() {
+		bus.Subscribe(ctx, "receipts", []string{TransactionFailed}, collect(make(chan Event, 1)))
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe() blocked behind a waiting Publish")
+	}
+}
+
+func TestMemoryBusDoesNotRetryPermanentFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	calls := make(chan Event, memoryRetries)
+	bus.Subscribe(ctx, "strict", []string{TransactionSucceeded}, func(ctx context.Context, event Event) error {
+		calls <- event
+		return Permanent(errors.New("payload does not decode"))
+	})
+
+	bus.Publish(ctx, Event{ID: "e1", Type: TransactionSucceeded})
+
+	receive(t, calls)
+	nothing(t, calls)
+}
@@ -0,0 +1,395 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// rabbitPrefetch bounds unacknowledged deliveries per consumer channel
+const rabbitPrefetch = 16
+
+// Redelivery of failed events. A failed event waits rabbitRetryDelay in the consumer's
+// retry queue before it is delivered again, and after rabbitMaxAttempts deliveries, or at
+// once when its handler failed permanently, it is parked in the consumer's dead queue.
+const (
+	rabbitRetryDelay  = 30 * time.Second
+	rabbitMaxAttempts = 5
+)
+
+// Reconnect backoff after the broker connection or a consumer channel is lost
+const (
+	rabbitReconnectDelay    = time.Second
+	rabbitMaxReconnectDelay = 30 * time.Second
+)
+
+// errBusClosed is returned by Publish after Close
+var errBusClosed = errors.New("event bus is closed")
+
+// RabbitMQBus publishes events to a durable topic exchange routed by event type.
+// Each consumer gets a durable queue named after it, shared by its replicas, which
+// dead-letters rejected events to a "<consumer>.retry" queue that returns them after a
+// delay. Events that keep failing are parked in "<consumer>.dead" for operators.
+// When the connection drops the bus redials in the background; publishes fail until it is
+// back, and every subscription re-declares its queue and resumes consuming.
+type RabbitMQBus struct {
+	url      string
+	exchange string
+	closed   chan struct{}
+	once     sync.Once
+
+	// mu guards the current connection and its publishing channel, which is not safe for
+	// concurrent use
+	mu   sync.Mutex
+	conn *amqp.Connection
+	pub  *amqp.Channel
+}
+
+// NewRabbitMQBus connects to RabbitMQ and declares the exchange
+func NewRabbitMQBus(url, exchange string) (*RabbitMQBus, error) {
+	b := &RabbitMQBus{url: url, exchange: exchange, closed: make(chan struct{})}
+	conn, pub, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	b.conn, b.pub = conn, pub
+	go b.supervise(conn, pub)
+	return b, nil
+}
+
+// dial opens a connection with a confirming publish channel and declares the exchange
+func (b *RabbitMQBus) dial() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to rabbitmq: %w", err)
+	}
+
+	pub, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open rabbitmq channel: %w", err)
+	}
+	if err := pub.ExchangeDeclare(b.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to declare exchange: %w", err)
+	}
+	// Publisher confirms, so an outbox event is only marked published once the broker has it
+	if err := pub.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	return conn, pub, nil
+}
+
+// supervise waits for the connection or its publishing channel to close and redials until
+// the bus is closed. Losing only the publishing channel replaces the whole connection, so
+// that there is one recovery path; consumers notice their channels closing and resubscribe.
+func (b *RabbitMQBus) supervise(conn *amqp.Connection, pub *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		pubClosed := pub.NotifyClose(make(chan *amqp.Error, 1))
+		select {
+		case <-b.closed:
+			return
+		case err := <-connClosed:
+			log.Printf("RabbitMQ connection closed: %v", err)
+		case err := <-pubClosed:
+			log.Printf("RabbitMQ publishing channel closed: %v", err)
+		}
+		conn.Close()
+
+		delay := rabbitReconnectDelay
+		for {
+			select {
+			case <-b.closed:
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			conn, pub, err = b.dial()
+			if err == nil {
+				break
+			}
+			delay = nextReconnectDelay(delay)
+			log.Printf("Error reconnecting to rabbitmq, retrying in %s: %v", delay, err)
+		}
+
+		b.mu.Lock()
+		select {
+		case <-b.closed:
+			b.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		b.conn, b.pub = conn, pub
+		b.mu.Unlock()
+		log.Printf("Reconnected to rabbitmq")
+	}
+}
+
+// Publish sends a persistent message and waits for the broker to confirm it
+func (b *RabbitMQBus) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	b.mu.Lock()
+	select {
+	case <-b.closed:
+		b.mu.Unlock()
+		return errBusClosed
+	default:
+	}
+	confirm, err := b.pub.PublishWithDeferredConfirmWithContext(ctx, b.exchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID,
+		Type:         event.Type,
+		Timestamp:    event.OccurredAt,
+		Body:         body,
+	})
+	b.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	// A channel lost before the confirm arrives settles it as not acknowledged
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm event: %w", err)
+	}
+	if !acked {
+		return errors.New("broker rejected event")
+	}
+	return nil
+}
+
+// Subscribe binds the consumer's queue to the event types and handles deliveries
+// until ctx is cancelled or the bus is closed. Failed deliveries are retried after a
+// delay a bounded number of times. The first
+// subscription is made before returning, so that setup errors reach the caller; after
+// that a lost channel is reopened and the queue re-declared and re-bound.
+func (b *RabbitMQBus) Subscribe(ctx context.Context, consumer string, eventTypes []string, handler Handler) error {
+	ch, deliveries, err := b.consume(consumer, eventTypes)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		delay := rabbitReconnectDelay
+		for {
+			if b.deliver(ctx, consumer, ch, deliveries, handler) {
+				return
+			}
+			log.Printf("Delivery channel for consumer %s closed, resubscribing", consumer)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-b.closed:
+					return
+				case <-time.After(delay):
+				}
+				ch, deliveries, err = b.consume(consumer, eventTypes)
+				if err == nil {
+					delay = rabbitReconnectDelay
+					break
+				}
+				delay = nextReconnectDelay(delay)
+				log.Printf("Error resubscribing consumer %s, retrying in %s: %v", consumer, delay, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// consume opens a channel on the current connection, declares and binds the consumer's
+// queue and starts consuming from it
+func (b *RabbitMQBus) consume(consumer string, eventTypes []string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open rabbitmq channel: %w", err)
+	}
+	if err := ch.Qos(rabbitPrefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	// Publisher confirms, so an event is only acknowledged once its dead queue has it
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	queue, err := declareQueues(ch, consumer)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	for _, eventType := range eventTypes {
+		if err := ch.QueueBind(queue.Name, eventType, b.exchange, false, nil); err != nil {
+			ch.Close()
+			return nil, nil, fmt.Errorf("failed to bind %s: %w", eventType, err)
+		}
+	}
+
+	deliveries, err := ch.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to consume: %w", err)
+	}
+	return ch, deliveries, nil
+}
+
+// deliver hands deliveries to handler until their channel closes, and reports whether the
+// subscription is over because ctx was cancelled or the bus closed
+func (b *RabbitMQBus) deliver(ctx context.Context, consumer string, ch *amqp.Channel, deliveries <-chan amqp.Delivery, handler Handler) bool {
+	defer ch.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-b.closed:
+			return true
+		case d, ok := <-deliveries:
+			if !ok {
+				return false
+			}
+			handleDelivery(ctx, consumer, ch, d, handler)
+		}
+	}
+}
+
+// Close closes the connection and with it all subscriptions
+func (b *RabbitMQBus) Close() error {
+	b.once.Do(func() { close(b.closed) })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The connection may already be down while the bus was reconnecting
+	if err := b.conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// nextReconnectDelay doubles delay up to rabbitMaxReconnectDelay
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > rabbitMaxReconnectDelay {
+		return rabbitMaxReconnectDelay
+	}
+	return delay
+}
+
+// declareQueues declares the consumer's queue with its retry and dead queues. All three are
+// addressed through the default exchange. A queue declared before dead-lettering was added
+// has other arguments, which the broker refuses; it must be deleted once to be re-created.
+func declareQueues(ch *amqp.Channel, consumer string) (amqp.Queue, error) {
+	_, err := ch.QueueDeclare(consumer+".dead", true, false, false, false, nil)
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare dead queue: %w", err)
+	}
+	_, err = ch.QueueDeclare(consumer+".retry", true, false, false, false, amqp.Table{
+		"x-message-ttl":             rabbitRetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": consumer,
+	})
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare retry queue: %w", err)
+	}
+	queue, err := ch.QueueDeclare(consumer, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": consumer + ".retry",
+	})
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return queue, fmt.Errorf("queue %s exists without dead-lettering, delete it to re-create it: %w", consumer, err)
+	}
+	if err != nil {
+		return queue, fmt.Errorf("failed to declare queue: %w", err)
+	}
+	return queue, nil
+}
+
+// handleDelivery acknowledges a handled event. A failed one is rejected, which dead-letters
+// it to the retry queue, until it has been delivered rabbitMaxAttempts times; then, or when
+// it can never be handled, it is moved to the dead queue.
+func handleDelivery(ctx context.Context, consumer string, ch *amqp.Channel, d amqp.Delivery, handler Handler) {
+	var event Event
+	if err := json.Unmarshal(d.Body, &event); err != nil {
+		// Redelivering a malformed message can never succeed
+		log.Printf("Consumer %s parking malformed message %s: %v", consumer, d.MessageId, err)
+		park(ctx, consumer, ch, d)
+		return
+	}
+
+	err := handler(ctx, event)
+	if err == nil {
+		_ = d.Ack(false)
+		return
+	}
+
+	attempt := rejections(d.Headers, consumer) + 1
+	log.Printf("Consumer %s failed to handle event %s (attempt %d): %v", consumer, event.ID, attempt, err)
+	if errors.Is(err, ErrPermanent) || attempt >= rabbitMaxAttempts {
+		park(ctx, consumer, ch, d)
+		return
+	}
+	_ = d.Nack(false, false)
+}
+
+// park moves a delivery to the consumer's dead queue. If the dead queue cannot take it, the
+// delivery is rejected into the retry queue instead, so it is not lost.
+func park(ctx context.Context, consumer string, ch *amqp.Channel, d amqp.Delivery) {
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", consumer+".dead", false, false, amqp.Publishing{
+		Headers:      d.Headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Type:         d.Type,
+		Timestamp:    d.Timestamp,
+		Body:         d.Body,
+	})
+	if err == nil {
+		var acked bool
+		if acked, err = confirm.WaitContext(ctx); err == nil && !acked {
+			err = errors.New("broker rejected message")
+		}
+	}
+	if err != nil {
+		log.Printf("Consumer %s failed to park message %s, retrying it: %v", consumer, d.MessageId, err)
+		_ = d.Nack(false, false)
+		return
+	}
+	_ = d.Ack(false)
+}
+
+// rejections returns how often a message was rejected by the consumer's queue, from the
+// x-death header the broker adds each time it dead-letters the message
+func rejections(headers amqp.Table, consumer string) int {
+	deaths, _ := headers["x-death"].([]interface{})
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok || table["queue"] != consumer || table["reason"] != "rejected" {
+			continue
+		}
+		if count, ok := table["count"].(int64); ok {
+			return int(count)
+		}
+	}
+	return 0
+}
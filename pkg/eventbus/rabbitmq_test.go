@@ -0,0 +1,41 @@
+package eventbus
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRejections(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "first delivery", headers: nil, want: 0},
+		{
+			name: "rejected twice",
+			headers: amqp.Table{"x-death": []interface{}{
+				amqp.Table{"queue": "billing.receivables.retry", "reason": "expired", "count": int64(2)},
+				amqp.Table{"queue": "billing.receivables", "reason": "rejected", "count": int64(2)},
+			}},
+			want: 2,
+		},
+		{
+			name: "other consumer",
+			headers: amqp.Table{"x-death": []interface{}{
+				amqp.Table{"queue": "ppob.receipts", "reason": "rejected", "count": int64(4)},
+			}},
+			want: 0,
+		},
+		{name: "malformed header", headers: amqp.Table{"x-death": "rejected"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejections(tt.headers, "billing.receivables"); got != tt.want {
+				t.Errorf("rejections() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
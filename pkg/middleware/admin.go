@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminMiddleware authenticates operators by the X-Admin-Token header.
+// tokens maps each accepted token to the admin ID bound to the request.
+func AdminMiddleware(tokens map[string]string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Get("X-Admin-Token")
+		if token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "missing admin token",
+			})
+		}
+
+		for candidate, adminID := range tokens {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+				c.Locals("admin_id", adminID)
+				return c.Next()
+			}
+		}
+
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid admin token",
+		})
+	}
+}
+
+// AdminID returns the operator bound to the request by AdminMiddleware
+func AdminID(c *fiber.Ctx) string {
+	adminID, _ := c.Locals("admin_id").(string)
+	return adminID
+}
@@ -1,10 +1,51 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/models"
 	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
 )
 
-// AuthMiddleware validates API key from header
+// apiKeyCacheTTL is how long a resolved API key is trusted before it is looked up again
+const apiKeyCacheTTL = time.Minute
+
+// apiKeyIdentity is what an API key resolves to
+type apiKeyIdentity struct {
+	KeyID      string
+	TenantID   string
+	TenantPlan string
+	Scopes     []string
+	ExpiresAt  *time.Time
+}
+
+type cachedKey struct {
+	identity  apiKeyIdentity
+	expiresAt time.Time
+}
+
+// keyCache caches API key lookups by key hash
+var keyCache = struct {
+	sync.RWMutex
+	entries map[string]cachedKey
+}{entries: make(map[string]cachedKey)}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash under which an API key is stored
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthMiddleware validates API key from header against tenant_api_keys
+// and binds the owning tenant and the key's scopes to the request
 func AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		apiKey := c.Get("X-API-Key")
@@ -14,16 +55,114 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		// TODO: Validate API key against tenant database
-		c.Locals("tenant_id", "tenant_default")
+		identity, err := lookupAPIKey(c.Context(), HashAPIKey(apiKey))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid API key",
+			})
+		}
+		if err != nil {
+			log.Printf("Error validating API key: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to validate API key",
+			})
+		}
+
+		if identity.ExpiresAt != nil && time.Now().After(*identity.ExpiresAt) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "API key expired",
+			})
+		}
+
+		c.Locals("api_key_id", identity.KeyID)
+		c.Locals("api_key_scopes", identity.Scopes)
+		c.Locals("tenant_id", identity.TenantID)
+		c.Locals("tenant_plan", identity.TenantPlan)
 		return c.Next()
 	}
 }
 
-// RateLimitMiddleware applies rate limiting (3 requests per second per partner)
-func RateLimitMiddleware() fiber.Handler {
+// RequireTenant rejects requests whose tenant path param does not match the authenticated tenant
+func RequireTenant(param string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// TODO: Implement Redis-based rate limiting
+		if c.Params(param) != TenantID(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "tenant mismatch",
+			})
+		}
 		return c.Next()
 	}
 }
+
+// RequireScope rejects requests whose API key was not granted the given scope
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, _ := c.Locals("api_key_scopes").([]string)
+		for _, granted := range scopes {
+			if granted == scope || granted == models.ScopeAll {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API key lacks scope " + scope,
+		})
+	}
+}
+
+// EvictAPIKey drops a key from this process's lookup cache, e.g. after it is revoked.
+// Other replicas stop accepting it once their cache entry expires.
+func EvictAPIKey(keyID string) {
+	keyCache.Lock()
+	defer keyCache.Unlock()
+	for hash, entry := range keyCache.entries {
+		if entry.identity.KeyID == keyID {
+			delete(keyCache.entries, hash)
+		}
+	}
+}
+
+// TenantID returns the tenant bound to the request by AuthMiddleware
+func TenantID(c *fiber.Ctx) string {
+	tenantID, _ := c.Locals("tenant_id").(string)
+	return tenantID
+}
+
+// APIKeyID returns the ID of the API key that authenticated the request
+func APIKeyID(c *fiber.Ctx) string {
+	keyID, _ := c.Locals("api_key_id").(string)
+	return keyID
+}
+
+func lookupAPIKey(ctx context.Context, keyHash string) (apiKeyIdentity, error) {
+	now := time.Now()
+
+	keyCache.RLock()
+	entry, ok := keyCache.entries[keyHash]
+	keyCache.RUnlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.identity, nil
+	}
+
+	var identity apiKeyIdentity
+	err := db.Pool.QueryRow(ctx,
+		`SELECT k.id, k.tenant_id, t.plan, k.scopes, k.expires_at
+		 FROM tenant_api_keys k JOIN tenants t ON t.id = k.tenant_id
+		 WHERE k.key_hash = $1 AND k.revoked_at IS NULL`,
+		keyHash).Scan(&identity.KeyID, &identity.TenantID, &identity.TenantPlan, &identity.Scopes, &identity.ExpiresAt)
+	if err != nil {
+		return apiKeyIdentity{}, err
+	}
+
+	// last_used_at is only refreshed on cache misses, so it has cache TTL granularity
+	if _, err := db.Pool.Exec(ctx,
+		"UPDATE tenant_api_keys SET last_used_at = $1 WHERE id = $2",
+		now, identity.KeyID); err != nil {
+		log.Printf("Error updating API key last use: %v", err)
+	}
+
+	keyCache.Lock()
+	keyCache.entries[keyHash] = cachedKey{identity: identity, expiresAt: now.Add(apiKeyCacheTTL)}
+	keyCache.Unlock()
+
+	return identity, nil
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/config"
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimitMiddleware applies a token bucket per tenant and partner, sized by the tenant's plan.
+// Only partners of the authenticated tenant get their own bucket, so a client cannot escape its
+// limit by naming other partners. It must run after AuthMiddleware. Store errors fail open so a
+// limiter outage does not block traffic.
+func RateLimitMiddleware(store ratelimit.Store, cfg config.RateLimitConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		plan, _ := c.Locals("tenant_plan").(string)
+		planLimit, ok := cfg.Plans[plan]
+		if !ok {
+			planLimit = cfg.Default
+		}
+		limit := ratelimit.Limit{Rate: planLimit.Rate, Burst: planLimit.Burst}
+
+		tenantID := TenantID(c)
+		key := fmt.Sprintf("ratelimit:%s:%s", tenantID, partnerBucket(c, tenantID))
+		result, err := store.Allow(c.Context(), key, limit)
+		if err != nil {
+			log.Printf("Error applying rate limit: %v", err)
+			return c.Next()
+		}
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "rate limit exceeded",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// partnerCacheTTL is how long a partner found to belong to a tenant is trusted
+const partnerCacheTTL = time.Minute
+
+// partnerCache remembers partners found to belong to their tenant, by tenant and partner ID.
+// Unknown partners are not cached, so made-up IDs cannot grow it.
+var partnerCache = struct {
+	sync.RWMutex
+	entries map[string]time.Time
+}{entries: make(map[string]time.Time)}
+
+// partnerBucket returns the partner whose bucket a request is counted in. A partner that does
+// not belong to the tenant counts in the tenant-wide bucket, as does a request without one.
+func partnerBucket(c *fiber.Ctx, tenantID string) string {
+	id := partnerID(c)
+	if id == "-" {
+		return id
+	}
+
+	cacheKey := tenantID + ":" + id
+	now := time.Now()
+	partnerCache.RLock()
+	expiresAt, ok := partnerCache.entries[cacheKey]
+	partnerCache.RUnlock()
+	if ok && now.Before(expiresAt) {
+		return id
+	}
+
+	var exists bool
+	err := db.Pool.QueryRow(c.Context(),
+		"SELECT EXISTS (SELECT 1 FROM partners WHERE id = $1 AND tenant_id = $2)",
+		id, tenantID).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking partner for rate limit: %v", err)
+		return "-"
+	}
+	if !exists {
+		return "-"
+	}
+
+	partnerCache.Lock()
+	partnerCache.entries[cacheKey] = now.Add(partnerCacheTTL)
+	partnerCache.Unlock()
+	return id
+}
+
+// partnerID identifies the partner a request is made for, from the X-Partner-ID header,
+// the partner_id body field or query param. Requests without one share a tenant-wide bucket.
+func partnerID(c *fiber.Ctx) string {
+	if id := c.Get("X-Partner-ID"); id != "" {
+		return id
+	}
+
+	var body struct {
+		PartnerID string `json:"partner_id"`
+	}
+	if len(c.Body()) > 0 && json.Unmarshal(c.Body(), &body) == nil && body.PartnerID != "" {
+		return body.PartnerID
+	}
+
+	if id := c.Query("partner_id"); id != "" {
+		return id
+	}
+	return "-"
+}
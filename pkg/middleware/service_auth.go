@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/serviceauth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ServiceAuthMiddleware only admits internal requests signed with the shared service secret
+func ServiceAuthMiddleware(verifier *serviceauth.Verifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := func(key string) string { return c.Get(key) }
+		err := verifier.Verify(c.Context(), c.Method(), c.OriginalURL(), header, c.Body())
+		if err == nil {
+			c.Locals("service_name", c.Get(serviceauth.HeaderService))
+			return c.Next()
+		}
+
+		switch {
+		case errors.Is(err, serviceauth.ErrMissingSignature),
+			errors.Is(err, serviceauth.ErrStaleTimestamp),
+			errors.Is(err, serviceauth.ErrInvalidSignature),
+			errors.Is(err, serviceauth.ErrReplayed):
+			log.Printf("Rejected internal request %s %s: %v", c.Method(), c.OriginalURL(), err)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		default:
+			log.Printf("Error verifying internal request: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to verify service signature",
+			})
+		}
+	}
+}
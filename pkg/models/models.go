@@ -1,16 +1,33 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/connector"
+)
 
 // Tenant represents a tenant in the system
 type Tenant struct {
 	ID        string    `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Plan      string    `json:"plan" db:"plan"`
-	APIKey    string    `json:"-" db:"api_key"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// TenantAPIKey represents one of a tenant's API keys
+type TenantAPIKey struct {
+	ID         string     `json:"id" db:"id"`
+	TenantID   string     `json:"tenant_id" db:"tenant_id"`
+	Label      string     `json:"label" db:"label"`
+	KeyPrefix  string     `json:"key_prefix" db:"key_prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
 // Partner represents a partner/reseller
 type Partner struct {
 	ID        string    `json:"id" db:"id"`
@@ -21,14 +38,75 @@ type Partner struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// ProviderConfig configures a tenant's provider connector
+type ProviderConfig struct {
+	ID             string `json:"id" db:"id"`
+	TenantID       string `json:"tenant_id" db:"tenant_id"`
+	ProviderName   string `json:"provider_name" db:"provider_name"`
+	Adapter        string `json:"adapter" db:"adapter"`
+	Endpoint       string `json:"endpoint" db:"endpoint"`
+	CredsEncrypted string `json:"-" db:"creds_encrypted"`
+	TimeoutMs      int    `json:"timeout_ms" db:"timeout_ms"`
+	StatusMapJSON  string `json:"status_map_json" db:"status_map_json"`
+	// Priority orders failover, lowest first; ProductCodes nil serves every product
+	Priority                int       `json:"priority" db:"priority"`
+	ProductCodes            []string  `json:"product_codes" db:"product_codes"`
+	BreakerFailureThreshold int       `json:"breaker_failure_threshold" db:"breaker_failure_threshold"`
+	BreakerOpenTimeoutMs    int       `json:"breaker_open_timeout_ms" db:"breaker_open_timeout_ms"`
+	BreakerHalfOpenMax      int       `json:"breaker_half_open_max" db:"breaker_half_open_max"`
+	Active                  bool      `json:"active" db:"active"`
+	CreatedAt               time.Time `json:"created_at" db:"created_at"`
+}
+
+// Provider adapter constants
+const (
+	ProviderAdapterMock = "mock"
+	ProviderAdapterHTTP = "http"
+	// ProviderAdapterInventory fulfills products from imported voucher codes
+	ProviderAdapterInventory = "inventory"
+)
+
 // CreditLimit represents credit limit for a partner
 type CreditLimit struct {
-	PartnerID      string    `json:"partner_id" db:"partner_id"`
-	LimitTotal     int64     `json:"limit_total" db:"limit_total"`
-	LimitUsed      int64     `json:"limit_used" db:"limit_used"`
-	LimitAvailable int64     `json:"limit_available" db:"limit_available"`
-	ResetPeriod    string    `json:"reset_period" db:"reset_period"`
-	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	PartnerID       string     `json:"partner_id" db:"partner_id"`
+	LimitTotal      int64      `json:"limit_total" db:"limit_total"`
+	LimitUsed       int64      `json:"limit_used" db:"limit_used"`
+	LimitAvailable  int64      `json:"limit_available" db:"limit_available"`
+	ResetPeriod     string     `json:"reset_period" db:"reset_period"`
+	CarryOverUnpaid bool       `json:"carry_over_unpaid" db:"carry_over_unpaid"`
+	LastResetAt     *time.Time `json:"last_reset_at" db:"last_reset_at"`
+	NextResetAt     *time.Time `json:"next_reset_at" db:"next_reset_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreditReservation represents credit reserved for a single transaction
+type CreditReservation struct {
+	TxID          string     `json:"tx_id" db:"tx_id"`
+	PartnerID     string     `json:"partner_id" db:"partner_id"`
+	Amount        int64      `json:"amount" db:"amount"`
+	Status        string     `json:"status" db:"status"`
+	ExpiresAt     *time.Time `json:"expires_at" db:"expires_at"`
+	CapturedAt    *time.Time `json:"captured_at" db:"captured_at"`
+	ReleasedAt    *time.Time `json:"released_at" db:"released_at"`
+	ReleaseReason *string    `json:"release_reason" db:"release_reason"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreditLimitChange is a proposed change to a partner's limit_total awaiting or past review
+type CreditLimitChange struct {
+	ID         string     `json:"id" db:"id"`
+	PartnerID  string     `json:"partner_id" db:"partner_id"`
+	ChangeType string     `json:"change_type" db:"change_type"`
+	Amount     int64      `json:"amount" db:"amount"`
+	Reason     string     `json:"reason" db:"reason"`
+	Status     string     `json:"status" db:"status"`
+	ProposedBy string     `json:"proposed_by" db:"proposed_by"`
+	ReviewedBy *string    `json:"reviewed_by" db:"reviewed_by"`
+	ReviewedAt *time.Time `json:"reviewed_at" db:"reviewed_at"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	RevertedAt *time.Time `json:"reverted_at" db:"reverted_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
 }
 
 // Transaction represents a PPOB transaction
@@ -39,12 +117,131 @@ type Transaction struct {
 	Amount         int64     `json:"amount" db:"amount"`
 	Fee            int64     `json:"fee" db:"fee"`
 	Total          int64     `json:"total" db:"total"`
+	ProviderCost   int64     `json:"provider_cost" db:"provider_cost"`
+	Margin         int64     `json:"margin" db:"margin"`
+	FeeRuleID      string    `json:"fee_rule_id,omitempty" db:"fee_rule_id"`
 	Status         string    `json:"status" db:"status"`
 	Provider       string    `json:"provider" db:"provider"`
+	ProductCode    string    `json:"product_code" db:"product_code"`
+	CustomerNo     string    `json:"customer_no" db:"customer_no"`
+	InquiryID      string    `json:"inquiry_id,omitempty" db:"inquiry_id"`
 	ProviderTxID   string    `json:"provider_tx_id" db:"provider_tx_id"`
 	IdempotencyKey string    `json:"-" db:"idempotency_key"`
+	RequestHash    string    `json:"-" db:"request_hash"`
+	CancelReason   string    `json:"cancel_reason,omitempty" db:"cancel_reason"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	// Fulfillment is what the provider delivered for the payment; its token is stored encrypted
+	Fulfillment *connector.Fulfillment `json:"fulfillment,omitempty" db:"-"`
+}
+
+// FeeRule computes the admin fee charged on a tenant's transactions.
+// Empty PartnerID, ProductCode and Category match any.
+type FeeRule struct {
+	ID          string  `json:"id" db:"id"`
+	TenantID    string  `json:"tenant_id" db:"tenant_id"`
+	PartnerID   *string `json:"partner_id" db:"partner_id"`
+	ProductCode *string `json:"product_code" db:"product_code"`
+	Category    *string `json:"category" db:"category"`
+	RuleType    string  `json:"rule_type" db:"rule_type"`
+	FlatFee     int64   `json:"flat_fee" db:"flat_fee"`
+	// PercentBps is a percentage in basis points, 250 is 2.5%
+	PercentBps int       `json:"percent_bps" db:"percent_bps"`
+	MinFee     *int64    `json:"min_fee" db:"min_fee"`
+	MaxFee     *int64    `json:"max_fee" db:"max_fee"`
+	Tiers      []FeeTier `json:"tiers,omitempty" db:"tiers_json"`
+	Priority   int       `json:"priority" db:"priority"`
+	Active     bool      `json:"active" db:"active"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// FeeTier applies once a partner's monthly volume reaches MinVolume
+type FeeTier struct {
+	MinVolume  int64 `json:"min_volume"`
+	FlatFee    int64 `json:"flat_fee"`
+	PercentBps int   `json:"percent_bps"`
+}
+
+// Fee rule type constants
+const (
+	FeeRuleFlat    = "flat"
+	FeeRulePercent = "percent"
+	FeeRuleTiered  = "tiered"
+)
+
+// Product is a sellable catalog item
+type Product struct {
+	Code     string `json:"code" db:"code"`
+	Name     string `json:"name" db:"name"`
+	Category string `json:"category" db:"category"`
+	// Denomination is nil for bills whose amount comes from inquiry or the request
+	Denomination *int64    `json:"denomination" db:"denomination"`
+	BaseCost     int64     `json:"base_cost" db:"base_cost"`
+	CancelWindow int       `json:"cancel_window" db:"cancel_window"`
+	Active       bool      `json:"active" db:"active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TenantProductPrice is a tenant's price for a product, or a partner's override when PartnerID is set
+type TenantProductPrice struct {
+	ID          string  `json:"id" db:"id"`
+	TenantID    string  `json:"tenant_id" db:"tenant_id"`
+	PartnerID   *string `json:"partner_id" db:"partner_id"`
+	ProductCode string  `json:"product_code" db:"product_code"`
+	// SellingPrice is nil to sell a fixed-denomination product at its denomination
+	SellingPrice *int64    `json:"selling_price" db:"selling_price"`
+	Fee          int64     `json:"fee" db:"fee"`
+	Active       bool      `json:"active" db:"active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ProviderAttempt is one provider call made for a transaction
+type ProviderAttempt struct {
+	ID         int64     `json:"id" db:"id"`
+	TxID       string    `json:"tx_id" db:"tx_id"`
+	Provider   string    `json:"provider" db:"provider"`
+	Operation  string    `json:"operation" db:"operation"`
+	Attempt    int       `json:"attempt" db:"attempt"`
+	Status     *string   `json:"status" db:"status"`
+	ErrorClass *string   `json:"error_class" db:"error_class"`
+	Error      *string   `json:"error" db:"error"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Inquiry is a provider quote for a customer's bill that a transaction can pay
+type Inquiry struct {
+	ID           string    `json:"id" db:"id"`
+	TenantID     string    `json:"tenant_id" db:"tenant_id"`
+	PartnerID    string    `json:"partner_id" db:"partner_id"`
+	ProductCode  string    `json:"product_code" db:"product_code"`
+	CustomerNo   string    `json:"customer_no" db:"customer_no"`
+	CustomerName string    `json:"customer_name" db:"customer_name"`
+	Amount       int64     `json:"amount" db:"amount"`
+	AdminFee     int64     `json:"admin_fee" db:"admin_fee"`
+	FeeRuleID    string    `json:"fee_rule_id,omitempty" db:"fee_rule_id"`
+	Provider     string    `json:"provider" db:"provider"`
+	Status       string    `json:"status" db:"status"`
+	TxID         *string   `json:"tx_id" db:"tx_id"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// TransactionSaga tracks a transaction's progress through credit and provider steps
+type TransactionSaga struct {
+	TxID              string     `json:"tx_id" db:"tx_id"`
+	State             string     `json:"state" db:"state"`
+	Attempts          int        `json:"attempts" db:"attempts"`
+	LastError         *string    `json:"last_error" db:"last_error"`
+	LockedUntil       *time.Time `json:"locked_until" db:"locked_until"`
+	StatusChecks      int        `json:"status_checks" db:"status_checks"`
+	NextStatusCheckAt *time.Time `json:"next_status_check_at" db:"next_status_check_at"`
+	FinishedAt        *time.Time `json:"finished_at" db:"finished_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Invoice represents a billing invoice
@@ -60,6 +257,61 @@ type Invoice struct {
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
 
+// VoucherBatch is one import of pre-purchased codes for a product
+type VoucherBatch struct {
+	ID             string    `json:"id" db:"id"`
+	ProductCode    string    `json:"product_code" db:"product_code"`
+	SupplierRef    *string   `json:"supplier_ref" db:"supplier_ref"`
+	CodeCount      int       `json:"code_count" db:"code_count"`
+	DuplicateCount int       `json:"duplicate_count" db:"duplicate_count"`
+	ImportedBy     string    `json:"imported_by" db:"imported_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// VoucherCode is an imported code; the code itself is only held encrypted
+type VoucherCode struct {
+	ID            int64      `json:"id" db:"id"`
+	BatchID       string     `json:"batch_id" db:"batch_id"`
+	ProductCode   string     `json:"product_code" db:"product_code"`
+	CodeEncrypted string     `json:"-" db:"code_encrypted"`
+	CodeHash      string     `json:"-" db:"code_hash"`
+	SerialNo      *string    `json:"serial_no" db:"serial_no"`
+	ExpiresAt     *time.Time `json:"expires_at" db:"expires_at"`
+	Status        string     `json:"status" db:"status"`
+	TxID          *string    `json:"tx_id" db:"tx_id"`
+	TenantID      *string    `json:"tenant_id" db:"tenant_id"`
+	AllocatedAt   *time.Time `json:"allocated_at" db:"allocated_at"`
+	RevealedAt    *time.Time `json:"revealed_at" db:"revealed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Voucher code status constants
+const (
+	VoucherStatusAvailable = "available"
+	VoucherStatusAllocated = "allocated"
+	VoucherStatusExpired   = "expired"
+)
+
+// InvoiceAdjustment records how billing accounted for a cancelled transaction
+type InvoiceAdjustment struct {
+	ID        string    `json:"id" db:"id"`
+	TxID      string    `json:"tx_id" db:"tx_id"`
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`
+	PartnerID string    `json:"partner_id" db:"partner_id"`
+	Amount    int64     `json:"amount" db:"amount"`
+	Status    string    `json:"status" db:"status"`
+	InvoiceID *string   `json:"invoice_id" db:"invoice_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Invoice adjustment status constants
+const (
+	InvoiceAdjustmentApplied    = "applied"
+	InvoiceAdjustmentUninvoiced = "uninvoiced"
+	InvoiceAdjustmentRefundDue  = "refund_due"
+)
+
 // AuditLog represents an audit log entry
 type AuditLog struct {
 	ID           string    `json:"id" db:"id"`
@@ -70,12 +322,161 @@ type AuditLog struct {
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
+// TenantWebhook is a tenant's callback URL for transaction events
+type TenantWebhook struct {
+	TenantID        string    `json:"tenant_id" db:"tenant_id"`
+	URL             string    `json:"url" db:"url"`
+	SecretEncrypted string    `json:"-" db:"secret_encrypted"`
+	Active          bool      `json:"active" db:"active"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TenantBranding is what a tenant's receipts show about the tenant
+type TenantBranding struct {
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
+	DisplayName string    `json:"display_name" db:"display_name"`
+	Address     *string   `json:"address" db:"address"`
+	Phone       *string   `json:"phone" db:"phone"`
+	Footer      *string   `json:"footer" db:"footer"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Receipt points to a transaction's rendered receipt in object storage
+type Receipt struct {
+	TxID      string    `json:"tx_id" db:"tx_id"`
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`
+	PDFKey    string    `json:"pdf_key" db:"pdf_key"`
+	TextKey   string    `json:"text_key" db:"text_key"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a tenant's webhook
+type WebhookDelivery struct {
+	ID            string     `json:"id" db:"id"`
+	TenantID      string     `json:"tenant_id" db:"tenant_id"`
+	TxID          *string    `json:"tx_id" db:"tx_id"`
+	EventType     string     `json:"event_type" db:"event_type"`
+	PayloadJSON   string     `json:"-" db:"payload_json"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string    `json:"last_error" db:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at" db:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookDeliveryAttempt is one POST of a webhook delivery
+type WebhookDeliveryAttempt struct {
+	ID         int64     `json:"id" db:"id"`
+	DeliveryID string    `json:"delivery_id" db:"delivery_id"`
+	Attempt    int       `json:"attempt" db:"attempt"`
+	URL        string    `json:"url" db:"url"`
+	StatusCode *int      `json:"status_code" db:"status_code"`
+	Error      *string   `json:"error" db:"error"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Webhook delivery status constants
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
 // Transaction status constants
 const (
 	TxStatusPending   = "pending"
 	TxStatusSuccess   = "success"
 	TxStatusFailed    = "failed"
 	TxStatusCancelled = "cancelled"
+	// TxStatusSuspect means the provider may or may not have taken the payment
+	TxStatusSuspect = "suspect"
+)
+
+// Product category constants
+const (
+	ProductCategoryPulsa       = "pulsa"
+	ProductCategoryData        = "data"
+	ProductCategoryPLNPrepaid  = "pln_prepaid"
+	ProductCategoryPLNPostpaid = "pln_postpaid"
+	ProductCategoryBPJS        = "bpjs"
+	ProductCategoryPDAM        = "pdam"
+	ProductCategoryEWallet     = "ewallet"
+	ProductCategoryGameVoucher = "game_voucher"
+	ProductCategoryGiftCard    = "gift_card"
+)
+
+// Inquiry status constants
+const (
+	InquiryStatusOpen = "open"
+	InquiryStatusUsed = "used"
+)
+
+// Transaction saga state constants
+const (
+	SagaStatePending         = "pending"
+	SagaStateCreditReserved  = "credit_reserved"
+	SagaStateProviderPending = "provider_pending"
+	SagaStateSuccess         = "success"
+	SagaStateFailed          = "failed"
+	SagaStateCompensated     = "compensated"
+	// SagaStateSuspect waits for the status-check worker to learn the provider's outcome
+	SagaStateSuspect = "suspect"
+	// SagaStateManualReview is a suspect saga the status checks could not settle
+	SagaStateManualReview = "manual_review"
+	// SagaStateCancelPending is a paid transaction whose reversal is being sent to the provider
+	SagaStateCancelPending = "cancel_pending"
+	// SagaStateCancelled is a reversed transaction whose credit is restored next
+	SagaStateCancelled = "cancelled"
+)
+
+// Credit reservation status constants
+const (
+	ReservationStatusReserved = "reserved"
+	ReservationStatusCaptured = "captured"
+	ReservationStatusReleased = "released"
+)
+
+// Credit reservation release reasons
+const (
+	ReleaseReasonReleased = "released"
+	ReleaseReasonRestored = "restored"
+	ReleaseReasonExpired  = "expired"
+)
+
+// Credit limit reset period constants
+const (
+	ResetPeriodDaily   = "daily"
+	ResetPeriodWeekly  = "weekly"
+	ResetPeriodMonthly = "monthly"
+)
+
+// Credit limit change type constants
+const (
+	LimitChangeIncrease          = "increase"
+	LimitChangeDecrease          = "decrease"
+	LimitChangeTemporaryIncrease = "temporary_increase"
+)
+
+// Credit limit change status constants
+const (
+	LimitChangeStatusPending  = "pending"
+	LimitChangeStatusApproved = "approved"
+	LimitChangeStatusRejected = "rejected"
+	LimitChangeStatusReverted = "reverted"
+)
+
+// API key scope constants
+const (
+	ScopeAll               = "*"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeInvoicesRead      = "invoices:read"
+	ScopeInvoicesWrite     = "invoices:write"
 )
 
 // Invoice status constants
@@ -86,3 +487,10 @@ const (
 	InvoiceStatusOverdue   = "overdue"
 	InvoiceStatusCancelled = "cancelled"
 )
+
+// Credit reservation conflict codes, sent with 409 responses so callers can tell them apart
+const (
+	ReservationConflictInsufficientLimit = "insufficient_credit"
+	ReservationConflictMismatch          = "reservation_mismatch"
+	ReservationConflictInvalidState      = "invalid_reservation_state"
+)
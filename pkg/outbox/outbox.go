@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aziz46/core-e-voucher-services/pkg/db"
+	"github.com/aziz46/core-e-voucher-services/pkg/eventbus"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Add writes an event to the outbox in the caller's transaction,
+// so it is published if and only if the state change commits
+func Add(ctx context.Context, tx pgx.Tx, aggregateType, aggregateID, eventType string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO outbox_events (id, aggregate_type, aggregate_id, event_type, payload_json, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.New().String(), aggregateType, aggregateID, eventType, string(payloadJSON), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
+
+// RelayLease is how long a relay may hold claimed events before another relay takes them over
+var RelayLease = time.Minute
+
+// Relay publishes up to limit unpublished events of the given aggregate types in outbox order
+// and returns how many were published. Each service relays only the aggregates it writes, so an
+// event is never claimed by a service whose bus cannot reach its consumers. The events are claimed
+// with a lease in a short transaction and published after it commits, so no row lock is held
+// across the broker. A relay publishes its own batch in order and stops at the first failure,
+// but with several relays one may publish a later event of an aggregate while another still
+// holds or retries an earlier one, so consumers must tolerate events arriving out of order.
+func Relay(ctx context.Context, bus eventbus.Bus, aggregateTypes []string, limit int) (int, error) {
+	owner := uuid.New().String()
+	now := time.Now()
+	rows, err := db.Pool.Query(ctx,
+		`UPDATE outbox_events SET lock_owner = $1, locked_until = $2
+		 WHERE id IN (
+		     SELECT id FROM outbox_events
+		     WHERE published_at IS NULL AND aggregate_type = ANY($3)
+		       AND (locked_until IS NULL OR locked_until < $4)
+		     ORDER BY seq LIMIT $5 FOR UPDATE SKIP LOCKED)
+		 RETURNING id, aggregate_type, aggregate_id, event_type, payload_json, created_at, seq`,
+		owner, now.Add(RelayLease), aggregateTypes, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	var events []eventbus.Event
+	var seqs []int64
+	for rows.Next() {
+		var e eventbus.Event
+		var payload string
+		var seq int64
+		if err := rows.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.Type, &payload, &e.OccurredAt, &seq); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+		seqs = append(seqs, seq)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	// RETURNING does not keep the order of the subquery
+	sort.Sort(bySeq{events, seqs})
+
+	published := 0
+	for i, e := range events {
+		if publishErr := bus.Publish(ctx, e); publishErr != nil {
+			_, err := db.Pool.Exec(ctx,
+				"UPDATE outbox_events SET attempts = attempts + 1, last_error = $1 WHERE id = $2 AND lock_owner = $3",
+				publishErr.Error(), e.ID, owner)
+			if err != nil {
+				log.Printf("Error recording publish error of event %s: %v", e.ID, err)
+			}
+			release(ctx, owner, events[i:])
+			return published, fmt.Errorf("failed to publish event: %w", publishErr)
+		}
+
+		_, err := db.Pool.Exec(ctx,
+			`UPDATE outbox_events SET attempts = attempts + 1, published_at = $1, last_error = NULL,
+			        lock_owner = NULL, locked_until = NULL
+			 WHERE id = $2 AND lock_owner = $3`,
+			time.Now(), e.ID, owner)
+		if err != nil {
+			// The event was published; it may be published again once the lease expires,
+			// which consumers tolerate through Idempotent
+			release(ctx, owner, events[i+1:])
+			return published, fmt.Errorf("failed to mark event published: %w", err)
+		}
+		published++
+	}
+	return published, nil
+}
+
+// release hands unpublished claimed events back so the next relay retries them without waiting
+// for the lease to expire
+func release(ctx context.Context, owner string, events []eventbus.Event) {
+	if len(events) == 0 {
+		return
+	}
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	_, err := db.Pool.Exec(ctx,
+		"UPDATE outbox_events SET lock_owner = NULL, locked_until = NULL WHERE id = ANY($1) AND lock_owner = $2",
+		ids, owner)
+	if err != nil {
+		log.Printf("Error releasing outbox events: %v", err)
+	}
+}
+
+// bySeq sorts claimed events by their outbox sequence
+type bySeq struct {
+	events []eventbus.Event
+	seqs   []int64
+}
+
+func (s bySeq) Len() int           { return len(s.events) }
+func (s bySeq) Less(i, j int) bool { return s.seqs[i] < s.seqs[j] }
+func (s bySeq) Swap(i, j int) {
+	s.events[i], s.events[j] = s.events[j], s.events[i]
+	s.seqs[i], s.seqs[j] = s.seqs[j], s.seqs[i]
+}
+
+// RunRelay publishes the outbox events of the given aggregate types every interval until ctx
+// is cancelled
+func RunRelay(ctx context.Context, bus eventbus.Bus, aggregateTypes []string, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			published, err := Relay(ctx, bus, aggregateTypes, batchSize)
+			if err != nil {
+				log.Printf("Error relaying outbox events: %v", err)
+				break
+			}
+			if published < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// Idempotent wraps a consumer handler so each event ID is handled at most once per consumer.
+// The handler runs in the transaction that records the event as processed.
+func Idempotent(consumer string, handle func(ctx context.Context, tx pgx.Tx, event eventbus.Event) error) eventbus.Handler {
+	return func(ctx context.Context, event eventbus.Event) error {
+		tx, err := db.Pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO processed_events (consumer, event_id, processed_at) VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`,
+			consumer, event.ID, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to record processed event: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+
+		if err := handle(ctx, tx, event); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for MemoryStore
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestStore() (*MemoryStore, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = c.Now
+	return s, c
+}
+
+func TestMemoryStoreAllowsBurstThenLimits(t *testing.T) {
+	s, _ := newTestStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Allow(ctx, "ratelimit:t1:p1", limit)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d denied within burst", i+1)
+		}
+		if result.Remaining != 1-i {
+			t.Errorf("request %d remaining = %d, want %d", i+1, result.Remaining, 1-i)
+		}
+	}
+
+	result, err := s.Allow(ctx, "ratelimit:t1:p1", limit)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("request beyond burst allowed")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("retry after = %v, want 1s", result.RetryAfter)
+	}
+	if result.Limit != 2 {
+		t.Errorf("limit = %d, want 2", result.Limit)
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	s, c := newTestStore()
+	limit := Limit{Rate: 2, Burst: 1}
+	ctx := context.Background()
+
+	if result, _ := s.Allow(ctx, "k", limit); !result.Allowed {
+		t.Fatal("first request denied")
+	}
+	if result, _ := s.Allow(ctx, "k", limit); result.Allowed {
+		t.Fatal("second request allowed before refill")
+	}
+
+	c.now = c.now.Add(500 * time.Millisecond)
+	if result, _ := s.Allow(ctx, "k", limit); !result.Allowed {
+		t.Fatal("request denied after refill")
+	}
+
+	// A long idle period refills only up to the burst
+	c.now = c.now.Add(time.Hour)
+	if result, _ := s.Allow(ctx, "k", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after idle: allowed = %v, remaining = %d, want allowed with 0 left", result.Allowed, result.Remaining)
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	s, _ := newTestStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	ctx := context.Background()
+
+	if result, _ := s.Allow(ctx, "ratelimit:t1:p1", limit); !result.Allowed {
+		t.Fatal("p1 denied")
+	}
+	if result, _ := s.Allow(ctx, "ratelimit:t1:p1", limit); result.Allowed {
+		t.Fatal("p1 allowed beyond burst")
+	}
+	if result, _ := s.Allow(ctx, "ratelimit:t1:p2", limit); !result.Allowed {
+		t.Fatal("p2 denied by p1's bucket")
+	}
+}
+
+func TestMemoryStoreSweepsIdleBuckets(t *testing.T) {
+	s, c := newTestStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	ctx := context.Background()
+
+	s.Allow(ctx, "idle", limit)
+	c.now = c.now.Add(time.Minute)
+	for i := 0; i < sweepEvery; i++ {
+		s.Allow(ctx, "busy", limit)
+	}
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if _, ok := s.buckets["busy"]; !ok {
+		t.Error("busy bucket was swept")
+	}
+}
+
+func TestMemoryStoreSweepKeepsBucketsOfSlowerLimits(t *testing.T) {
+	s, c := newTestStore()
+	slow := Limit{Rate: 0.1, Burst: 2}
+	fast := Limit{Rate: 100, Burst: 10}
+	ctx := context.Background()
+
+	s.Allow(ctx, "slow", slow)
+	s.Allow(ctx, "slow", slow)
+
+	// Long enough for a fast bucket to refill, but the slow one needs 20s
+	c.now = c.now.Add(5 * time.Second)
+	for i := 0; i < sweepEvery; i++ {
+		s.Allow(ctx, "fast", fast)
+	}
+	if _, ok := s.buckets["slow"]; !ok {
+		t.Fatal("slow bucket was swept before it refilled")
+	}
+	if result, _ := s.Allow(ctx, "slow", slow); result.Allowed {
+		t.Error("slow bucket allowed a request it had not refilled for")
+	}
+}
@@ -0,0 +1,35 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Client holds the shared Redis client
+var Client *goredis.Client
+
+// InitRedis initializes the Redis client
+func InitRedis(ctx context.Context, host string, port int, password string, db int) error {
+	Client = goredis.NewClient(&goredis.Options{
+		Addr:     fmt.Sprintf("%s:%d", host, port),
+		Password: password,
+		DB:       db,
+	})
+
+	// Test connection
+	if err := Client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	fmt.Println("Redis connection successful")
+	return nil
+}
+
+// CloseRedis closes the Redis client
+func CloseRedis() {
+	if Client != nil {
+		Client.Close()
+	}
+}
@@ -0,0 +1,95 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Box errors
+var (
+	ErrNoKey      = errors.New("encryption key not configured")
+	ErrCiphertext = errors.New("malformed ciphertext")
+)
+
+// Box encrypts values stored at rest with AES-256-GCM
+type Box struct {
+	aead cipher.AEAD
+	// macKey is derived from the encryption key for Fingerprint
+	macKey []byte
+}
+
+// NewBox creates a box from a base64-encoded 32-byte key. An empty key gives a box
+// that refuses to encrypt or decrypt, so services without secrets still start.
+func NewBox(encodedKey string) (*Box, error) {
+	if encodedKey == "" {
+		return &Box{}, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("fingerprint"))
+	return &Box{aead: aead, macKey: mac.Sum(nil)}, nil
+}
+
+// Encrypt returns base64(nonce || ciphertext) for plaintext
+func (b *Box) Encrypt(plaintext []byte) (string, error) {
+	if b == nil || b.aead == nil {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Decrypt reverses Encrypt
+func (b *Box) Decrypt(encoded string) ([]byte, error) {
+	if b == nil || b.aead == nil {
+		return nil, ErrNoKey
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrCiphertext
+	}
+	if len(data) < b.aead.NonceSize() {
+		return nil, ErrCiphertext
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrCiphertext
+	}
+	return plaintext, nil
+}
+
+// Fingerprint returns a keyed hex HMAC-SHA256 of value, so that encrypted values can be
+// matched for equality without storing them in the clear
+func (b *Box) Fingerprint(value []byte) (string, error) {
+	if b == nil || b.macKey == nil {
+		return "", ErrNoKey
+	}
+	mac := hmac.New(sha256.New, b.macKey)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,67 @@
+package serviceauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// NonceStore remembers nonces to reject replayed requests
+type NonceStore interface {
+	// Remember records nonce for ttl and reports whether it was not seen before
+	Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore keeps nonces in process memory, for single instances and tests
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	calls  int
+}
+
+// nonceSweepEvery is how many calls pass between sweeps of expired nonces
+const nonceSweepEvery = 1000
+
+// NewMemoryNonceStore creates a new in-memory nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Remember records nonce for ttl and reports whether it was not seen before
+func (s *MemoryNonceStore) Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.calls++
+	if s.calls%nonceSweepEvery == 0 {
+		for n, expiresAt := range s.nonces {
+			if now.After(expiresAt) {
+				delete(s.nonces, n)
+			}
+		}
+	}
+
+	if expiresAt, seen := s.nonces[nonce]; seen && now.Before(expiresAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// RedisNonceStore keeps nonces in Redis so replays are rejected across replicas
+type RedisNonceStore struct {
+	client *goredis.Client
+}
+
+// NewRedisNonceStore creates a new Redis-backed nonce store
+func NewRedisNonceStore(client *goredis.Client) *RedisNonceStore {
+	return &RedisNonceStore{client: client}
+}
+
+// Remember records nonce for ttl and reports whether it was not seen before
+func (s *RedisNonceStore) Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, "service_nonce:"+nonce, 1, ttl).Result()
+}
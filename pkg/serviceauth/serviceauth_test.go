@@ -0,0 +1,162 @@
+package serviceauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testSecret = "shared-secret"
+
+// signedRequest signs a credit reserve call as ppob-core would
+func signedRequest(t *testing.T, body []byte) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://credit-service/internal/credit/reserve?dry_run=1", nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if err := Sign(req, "ppob-core", testSecret, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return req
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"partner_id":"p1","tx_id":"tx-1","amount":20000}`)
+
+	tests := []struct {
+		name    string
+		tamper  func(req *http.Request) (uri string, body []byte)
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "body changed",
+			tamper: func(req *http.Request) (string, []byte) {
+				return req.URL.RequestURI(), []byte(`{"partner_id":"p1","tx_id":"tx-1","amount":1}`)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "query changed",
+			tamper: func(req *http.Request) (string, []byte) {
+				return req.URL.Path, body
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "service name changed",
+			tamper: func(req *http.Request) (string, []byte) {
+				req.Header.Set(HeaderService, "billing-service")
+				return req.URL.RequestURI(), body
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "service name missing",
+			tamper: func(req *http.Request) (string, []byte) {
+				req.Header.Del(HeaderService)
+				return req.URL.RequestURI(), body
+			},
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name: "signature missing",
+			tamper: func(req *http.Request) (string, []byte) {
+				req.Header.Del(HeaderSignature)
+				return req.URL.RequestURI(), body
+			},
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name: "timestamp not a number",
+			tamper: func(req *http.Request) (string, []byte) {
+				req.Header.Set(HeaderTimestamp, "yesterday")
+				return req.URL.RequestURI(), body
+			},
+			wantErr: ErrStaleTimestamp,
+		},
+		{
+			name:    "too old",
+			now:     time.Now().Add(10 * time.Minute),
+			wantErr: ErrStaleTimestamp,
+		},
+		{
+			name:    "from the future",
+			now:     time.Now().Add(-10 * time.Minute),
+			wantErr: ErrStaleTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, body)
+			uri, sent := req.URL.RequestURI(), body
+			if tt.tamper != nil {
+				uri, sent = tt.tamper(req)
+			}
+			v := NewVerifier(testSecret, 5*time.Minute, NewMemoryNonceStore())
+			if !tt.now.IsZero() {
+				v.now = func() time.Time { return tt.now }
+			}
+
+			err := v.Verify(context.Background(), req.Method, uri, req.Header.Get, sent)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsWrongSecret(t *testing.T) {
+	body := []byte(`{}`)
+	req := signedRequest(t, body)
+	v := NewVerifier("other-secret", 5*time.Minute, NewMemoryNonceStore())
+
+	err := v.Verify(context.Background(), req.Method, req.URL.RequestURI(), req.Header.Get, body)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestVerifyRejectsReplayedNonce(t *testing.T) {
+	body := []byte(`{}`)
+	req := signedRequest(t, body)
+	v := NewVerifier(testSecret, 5*time.Minute, NewMemoryNonceStore())
+	ctx := context.Background()
+
+	if err := v.Verify(ctx, req.Method, req.URL.RequestURI(), req.Header.Get, body); err != nil {
+		t.Fatalf("first Verify() error = %v", err)
+	}
+	err := v.Verify(ctx, req.Method, req.URL.RequestURI(), req.Header.Get, body)
+	if !errors.Is(err, ErrReplayed) {
+		t.Errorf("replayed Verify() error = %v, want %v", err, ErrReplayed)
+	}
+
+	// A fresh signature of the same request carries a new nonce
+	again := signedRequest(t, body)
+	if err := v.Verify(ctx, again.Method, again.URL.RequestURI(), again.Header.Get, body); err != nil {
+		t.Errorf("re-signed Verify() error = %v", err)
+	}
+}
+
+func TestMemoryNonceStoreForgetsExpiredNonces(t *testing.T) {
+	s := NewMemoryNonceStore()
+	ctx := context.Background()
+
+	if fresh, _ := s.Remember(ctx, "n1", time.Millisecond); !fresh {
+		t.Fatal("new nonce reported as seen")
+	}
+	if fresh, _ := s.Remember(ctx, "n1", time.Millisecond); fresh {
+		t.Fatal("nonce reported as new within its ttl")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if fresh, _ := s.Remember(ctx, "n1", time.Millisecond); !fresh {
+		t.Error("nonce still remembered after its ttl")
+	}
+}
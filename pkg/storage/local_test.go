@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorePath(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "tx-1.pdf", want: filepath.Join(dir, "tx-1.pdf")},
+		{key: "tenant_001/2024/tx-1.pdf", want: filepath.Join(dir, "tenant_001", "2024", "tx-1.pdf")},
+		{key: "/tenant_001//tx-1.pdf", want: filepath.Join(dir, "tenant_001", "tx-1.pdf")},
+		{key: "./tenant_001/tx-1.pdf", want: filepath.Join(dir, "tenant_001", "tx-1.pdf")},
+		{key: "", wantErr: true},
+		{key: "/", wantErr: true},
+		{key: ".", wantErr: true},
+		{key: "..", wantErr: true},
+		{key: "../outside.pdf", wantErr: true},
+		{key: "tenant_001/../../outside.pdf", wantErr: true},
+		{key: "tenant_001/..", wantErr: true},
+		{key: "tenant_001/a..b.pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := s.path(tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("path(%q) error = %v, want error %v", tt.key, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("path(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalStorePutGet(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	if _, err := s.Get(ctx, "tenant_001/tx-1.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() before Put error = %v, want %v", err, ErrNotFound)
+	}
+	if err := s.Put(ctx, "tenant_001/tx-1.pdf", "application/pdf", []byte("%PDF-1.4")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	body, err := s.Get(ctx, "tenant_001/tx-1.pdf")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(body) != "%PDF-1.4" {
+		t.Errorf("Get() = %q, want %q", body, "%PDF-1.4")
+	}
+
+	if err := s.Put(ctx, "../outside.pdf", "application/pdf", nil); err == nil {
+		t.Error("Put() outside the root error = nil, want an error")
+	}
+	if _, err := s.SignedURL(ctx, "tenant_001/tx-1.pdf", 0); !errors.Is(err, ErrSigningUnsupported) {
+		t.Errorf("SignedURL() error = %v, want %v", err, ErrSigningUnsupported)
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Storage errors
+var (
+	ErrNotFound = errors.New("object not found")
+	// ErrSigningUnsupported is returned by backends that cannot hand out download URLs
+	ErrSigningUnsupported = errors.New("storage backend does not support signed URLs")
+)
+
+// Store holds objects such as receipts under slash-separated keys
+type Store interface {
+	Put(ctx context.Context, key, contentType string, body []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// SignedURL returns a URL that downloads the object without credentials until ttl passes
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Config selects and configures a backend
+type Config struct {
+	// Backend is either "local" or "s3" (AWS S3 or MinIO)
+	Backend string
+	// LocalDir is the root directory of the local backend
+	LocalDir string
+	S3       S3Config
+}
+
+// Open returns the store for cfg.Backend
+func Open(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocalStore(cfg.LocalDir)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}